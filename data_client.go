@@ -46,12 +46,20 @@ type DataClient struct {
 	counter uint32
 	conns   []*grpc.ClientConn
 	clients []tspb.TablestoreClient
+
+	// default options to decode the rows read
+	decodeOptions *DecodeOptions
 }
 
 type DataClientConfig struct {
 	NumChannels int // 并发度，对应 session pool
 	RecvMsgSize int // max message size
 	SessionPoolConfig
+	// DecodeOptions are the default options rows read by the client decode
+	// with, for example Location renders every TIMESTAMP in a time zone
+	// instead of the offset it was stored with. The instants are unchanged.
+	// RowIterator.SetDecodeOptions overrides them.
+	DecodeOptions DecodeOptions
 }
 
 func NewDataClient(ctx context.Context, serverAddr, dbName string, conf DataClientConfig) (*DataClient, error) {
@@ -67,7 +75,7 @@ func NewDataClient(ctx context.Context, serverAddr, dbName string, conf DataClie
 		conf.MaxBurst = DefaultSessionPoolConfig.MaxBurst
 	}
 
-	dc := &DataClient{database: dbName}
+	dc := &DataClient{database: dbName, decodeOptions: &conf.DecodeOptions}
 
 	dialOpts := []grpc.DialOption{
 		grpc.WithInsecure(),
@@ -124,6 +132,7 @@ func (dc *DataClient) Close() {
 func (dc *DataClient) Single() *ReadOnlyTransaction {
 	t := &ReadOnlyTransaction{singleUse: true, sp: dc.sp}
 	t.txReadOnly.txReadEnv = t
+	t.txReadOnly.decodeOptions = dc.decodeOptions
 	return t
 }
 
@@ -143,6 +152,7 @@ func (dc *DataClient) ReadOnlyTransaction() *ReadOnlyTransaction {
 		txReadyOrClosed: make(chan struct{}),
 	}
 	t.txReadOnly.txReadEnv = t
+	t.txReadOnly.decodeOptions = dc.decodeOptions
 	return t
 }
 
@@ -188,6 +198,7 @@ func (dc *DataClient) ReadWriteTransaction(ctx context.Context, f func(t *ReadWr
 			}
 		}
 		t.txReadOnly.txReadEnv = t
+		t.txReadOnly.decodeOptions = dc.decodeOptions
 		if err = t.begin(ctx); err != nil {
 			// Mask error from begin operation as retryable error.
 			return err
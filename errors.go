@@ -32,6 +32,9 @@ type Error struct {
 	Desc string
 	// trailers are the trailers returned in the response, if any.
 	trailers metadata.MD
+	// columnName and sqlType locate a failure in decoding values.
+	columnName string
+	sqlType    string
 }
 
 func (e *Error) Error() string {
@@ -72,6 +75,29 @@ func (e *Error) decorate(info string) {
 	e.Desc = fmt.Sprintf("%v, %v", info, e.Desc)
 }
 
+// annotate records the column and the SQL type of a value which failed to
+// decode, the innermost ones recorded first are kept.
+func (e *Error) annotate(columnName, sqlType string) {
+	if e.columnName == "" {
+		e.columnName = columnName
+	}
+	if e.sqlType == "" {
+		e.sqlType = sqlType
+	}
+}
+
+// ColumnName returns the name of the column which failed to decode, or "" if
+// e isn't a decoding error or the column is unknown.
+func (e *Error) ColumnName() string {
+	return e.columnName
+}
+
+// SQLType returns the SQL type, such as INT64 or ARRAY<STRING>, of the value
+// which failed to decode, or "" if e isn't a decoding error.
+func (e *Error) SQLType() string {
+	return e.sqlType
+}
+
 var (
 	// mutations
 	ERR_MUTATION_EMPTY      = errors.New("empty mutations")
@@ -124,12 +150,12 @@ func toZettaErrorWithMetadata(err error, trailers metadata.MD) error {
 	}
 	switch {
 	case err == context.DeadlineExceeded:
-		return &Error{codes.DeadlineExceeded, err.Error(), trailers}
+		return &Error{Code: codes.DeadlineExceeded, Desc: err.Error(), trailers: trailers}
 	case err == context.Canceled:
-		return &Error{codes.Canceled, err.Error(), trailers}
+		return &Error{Code: codes.Canceled, Desc: err.Error(), trailers: trailers}
 	case status.Code(err) == codes.Unknown:
-		return &Error{codes.Unknown, err.Error(), trailers}
+		return &Error{Code: codes.Unknown, Desc: err.Error(), trailers: trailers}
 	default:
-		return &Error{status.Code(err), grpc.ErrorDesc(err), trailers}
+		return &Error{Code: status.Code(err), Desc: grpc.ErrorDesc(err), trailers: trailers}
 	}
 }
@@ -38,7 +38,7 @@ func decodeSparseValue(v *tspb.Value, t *tspb.Type, ptr interface{}) error {
 		typeErr = errTypeMismatch(acode, true, ptr)
 	}
 	nullErr := errDstNotForNull(ptr)
-	_, isNull := v.Kind.(*tspb.Value_NullValue)
+	isNull := IsNullValue(v)
 
 	// Do the decoding based on the type of ptr.
 	switch p := ptr.(type) {
@@ -85,7 +85,7 @@ func decodeSparseValue(v *tspb.Value, t *tspb.Type, ptr interface{}) error {
 		if err != nil {
 			return err
 		}
-		y, err := decodeStringArray(x)
+		y, err := decodeStringArray(x, nil)
 		if err != nil {
 			return err
 		}
@@ -119,7 +119,7 @@ func decodeSparseValue(v *tspb.Value, t *tspb.Type, ptr interface{}) error {
 		if err != nil {
 			return err
 		}
-		y, err := decodeByteArray(x)
+		y, err := decodeByteArray(x, nil)
 		if err != nil {
 			return err
 		}
@@ -168,7 +168,7 @@ func decodeSparseValue(v *tspb.Value, t *tspb.Type, ptr interface{}) error {
 		if err != nil {
 			return err
 		}
-		y, err := decodeIntArray(x)
+		y, err := decodeIntArray(x, nil)
 		if err != nil {
 			return err
 		}
@@ -220,7 +220,7 @@ func decodeSparseValue(v *tspb.Value, t *tspb.Type, ptr interface{}) error {
 		if err != nil {
 			return err
 		}
-		y, err := decodeBoolArray(x)
+		y, err := decodeBoolArray(x, nil)
 		if err != nil {
 			return err
 		}
@@ -272,7 +272,7 @@ func decodeSparseValue(v *tspb.Value, t *tspb.Type, ptr interface{}) error {
 		if err != nil {
 			return err
 		}
-		y, err := decodeFloat64Array(x)
+		y, err := decodeFloat64Array(x, nil)
 		if err != nil {
 			return err
 		}
@@ -307,7 +307,7 @@ func decodeSparseValue(v *tspb.Value, t *tspb.Type, ptr interface{}) error {
 		if err != nil {
 			return err
 		}
-		y, err := decodeTimeArray(x)
+		y, err := decodeTimeArray(x, nil)
 		if err != nil {
 			return err
 		}
@@ -322,14 +322,10 @@ func decodeSparseValue(v *tspb.Value, t *tspb.Type, ptr interface{}) error {
 		if isNull {
 			return nullErr
 		}
-		x, err := getStringValue(v)
+		y, err := getParsedDateValue(v)
 		if err != nil {
 			return err
 		}
-		y, err := civil.ParseDate(x)
-		if err != nil {
-			return errBadEncoding(v, err)
-		}
 		*p = y
 	case *NullDate:
 		if p == nil {
@@ -342,14 +338,10 @@ func decodeSparseValue(v *tspb.Value, t *tspb.Type, ptr interface{}) error {
 			*p = NullDate{}
 			break
 		}
-		x, err := getStringValue(v)
+		y, err := getParsedDateValue(v)
 		if err != nil {
 			return err
 		}
-		y, err := civil.ParseDate(x)
-		if err != nil {
-			return errBadEncoding(v, err)
-		}
 		p.Valid = true
 		p.Date = y
 	case *[]NullDate:
@@ -367,7 +359,7 @@ func decodeSparseValue(v *tspb.Value, t *tspb.Type, ptr interface{}) error {
 		if err != nil {
 			return err
 		}
-		y, err := decodeDateArray(x)
+		y, err := decodeDateArray(x, nil)
 		if err != nil {
 			return err
 		}
@@ -427,7 +419,7 @@ func decodeSparseValue(v *tspb.Value, t *tspb.Type, ptr interface{}) error {
 		if err != nil {
 			return err
 		}
-		if err = decodeStructArray(t.ArrayElementType.StructType, x, p); err != nil {
+		if err = decodeStructArray(t.ArrayElementType.StructType, x, p, nil); err != nil {
 			return err
 		}
 	}
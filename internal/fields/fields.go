@@ -189,6 +189,20 @@ func (c *Cache) Fields(t reflect.Type) (List, error) {
 	return c.cachedTypeFields(t)
 }
 
+// Invalidate drops the cached fields of t, they are computed again by the
+// next call to Fields.
+func (c *Cache) Invalidate(t reflect.Type) {
+	c.cache.Delete(t)
+}
+
+// Clear drops the cached fields of all types.
+func (c *Cache) Clear() {
+	c.cache.Range(func(k, _ interface{}) bool {
+		c.cache.Delete(k)
+		return true
+	})
+}
+
 // A List is a list of Fields.
 type List []Field
 
@@ -15,7 +15,10 @@ package zetta
 
 import (
 	"bytes"
+	"encoding/base64"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"cloud.google.com/go/civil"
@@ -188,3 +191,210 @@ func (r KeyRange) proto() (*tspb.KeyRange, error) {
 	}
 	return pb, nil
 }
+
+// compositeKeyNull is the text of a NULL part in a composite key, it can't be
+// produced by escaping any part as long as separators don't start with N.
+const compositeKeyNull = `\N`
+
+// errCompositeKeySep returns error for a separator composite keys can't use.
+func errCompositeKeySep(sep string) error {
+	return wrapError(codes.InvalidArgument, "invalid composite key separator %q", sep)
+}
+
+// errCompositeKeyParts returns error for a composite key with a wrong number of parts.
+func errCompositeKeyParts(s string, got, want int) error {
+	return wrapError(codes.InvalidArgument, "composite key %q has %d parts, want %d", s, got, want)
+}
+
+// errCompositeKeyEscape returns error for a malformed escape sequence in a composite key.
+func errCompositeKeyEscape(s string, i int) error {
+	return wrapError(codes.InvalidArgument, "composite key %q has bad escape at offset %d", s, i)
+}
+
+// validCompositeKeySep reports whether sep can separate composite key parts.
+// An escaped separator starting with N would read as the NULL marker.
+func validCompositeKeySep(sep string) bool {
+	return sep != "" && sep[0] != 'N' && !strings.ContainsRune(sep, '\\')
+}
+
+// EncodeCompositeKey encodes parts into a single string joined by sep, for
+// tables keyed by a delimited STRING column. Parts accept the same Go types
+// as Key, and are written in the text form understood by ValueFromString.
+// Backslashes and separators inside a part are escaped with a backslash and a
+// NULL part is written as \N, so DecodeCompositeKey restores the parts
+// exactly. sep must not be empty, start with N or contain a backslash.
+func EncodeCompositeKey(sep string, parts ...interface{}) (string, error) {
+	if !validCompositeKeySep(sep) {
+		return "", errCompositeKeySep(sep)
+	}
+	b := &strings.Builder{}
+	for i, part := range parts {
+		if i != 0 {
+			b.WriteString(sep)
+		}
+		pb, err := keyPartValue(part)
+		if err != nil {
+			return "", err
+		}
+		if IsNullValue(pb) {
+			b.WriteString(compositeKeyNull)
+			continue
+		}
+		s, err := compositeKeyPartString(part, pb)
+		if err != nil {
+			return "", err
+		}
+		for len(s) > 0 {
+			switch {
+			case s[0] == '\\':
+				b.WriteString(`\\`)
+				s = s[1:]
+			case strings.HasPrefix(s, sep):
+				b.WriteByte('\\')
+				b.WriteString(sep)
+				s = s[len(sep):]
+			default:
+				b.WriteByte(s[0])
+				s = s[1:]
+			}
+		}
+	}
+	return b.String(), nil
+}
+
+// compositeKeyPartString returns the text form of the non NULL key part
+// encoded as pb.
+func compositeKeyPartString(part interface{}, pb *tspb.Value) (string, error) {
+	switch x := pb.Kind.(type) {
+	case *tspb.Value_StringValue:
+		return x.StringValue, nil
+	case *tspb.Value_BytesValue:
+		return base64.StdEncoding.EncodeToString(x.BytesValue), nil
+	case *tspb.Value_IntegerValue:
+		return strconv.FormatInt(x.IntegerValue, 10), nil
+	case *tspb.Value_NumberValue:
+		return strconv.FormatFloat(x.NumberValue, 'g', -1, 64), nil
+	case *tspb.Value_BoolValue:
+		return strconv.FormatBool(x.BoolValue), nil
+	case *tspb.Value_TimestampValue:
+		switch part.(type) {
+		case civil.Date, NullDate:
+			d, err := getDateValue(pb)
+			return d.String(), err
+		}
+		t, err := getTimestampValue(pb)
+		return t.UTC().Format(time.RFC3339Nano), err
+	}
+	return "", errInvdKeyPartType(part)
+}
+
+// splitCompositeKey splits s on unescaped occurrences of sep. NULL parts are
+// returned as nil, other parts are unescaped.
+func splitCompositeKey(s, sep string) ([]*string, error) {
+	var parts []*string
+	for more := true; more; {
+		if rest := strings.TrimPrefix(s, compositeKeyNull); len(rest) < len(s) &&
+			(rest == "" || strings.HasPrefix(rest, sep)) {
+			parts = append(parts, nil)
+			if more = rest != ""; more {
+				s = rest[len(sep):]
+			}
+			continue
+		}
+		var (
+			part string
+			err  error
+		)
+		if part, s, more, err = unescapeCompositeKeyPart(s, sep); err != nil {
+			return nil, err
+		}
+		parts = append(parts, &part)
+	}
+	return parts, nil
+}
+
+// unescapeCompositeKeyPart unescapes the first part of s up to an unescaped
+// sep and returns the remaining text after it, more is false if s holds a
+// single part.
+func unescapeCompositeKeyPart(s, sep string) (part, rest string, more bool, err error) {
+	b := &strings.Builder{}
+	for i := 0; i < len(s); {
+		switch {
+		case s[i] == '\\' && strings.HasPrefix(s[i+1:], `\`):
+			b.WriteByte('\\')
+			i += 2
+		case s[i] == '\\' && strings.HasPrefix(s[i+1:], sep):
+			b.WriteString(sep)
+			i += 1 + len(sep)
+		case s[i] == '\\':
+			return "", "", false, errCompositeKeyEscape(s, i)
+		case strings.HasPrefix(s[i:], sep):
+			return b.String(), s[i+len(sep):], true, nil
+		default:
+			b.WriteByte(s[i])
+			i++
+		}
+	}
+	return b.String(), "", false, nil
+}
+
+// compositeKeyPartType returns the type of the values a composite key part
+// can be decoded into ptr from.
+func compositeKeyPartType(ptr interface{}) (*tspb.Type, error) {
+	switch ptr.(type) {
+	case *string, *NullString:
+		return stringType(), nil
+	case *[]byte:
+		return bytesType(), nil
+	case *int64, *NullInt64:
+		return intType(), nil
+	case *float64, *NullFloat64:
+		return floatType(), nil
+	case *bool, *NullBool:
+		return boolType(), nil
+	case *time.Time, *NullTime:
+		return timeType(), nil
+	case *civil.Date, *NullDate:
+		return dateType(), nil
+	}
+	return nil, errInvdKeyPartType(ptr)
+}
+
+// DecodeCompositeKey splits s, as produced by EncodeCompositeKey with the same
+// sep, and decodes one part into each of ptrs. Supported destinations are
+// pointers to string, []byte, int64, float64, bool, time.Time, civil.Date and
+// their Null counterparts. The number of parts must match len(ptrs).
+func DecodeCompositeKey(s, sep string, ptrs ...interface{}) error {
+	if !validCompositeKeySep(sep) {
+		return errCompositeKeySep(sep)
+	}
+	parts, err := splitCompositeKey(s, sep)
+	if err != nil {
+		return err
+	}
+	if len(parts) != len(ptrs) {
+		return errCompositeKeyParts(s, len(parts), len(ptrs))
+	}
+	for i, part := range parts {
+		t, err := compositeKeyPartType(ptrs[i])
+		if err != nil {
+			return err
+		}
+		var v *tspb.Value
+		switch {
+		case part == nil:
+			v = nullProto()
+		case t.Code == tspb.TypeCode_STRING, t.Code == tspb.TypeCode_TIMESTAMP, t.Code == tspb.TypeCode_DATE:
+			// TIMESTAMP and DATE values are decoded from their text form.
+			v = stringProto(*part)
+		default:
+			if v, err = ValueFromString(*part, t); err != nil {
+				return err
+			}
+		}
+		if err := decodeValue(v, t, ptrs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -14,8 +14,11 @@
 package zetta
 
 import (
+	"fmt"
 	"reflect"
+	"sort"
 
+	"github.com/sunxiaoguang/zetta-client-go/internal/fields"
 	tspb "github.com/zhihu/zetta-proto/pkg/tablestore"
 	"google.golang.org/grpc/codes"
 )
@@ -106,10 +109,18 @@ const (
 // used in the Insert/Update/InsertOrUpdate functions are:
 //
 //     string, NullString - STRING
+//     *regexp.Regexp - STRING holding its pattern
+//     NullJSON - STRING holding Value marshaled with encoding/json
+//     NullNumeric - STRING holding a decimal NUMERIC, see NumericString
+//     SemVer, NullSemVer - STRING holding the version text
 //     []string, []NullString - STRING ARRAY
-//     []byte - BYTES
-//     [][]byte - BYTES ARRAY
+//     []byte, NullBytes - BYTES
+//     [][]byte, []NullBytes - BYTES ARRAY
 //     int, int64, NullInt64 - INT64
+//     uint64, NullUint64 - INT64, values above math.MaxInt64 are rejected
+//     with codes.InvalidArgument, never wrapped around
+//     other integer kinds, such as int32 or uint16 - INT64, unsigned values
+//     must not overflow int64
 //     []int, []int64, []NullInt64 - INT64 ARRAY
 //     bool, NullBool - BOOL
 //     []bool, []NullBool - BOOL ARRAY
@@ -119,6 +130,16 @@ const (
 //     []time.Time, []NullTime - TIMESTAMP ARRAY
 //     Date, NullDate - DATE
 //     []Date, []NullDate - DATE ARRAY
+//     Go structs and pointers to them - STRUCT, fields named as in InsertStruct,
+//     nested structs included, a nil pointer is NULL
+//     slices of Go structs or pointers to them, []interface{} - ARRAY, the
+//     elements may be of different struct types sharing the same fields
+//     ForceNull - NULL of the type of its Value
+//     types implementing Encoder - the type they encode themselves as
+//     nil - NULL, also a nil pointer to any of the above, which is typed as
+//     its target would be; nil maps, channels or functions, or pointers to
+//     types which can't be encoded, tell nothing of the column type and are
+//     rejected, use a Null type or a GenericColumnValue as the type hint
 //
 // To compare two Mutations for testing purposes, use reflect.DeepEqual.
 type Mutation struct {
@@ -151,6 +172,40 @@ func mapToMutationParams(in map[string]interface{}) ([]string, []interface{}) {
 	return cols, vals
 }
 
+// errEncodeColumn returns error for not being able to encode the value of a
+// named column.
+func errEncodeColumn(n string, err error) error {
+	se, ok := err.(*Error)
+	if !ok {
+		return wrapError(codes.InvalidArgument, "failed to encode column %q, error = <%v>", n, err)
+	}
+	se.decorate(fmt.Sprintf("failed to encode column %q", n))
+	return se
+}
+
+// CellsFromMap converts a map of column to value of a wide-column row into
+// aligned column names and encoded values. Each key is prefixed with family
+// following the family:column convention, the default family adds no prefix.
+// Columns are sorted by key so the result is deterministic.
+func CellsFromMap(family string, m map[string]interface{}) (cols []string, vals []*tspb.Value, err error) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	cols = make([]string, len(keys))
+	vals = make([]*tspb.Value, len(keys))
+	for i, k := range keys {
+		v, _, err := encodeValue(m[k])
+		if err != nil {
+			return nil, nil, errEncodeColumn(k, err)
+		}
+		cols[i] = getColumnName(family, k)
+		vals[i] = v
+	}
+	return cols, vals, nil
+}
+
 // errNotStruct returns error for not getting a go struct type.
 func errNotStruct(in interface{}) error {
 	return wrapError(codes.InvalidArgument, "%T is not a go struct type", in)
@@ -184,12 +239,146 @@ func structToMutationParams(in interface{}) ([]string, []interface{}, error) {
 	var cols []string
 	var vals []interface{}
 	for _, f := range fields {
+		if isRawField(&f) {
+			// The raw row is not a column.
+			continue
+		}
+		fv := v.FieldByIndex(f.Index)
 		cols = append(cols, f.Name)
-		vals = append(vals, v.FieldByIndex(f.Index).Interface())
+		if isNullableField(&f) && fv.Kind() == reflect.Ptr {
+			if fv.IsNil() {
+				vals = append(vals, ForceNull{fv.Interface()})
+			} else {
+				vals = append(vals, fv.Elem().Interface())
+			}
+			continue
+		}
+		vals = append(vals, fv.Interface())
 	}
 	return cols, vals, nil
 }
 
+// errUnencodableField returns error for a field of Go struct type t whose type
+// can't be encoded.
+func errUnencodableField(t reflect.Type, f *fields.Field, err error) error {
+	return wrapError(codes.InvalidArgument,
+		"field %v (column %q) of Go struct %v has type %v which cannot be encoded, error = <%v>",
+		t.FieldByIndex(f.Index).Name, f.Name, t, f.Type, err)
+}
+
+// ValidateEncodable returns error naming the first field of the Go struct in,
+// or of the struct in points to, whose type can't be encoded by the *Struct
+// mutations, so that a struct not matching the supported types is caught up
+// front, for example at startup, rather than on its first write. Fields of
+// interface type hold values of any type and are not checked.
+func ValidateEncodable(in interface{}) error {
+	t := reflect.TypeOf(in)
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return errNotStruct(in)
+	}
+	return checkEncodableStruct(t)
+}
+
+// checkEncodableStruct returns error for the first field of Go struct type t
+// whose type can't be encoded.
+func checkEncodableStruct(t reflect.Type) error {
+	fields, err := fieldCache.Fields(t)
+	if err != nil {
+		return err
+	}
+	for i := range fields {
+		f := &fields[i]
+		if isRawField(f) {
+			continue
+		}
+		ft := f.Type
+		if isNullableField(f) && ft.Kind() == reflect.Ptr {
+			// Written as the value it points to.
+			ft = ft.Elem()
+		}
+		if err := checkEncodableType(ft); err != nil {
+			return errUnencodableField(t, f, err)
+		}
+	}
+	return nil
+}
+
+// checkEncodableType returns error if values of type t can't be encoded. It
+// encodes a sample value of t, non-nil if t is a pointer, map, channel or
+// slice, as a nil tells little of its type.
+func checkEncodableType(t reflect.Type) error {
+	switch t {
+	case reflect.TypeOf(ForceNull{}), reflect.TypeOf([]GenericColumnValue(nil)):
+		// Their values carry the type.
+		return nil
+	}
+	if t.Kind() == reflect.Interface || t.Implements(reflect.TypeOf((*Encoder)(nil)).Elem()) {
+		return nil
+	}
+	if t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct {
+		t = t.Elem()
+	}
+	var sample reflect.Value
+	switch t.Kind() {
+	case reflect.Ptr:
+		sample = reflect.New(t.Elem())
+	case reflect.Map:
+		sample = reflect.MakeMap(t)
+	case reflect.Chan:
+		sample = reflect.MakeChan(t, 0)
+	case reflect.Slice:
+		sample = reflect.MakeSlice(t, 0, 0)
+	default:
+		sample = reflect.Zero(t)
+	}
+	_, _, err := encodeValue(sample.Interface())
+	if err != nil && t.Kind() == reflect.Struct {
+		// The zero value of a struct may be invalid, like that of
+		// netip.Prefix, or hold such fields, check the fields instead.
+		return checkEncodableStruct(t)
+	}
+	return err
+}
+
+// errMaskColNotFound returns error for a masked column missing from a struct.
+func errMaskColNotFound(n string, in interface{}) error {
+	return wrapError(codes.InvalidArgument, "masked column %q is not a field of %T", n, in)
+}
+
+// ColumnsAndValuesMasked converts Go struct s into mutation parameters like
+// the *Struct mutations do, but keeps only the columns named in mask, so an
+// Update touches only the columns which were explicitly set. Columns are
+// returned in field order, it is an error if mask names a column s doesn't
+// have. An empty mask returns no columns.
+func ColumnsAndValuesMasked(s interface{}, mask []string) ([]string, []interface{}, error) {
+	cols, vals, err := structToMutationParams(s)
+	if err != nil {
+		return nil, nil, err
+	}
+	masked := make(map[string]bool, len(mask))
+	for _, n := range mask {
+		masked[n] = true
+	}
+	var mcols []string
+	var mvals []interface{}
+	for i, c := range cols {
+		if masked[c] {
+			mcols = append(mcols, c)
+			mvals = append(mvals, vals[i])
+			delete(masked, c)
+		}
+	}
+	for _, n := range mask {
+		if masked[n] {
+			return nil, nil, errMaskColNotFound(n, s)
+		}
+	}
+	return mcols, mvals, nil
+}
+
 // Insert returns a Mutation to insert a row into a table. If the row already
 // exists, the write or transaction fails.
 func Insert(table string, cols []string, vals []interface{}) *Mutation {
@@ -215,6 +404,9 @@ func InsertMap(table string, in map[string]interface{}) *Mutation {
 // The in argument must be a struct or a pointer to a struct. Its exported
 // fields specify the column names and values. Use a field tag like "spanner:name"
 // to provide an alternative column name, or use "spanner:-" to ignore the field.
+// A pointer field tagged `column:"name,nullable"` is written as the value it
+// points to, or as a NULL of that type if it is nil, see ForceNull. Use
+// ValidateEncodable to check that all fields of a struct type can be encoded.
 func InsertStruct(table string, in interface{}) (*Mutation, error) {
 	cols, vals, err := structToMutationParams(in)
 	if err != nil {
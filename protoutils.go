@@ -195,3 +195,37 @@ func NullProto() *tspb.Value {
 func nullProto() *tspb.Value {
 	return &tspb.Value{Kind: &tspb.Value_NullValue{NullValue: tspb.NullValue_NULL_VALUE}}
 }
+
+// IsNullValue reports whether v encodes a NULL value. A nil v is not NULL.
+func IsNullValue(v *tspb.Value) bool {
+	_, isNull := v.GetKind().(*tspb.Value_NullValue)
+	return isNull
+}
+
+// ValueKindName returns the name of the wire kind of v, such as "STRING",
+// "INTEGER", "NULL" or "LIST", for diagnostics. A nil v or one without a kind
+// is "UNSET".
+func ValueKindName(v *tspb.Value) string {
+	switch v.GetKind().(type) {
+	case *tspb.Value_NullValue:
+		return "NULL"
+	case *tspb.Value_NumberValue:
+		return "NUMBER"
+	case *tspb.Value_StringValue:
+		return "STRING"
+	case *tspb.Value_BoolValue:
+		return "BOOL"
+	case *tspb.Value_StructValue:
+		return "STRUCT"
+	case *tspb.Value_ListValue:
+		return "LIST"
+	case *tspb.Value_IntegerValue:
+		return "INTEGER"
+	case *tspb.Value_BytesValue:
+		return "BYTES"
+	case *tspb.Value_TimestampValue:
+		return "TIMESTAMP"
+	default:
+		return "UNSET"
+	}
+}
@@ -64,6 +64,15 @@ type RowIterator struct {
 	cancel       func()
 	err          error
 	rows         []*Row
+	// decodeOptions are inherited by the yielded rows.
+	decodeOptions *DecodeOptions
+}
+
+// SetDecodeOptions makes the rows yielded by r from now on decode with opts
+// in Column, ColumnByName, Columns and ToStruct, for example to render every
+// TIMESTAMP in a Location.
+func (r *RowIterator) SetDecodeOptions(opts DecodeOptions) {
+	r.decodeOptions = &opts
 }
 
 /*
@@ -92,6 +101,7 @@ func (r *RowIterator) Next() (*Row, error) {
 	if len(r.rows) > 0 {
 		row := r.rows[0]
 		r.rows = r.rows[1:] /* 返回第一个 */
+		row.decodeOptions = r.decodeOptions
 		return row, nil
 	}
 	if err := r.streamd.lastErr(); err != nil {
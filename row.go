@@ -14,9 +14,22 @@
 package zetta
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"hash"
+	"io"
 	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	"cloud.google.com/go/civil"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	anypb "github.com/golang/protobuf/ptypes/any"
 	tspb "github.com/zhihu/zetta-proto/pkg/tablestore"
 	"google.golang.org/grpc/codes"
 )
@@ -54,24 +67,51 @@ import (
 // Supported types and their corresponding Cloud Spanner column type(s) are:
 //
 //	*string(not NULL), *NullString - STRING
-//	*[]NullString - STRING ARRAY
-//	*[]byte - BYTES
-//	*[][]byte - BYTES ARRAY
+//	*[]NullString, *[]string - STRING ARRAY, BYTES ARRAY holding UTF-8
+//	*url.URL(not NULL), *NullURL - STRING
+//	**regexp.Regexp - STRING holding a pattern, compiled on decode, nil for NULL
+//	*json.RawMessage - STRING
+//	*NullJSON - STRING holding a JSON document, unmarshaled with encoding/json
+//	pointers to types with a Set(string) error method, such as flag.Value(not NULL) - STRING
+//	pointers to types implementing Decoder - any type, as the type decodes it
+//	*netip.Prefix(not NULL), *NullPrefix - STRING holding CIDR notation
+//	*SemVer(not NULL), *NullSemVer - STRING holding a semantic version such as "1.2.3-rc.1"
+//	*big.Rat(not NULL) - STRING holding a fraction such as "3/7"
+//	*NullNumeric - STRING holding a NUMERIC such as "123.456"
+//	*[]byte, *NullBytes - BYTES
+//	*[][]byte, *[]NullBytes - BYTES ARRAY
 //	*int64(not NULL), *NullInt64 - INT64
-//	*[]NullInt64 - INT64 ARRAY
+//	*[]NullInt64, *[]int64(no NULL elements) - INT64 ARRAY
+//	*uint64(not NULL), *NullUint64 - INT64 not below zero, negative values are rejected rather than reinterpreted
+//	pointers to other integer kinds, such as *int32 or a named enum type(not NULL) - INT64, see EnumValidator
+//	*time.Duration(not NULL), *NullDuration - INT64 holding nanoseconds
+//	*time.Duration(not NULL), *NullDuration - STRING holding a duration such as "1h30m"
+//	*[]NullDuration, *[]time.Duration(no NULL elements) - INT64 ARRAY holding nanoseconds
 //	*bool(not NULL), *NullBool - BOOL
 //	*[]NullBool - BOOL ARRAY
 //	*float64(not NULL), *NullFloat64 - FLOAT64
+//	*big.Float(not NULL) - FLOAT64 except NaN and ±Inf, see DecodeOptions.BigFloatPrec
 //	*[]NullFloat64 - FLOAT64 ARRAY
+//	*[]float32 - FLOAT64 ARRAY without NULL, rounded to float32 precision
 //	*time.Time(not NULL), *NullTime - TIMESTAMP
-//	*[]NullTime - TIMESTAMP ARRAY
+//	*[]NullTime, *[]time.Time(no NULL elements) - TIMESTAMP ARRAY
+//	*[]int64 - TIMESTAMP ARRAY as milliseconds since the Unix epoch, see DecodeOptions.TimestampsAsEpochMillis
 //	*Date(not NULL), *NullDate - DATE
 //	*[]NullDate - DATE ARRAY
+//	*some_go_struct(not NULL), **some_go_struct - STRUCT
 //	*[]*some_go_struct, *[]NullRow - STRUCT ARRAY
+//	*[][]*some_go_struct, *[][]some_go_struct(no NULL structs) - ARRAY of STRUCT ARRAY
+//	*[][]NullInt64, *[][]NullString, *[][]NullFloat64, *[][]NullBool - ARRAY of INT64/STRING/FLOAT64/BOOL ARRAY, NULL inner arrays are nil
+//	pointers to fixed size Go arrays, such as *[3]float64(not NULL) - ARRAY of exactly that many elements
 //	*GenericColumnValue - any Cloud Spanner type
+//	*[]GenericColumnValue - any ARRAY type
 //
 // For TIMESTAMP columns, returned time.Time object will be in UTC.
 //
+// A *big.Rat is decoded from the text of a STRING column with big.Rat.SetString
+// and encoded as a fraction like "3/7", it is not a decimal NUMERIC value. Use
+// NullNumeric for NUMERIC values, it is encoded with NumericString.
+//
 // To fetch an array of BYTES, pass a *[][]byte. To fetch an array of
 // (sub)rows, pass a *[]spanner.NullRow or a *[]*some_go_struct where
 // some_go_struct holds all information of the subrow, see spannr.Row.ToStruct
@@ -92,6 +132,9 @@ type Row struct {
 	vals        []*tspb.Value            // 列值
 	cells       []*tspb.Cell
 	primaryKeys []*tspb.Value
+	// decodeOptions, if set, are the options Column and ToStruct decode
+	// with, inherited from the RowIterator which yielded the row.
+	decodeOptions *DecodeOptions
 }
 
 // errNamesValuesMismatch returns error for when columnNames count is not equal
@@ -126,29 +169,143 @@ func NewRow(columnNames []string, columnValues []interface{}) (*Row, error) {
 	return &r, nil
 }
 
-// Size is the number of columns in the row.
+// errBadRowEncoding returns error for binary data that doesn't encode a Row.
+func errBadRowEncoding(err error) error {
+	return wrapError(codes.InvalidArgument, "cannot unmarshal row: <%v>", err)
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler, so rows can be cached
+// with encoding/gob. The columns, values and cells of the row are encoded as
+// a tspb.ResultSet holding the single row.
+func (r *Row) MarshalBinary() ([]byte, error) {
+	rs := &tspb.ResultSet{}
+	if r.fields != nil || r.vals != nil {
+		rs.Metadata = &tspb.ResultSetMetadata{RowType: &tspb.StructType{Fields: r.fields}}
+		rs.Rows = []*tspb.ListValue{{Values: r.vals}}
+	}
+	if r.cells != nil || r.primaryKeys != nil {
+		rs.SliceRows = []*tspb.SliceCell{{PrimaryKeys: r.primaryKeys, Cells: r.cells}}
+	}
+	return proto.Marshal(rs)
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler, it decodes data
+// produced by MarshalBinary into r.
+func (r *Row) UnmarshalBinary(data []byte) error {
+	rs := &tspb.ResultSet{}
+	if err := proto.Unmarshal(data, rs); err != nil {
+		return errBadRowEncoding(err)
+	}
+	if len(rs.Rows) > 1 || len(rs.SliceRows) > 1 {
+		return errBadRowEncoding(fmt.Errorf("got %d rows and %d slice rows, want at most one", len(rs.Rows), len(rs.SliceRows)))
+	}
+	*r = Row{fields: rs.GetMetadata().GetRowType().GetFields()}
+	if len(rs.Rows) == 1 {
+		r.vals = rs.Rows[0].Values
+	}
+	if len(rs.SliceRows) == 1 {
+		r.primaryKeys = rs.SliceRows[0].PrimaryKeys
+		r.cells = rs.SliceRows[0].Cells
+	}
+	if len(r.fields) != len(r.vals) {
+		return errFieldsMismatchVals(r)
+	}
+	return nil
+}
+
+// Size is the number of columns in the row, columns are indexed from 0 to
+// Size()-1 by ColumnName, ColumnType and Column.
 func (r *Row) Size() int {
+	if len(r.fields) == 0 {
+		return len(r.cells)
+	}
 	return len(r.fields)
 }
 
+// ColumnPair is a column name with its decoded value.
+type ColumnPair struct {
+	Name  string
+	Value interface{}
+}
+
+// ToOrderedPairs decodes every column of the row in schema order, so the row
+// can be serialized deterministically. Values are decoded into their natural
+// Go types: bool, int64, float64, string, []byte, time.Time, civil.Date or,
+// for ARRAY, an []interface{} of such elements. NULL values are nil.
+func (r *Row) ToOrderedPairs() ([]ColumnPair, error) {
+	if len(r.fields) == 0 {
+		pairs := make([]ColumnPair, len(r.cells))
+		for i, cell := range r.cells {
+			v, err := decodeInterface(cell.Value, cell.Type)
+			if err != nil {
+				return nil, errDecodeColumn(i, err)
+			}
+			pairs[i] = ColumnPair{Name: getColumnName(cell.Family, cell.Column), Value: v}
+		}
+		return pairs, nil
+	}
+	if len(r.vals) != len(r.fields) {
+		return nil, errFieldsMismatchVals(r)
+	}
+	pairs := make([]ColumnPair, len(r.fields))
+	for i, f := range r.fields {
+		v, err := decodeInterface(r.vals[i], f.Type)
+		if err != nil {
+			return nil, errDecodeColumn(i, err)
+		}
+		pairs[i] = ColumnPair{Name: f.Name, Value: v}
+	}
+	return pairs, nil
+}
+
 // 返回列名
 // ColumnName returns the name of column i, or empty string for invalid column.
 func (r *Row) ColumnName(i int) string {
+	if len(r.fields) != 0 {
+		if i < 0 || i >= len(r.fields) || r.fields[i] == nil {
+			return ""
+		}
+		return r.fields[i].Name
+	}
 	if i < 0 || i >= len(r.cells) {
 		return ""
 	}
 	return getColumnName(r.cells[i].Family, r.cells[i].Column)
 }
 
+// ColumnType returns the type of column i, or nil for invalid column.
+func (r *Row) ColumnType(i int) *tspb.Type {
+	if len(r.fields) != 0 {
+		if i < 0 || i >= len(r.fields) || r.fields[i] == nil {
+			return nil
+		}
+		return r.fields[i].Type
+	}
+	if i < 0 || i >= len(r.cells) {
+		return nil
+	}
+	return r.cells[i].Type
+}
+
 // 大小写敏感地返回列名索引
 // ColumnIndex returns the index of the column with the given name. The
 // comparison is case-sensitive.
 func (r *Row) ColumnIndex(name string) (int, error) {
 	found := false
 	var index int
-	for i, cell := range r.cells {
-		coln := getColumnName(cell.Family, cell.Column)
-		if name == coln {
+	n := len(r.cells)
+	if r.isResultRow() {
+		if len(r.vals) != len(r.fields) {
+			return 0, errFieldsMismatchVals(r)
+		}
+		n = len(r.fields)
+	}
+	for i := 0; i < n; i++ {
+		if r.isResultRow() && r.fields[i] == nil {
+			// The name of the column can't be told.
+			return 0, errNilColType(i)
+		}
+		if name == r.ColumnName(i) {
 			if found {
 				return 0, errDupColName(name)
 			}
@@ -166,9 +323,9 @@ func (r *Row) ColumnIndex(name string) (int, error) {
 // ColumnNames returns all column names of the row.
 func (r *Row) ColumnNames() []string {
 	var n []string
-	// for _, c := range r.fields {
-	// 	n = append(n, c.Name)
-	// }
+	for _, c := range r.fields {
+		n = append(n, c.Name)
+	}
 	for _, cell := range r.cells {
 		coln := getColumnName(cell.Family, cell.Column)
 		n = append(n, coln)
@@ -176,6 +333,124 @@ func (r *Row) ColumnNames() []string {
 	return n
 }
 
+// cloneValues returns a deep copy of vs, nil if vs is nil.
+func cloneValues(vs []*tspb.Value) []*tspb.Value {
+	if vs == nil {
+		return nil
+	}
+	c := make([]*tspb.Value, len(vs))
+	for i, v := range vs {
+		c[i] = proto.Clone(v).(*tspb.Value)
+	}
+	return c
+}
+
+// Clone returns a deep copy of the row which shares no memory with r, the
+// backing arrays of BYTES values included, so it stays valid after the
+// buffers r was decoded from are reused, as a stream may do.
+func (r *Row) Clone() *Row {
+	nr := &Row{
+		vals:          cloneValues(r.vals),
+		primaryKeys:   cloneValues(r.primaryKeys),
+		decodeOptions: r.decodeOptions,
+	}
+	if r.fields != nil {
+		nr.fields = make([]*tspb.StructType_Field, len(r.fields))
+		for i, f := range r.fields {
+			nr.fields[i] = proto.Clone(f).(*tspb.StructType_Field)
+		}
+	}
+	if r.cells != nil {
+		nr.cells = make([]*tspb.Cell, len(r.cells))
+		for i, cell := range r.cells {
+			nr.cells[i] = proto.Clone(cell).(*tspb.Cell)
+		}
+	}
+	return nr
+}
+
+// Rename returns a copy of the row with columns renamed by mapping, from old
+// to new names, so that ToStruct can match differently named Go fields.
+// Columns missing from mapping keep their names and values are shared with r.
+// It is an error for the renamed row to have duplicated column names.
+func (r *Row) Rename(mapping map[string]string) (*Row, error) {
+	nr := &Row{
+		fields:        make([]*tspb.StructType_Field, len(r.fields)),
+		vals:          r.vals,
+		cells:         make([]*tspb.Cell, len(r.cells)),
+		primaryKeys:   r.primaryKeys,
+		decodeOptions: r.decodeOptions,
+	}
+	seen := map[string]bool{}
+	for i, f := range r.fields {
+		name := f.Name
+		if n, ok := mapping[name]; ok {
+			name = n
+		}
+		if seen[name] {
+			return nil, errDupColName(name)
+		}
+		seen[name] = true
+		nr.fields[i] = &tspb.StructType_Field{Name: name, Type: f.Type}
+	}
+	seen = map[string]bool{}
+	for i, cell := range r.cells {
+		name := getColumnName(cell.Family, cell.Column)
+		nc := *cell
+		if n, ok := mapping[name]; ok {
+			name = n
+			nc.Family, nc.Column = "", n
+			if family, column, ok := split2(n, ":"); ok {
+				nc.Family, nc.Column = family, column
+			}
+		}
+		if seen[name] {
+			return nil, errDupColName(name)
+		}
+		seen[name] = true
+		nr.cells[i] = &nc
+	}
+	return nr, nil
+}
+
+// errSchemaMismatch returns error for columns not matching an expected schema.
+func errSchemaMismatch(mismatches []string) error {
+	return wrapError(codes.FailedPrecondition, "row doesn't match schema: %s", strings.Join(mismatches, "; "))
+}
+
+// ValidateSchema checks that every column named in expected is present in the
+// row with the expected type, so a result can be rejected up front instead of
+// failing column by column while decoding. All mismatches are reported in one
+// error, columns not in expected are ignored.
+func (r *Row) ValidateSchema(expected map[string]tspb.TypeCode) error {
+	actual := map[string]tspb.TypeCode{}
+	for _, f := range r.fields {
+		actual[f.Name] = f.Type.GetCode()
+	}
+	for _, cell := range r.cells {
+		actual[getColumnName(cell.Family, cell.Column)] = cell.Type.GetCode()
+	}
+	names := make([]string, 0, len(expected))
+	for name := range expected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var mismatches []string
+	for _, name := range names {
+		got, ok := actual[name]
+		switch {
+		case !ok:
+			mismatches = append(mismatches, fmt.Sprintf("column %q is missing, want %v", name, expected[name]))
+		case got != expected[name]:
+			mismatches = append(mismatches, fmt.Sprintf("column %q has type %v, want %v", name, got, expected[name]))
+		}
+	}
+	if len(mismatches) > 0 {
+		return errSchemaMismatch(mismatches)
+	}
+	return nil
+}
+
 // errColIdxOutOfRange returns error for requested column index is out of the
 // range of the target Row's columns.
 func errColIdxOutOfRange(i int, r *Row) error {
@@ -206,19 +481,42 @@ func errNilColType(i int) error {
 	return wrapError(codes.FailedPrecondition, "column(%v)'s type is nil", i)
 }
 
+// isResultRow reports whether r is a row of a result set, holding fields and
+// values, rather than a row of cells. A row with values but no fields is a
+// broken result set row.
+func (r *Row) isResultRow() bool {
+	return len(r.fields) != 0 || len(r.vals) != 0
+}
+
+// valueAt returns the value and type of the ith column, taken from the fields
+// and values of a result set row, or from the cells of a row of cells.
+func (r *Row) valueAt(i int) (*tspb.Value, *tspb.Type, error) {
+	if r.isResultRow() {
+		if len(r.vals) != len(r.fields) {
+			return nil, nil, errFieldsMismatchVals(r)
+		}
+		if i < 0 || i >= len(r.vals) {
+			return nil, nil, errColIdxOutOfRange(i, r)
+		}
+		if r.fields[i] == nil {
+			return nil, nil, errNilColType(i)
+		}
+		return r.vals[i], r.fields[i].Type, nil
+	}
+	if i < 0 || i >= len(r.cells) {
+		return nil, nil, errColIdxOutOfRange(i, r)
+	}
+	return r.cells[i].Value, r.cells[i].Type, nil
+}
+
 // 将 row 的第 i 行 decode 到 ptr 指针变量中
 // Column fetches the value from the ith column, decoding it into ptr.
 func (r *Row) Column(i int, ptr interface{}) error {
-	// if len(r.vals) != len(r.fields) {
-	// 	return errFieldsMismatchVals(r)
-	// }
-	if i < 0 || i >= len(r.cells) {
-		return errColIdxOutOfRange(i, r)
+	v, t, err := r.valueAt(i)
+	if err != nil {
+		return err
 	}
-	// if r.fields[i] == nil {
-	// 	return errNilColType(i)
-	// }
-	if err := decodeValue(r.cells[i].Value, r.cells[i].Type, ptr); err != nil {
+	if err := decodeValueWithOptions(v, t, ptr, r.decodeOptions); err != nil {
 		return errDecodeColumn(i, err)
 	}
 	return nil
@@ -245,6 +543,345 @@ func (r *Row) ColumnByName(name string, ptr interface{}) error {
 	return r.Column(index, ptr)
 }
 
+// errPathNotStruct returns error for a path segment which doesn't name a
+// STRUCT to descend into.
+func errPathNotStruct(path, prefix string, t *tspb.Type) error {
+	return wrapError(codes.InvalidArgument, "path %q: %q is %v, not a STRUCT", path, prefix, sqlTypeName(t))
+}
+
+// errPathFieldNotFound returns error for a path naming a field missing from a
+// STRUCT.
+func errPathFieldNotFound(path, prefix string) error {
+	return wrapError(codes.NotFound, "path %q: STRUCT field %q not found", path, prefix)
+}
+
+// ColumnPath fetches a field nested within STRUCT columns, addressed by a
+// dotted path such as "address.geo.lat", and decodes it into ptr. The first
+// segment names the column, the others the fields of nested STRUCTs, matched
+// exactly. The fields within a NULL STRUCT are NULL.
+func (r *Row) ColumnPath(path string, ptr interface{}) error {
+	segs := strings.Split(path, ".")
+	i, err := r.ColumnIndex(segs[0])
+	if err != nil {
+		return err
+	}
+	v, t, err := r.valueAt(i)
+	if err != nil {
+		return err
+	}
+	for n, seg := range segs[1:] {
+		prefix := strings.Join(segs[:n+1], ".")
+		if t.GetCode() != tspb.TypeCode_STRUCT {
+			return errPathNotStruct(path, prefix, t)
+		}
+		var x *tspb.ListValue
+		if !IsNullValue(v) {
+			if x, err = getListValue(v); err != nil {
+				return errDecodeColumn(i, err)
+			}
+		}
+		st := t.GetStructType()
+		j := -1
+		for k, f := range st.GetFields() {
+			if f.Name == seg {
+				j = k
+				break
+			}
+		}
+		if j < 0 {
+			return errPathFieldNotFound(path, prefix+"."+seg)
+		}
+		t = st.Fields[j].Type
+		if x == nil {
+			// Fields of a NULL STRUCT are NULL.
+			v = nullProto()
+			continue
+		}
+		if len(x.Values) != len(st.Fields) {
+			return errDecodeColumn(i, errStructValueCount(st, x))
+		}
+		v = x.Values[j]
+	}
+	return errDecodeColumn(i, decodeValueWithOptions(v, t, ptr, r.decodeOptions))
+}
+
+// ColumnAs fetches the value from the named column of r and returns it
+// decoded as a T, which may be any type accepted by Column, for example:
+//
+//	id, err := zetta.ColumnAs[int64](row, "id")
+//
+// The zero value of T is returned with the error on failure.
+func ColumnAs[T any](r *Row, name string) (T, error) {
+	var v T
+	if err := r.ColumnByName(name, &v); err != nil {
+		var zero T
+		return zero, err
+	}
+	return v, nil
+}
+
+// errUnknownEnumOrdinal returns error for an INT64 enum value without a label.
+func errUnknownEnumOrdinal(n string, ordinal int64) error {
+	return wrapError(codes.OutOfRange, "column %q holds unknown enum ordinal %d", n, ordinal)
+}
+
+// ColumnEnum fetches the INT64 value from the named column and returns its
+// label in labels. It is an error if the column is NULL or the ordinal has no
+// label.
+func (r *Row) ColumnEnum(name string, labels map[int64]string) (string, error) {
+	var ordinal int64
+	if err := r.ColumnByName(name, &ordinal); err != nil {
+		return "", err
+	}
+	label, ok := labels[ordinal]
+	if !ok {
+		return "", errUnknownEnumOrdinal(name, ordinal)
+	}
+	return label, nil
+}
+
+// ColumnReader returns a reader over the named BYTES column, for streaming
+// large values instead of copying them into a new []byte. The reader shares
+// the memory of the row's value, which must not be modified while it is read.
+// A NULL value reads as empty.
+func (r *Row) ColumnReader(name string) (io.Reader, error) {
+	i, err := r.ColumnIndex(name)
+	if err != nil {
+		return nil, err
+	}
+	v, t, err := r.valueAt(i)
+	if err != nil {
+		return nil, err
+	}
+	if IsNullValue(v) {
+		return bytes.NewReader(nil), nil
+	}
+	if code := t.GetCode(); code != tspb.TypeCode_BYTES {
+		return nil, errDecodeColumn(i, errTypeMismatch(code, false, (*io.Reader)(nil)))
+	}
+	b, err := getBytesValue(v)
+	if err != nil {
+		return nil, errDecodeColumn(i, err)
+	}
+	return bytes.NewReader(b), nil
+}
+
+// errBadProto returns error for a column not holding a valid serialized proto.
+func errBadProto(n string, msg proto.Message, err error) error {
+	return wrapError(codes.FailedPrecondition, "column %q doesn't hold a valid %T: <%v>", n, msg, err)
+}
+
+// ColumnBase64Proto fetches the named STRING column holding a proto serialized
+// in standard base64 encoding and unmarshals it into msg. It is an error if
+// the column is NULL.
+func (r *Row) ColumnBase64Proto(name string, msg proto.Message) error {
+	i, err := r.ColumnIndex(name)
+	if err != nil {
+		return err
+	}
+	v, t, err := r.valueAt(i)
+	if err != nil {
+		return err
+	}
+	var s string
+	if err := decodeValueWithOptions(v, t, &s, r.decodeOptions); err != nil {
+		return errDecodeColumn(i, err)
+	}
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return errDecodeColumn(i, errBadEncoding(v, err))
+	}
+	if err := proto.Unmarshal(b, msg); err != nil {
+		return errBadProto(name, msg, err)
+	}
+	return nil
+}
+
+// cellAt returns the ith column as a tspb.Cell, the cell itself for a row of
+// cells. For a result set row the cell is built from the field, with the
+// column named as the field and no family.
+func (r *Row) cellAt(i int) (*tspb.Cell, error) {
+	v, t, err := r.valueAt(i)
+	if err != nil {
+		return nil, err
+	}
+	if !r.isResultRow() {
+		return r.cells[i], nil
+	}
+	return &tspb.Cell{Column: r.fields[i].Name, Type: t, Value: v}, nil
+}
+
+// ColumnAsAny returns the named column wrapped in a google.protobuf.Any for
+// passing results through gRPC without decoding them. The Any holds the
+// tspb.Cell of the column, so it carries the column name and type along with
+// the value, and can be unpacked with ptypes.UnmarshalAny.
+func (r *Row) ColumnAsAny(name string) (*anypb.Any, error) {
+	i, err := r.ColumnIndex(name)
+	if err != nil {
+		return nil, err
+	}
+	cell, err := r.cellAt(i)
+	if err != nil {
+		return nil, err
+	}
+	a, err := ptypes.MarshalAny(cell)
+	if err != nil {
+		return nil, errDecodeColumn(i, wrapError(codes.Internal, "cannot marshal column %q into Any: <%v>", name, err))
+	}
+	return a, nil
+}
+
+// ColumnHex fetches the named BYTES column and returns it as a lowercase hex
+// string, for logging binary values. A NULL value is returned as "".
+func (r *Row) ColumnHex(name string) (string, error) {
+	var b []byte
+	if err := r.ColumnByName(name, &b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// ColumnBase64 is like ColumnHex, but returns the column in standard base64
+// encoding.
+func (r *Row) ColumnBase64(name string) (string, error) {
+	var b []byte
+	if err := r.ColumnByName(name, &b); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// ColumnDigest writes the named BYTES column into h, for checksumming large
+// blobs without copying them. It is an error if the column is NULL.
+func (r *Row) ColumnDigest(name string, h hash.Hash) error {
+	i, err := r.ColumnIndex(name)
+	if err != nil {
+		return err
+	}
+	var b []byte
+	if err := r.Column(i, &b); err != nil {
+		return err
+	}
+	if b == nil {
+		return errDecodeColumn(i, errDstNotForNull(h))
+	}
+	// Writing into a hash.Hash never returns an error.
+	h.Write(b)
+	return nil
+}
+
+// ColumnString fetches the named column of any type and returns its text
+// form for display, with null reporting whether it is NULL. Scalars are
+// formatted like ValueFromString parses them: STRING as is, BYTES in base64,
+// TIMESTAMP in RFC 3339 and DATE as YYYY-MM-DD. ARRAYs are formatted as
+// [a, b], with STRING elements quoted and NULL elements as NULL.
+func (r *Row) ColumnString(name string) (s string, null bool, err error) {
+	i, err := r.ColumnIndex(name)
+	if err != nil {
+		return "", false, err
+	}
+	v, t, err := r.valueAt(i)
+	if err != nil {
+		return "", false, err
+	}
+	if IsNullValue(v) {
+		return "", true, nil
+	}
+	x, err := decodeInterface(v, t)
+	if err != nil {
+		return "", false, errDecodeColumn(i, err)
+	}
+	return displayString(x, false), false, nil
+}
+
+// displayString formats x as returned by decodeInterface for ColumnString,
+// quoting strings within arrays.
+func displayString(x interface{}, quote bool) string {
+	switch v := x.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		if quote {
+			return strconv.Quote(v)
+		}
+		return v
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case []interface{}:
+		elems := make([]string, len(v))
+		for i, e := range v {
+			elems[i] = displayString(e, true)
+		}
+		return "[" + strings.Join(elems, ", ") + "]"
+	case GenericColumnValue:
+		return fmt.Sprint(v.Value)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// ColumnDateFromDays fetches the named INT64 column holding a number of days
+// since epoch, which may be negative, and returns the date it stands for.
+func (r *Row) ColumnDateFromDays(name string, epoch civil.Date) (civil.Date, error) {
+	var days int64
+	if err := r.ColumnByName(name, &days); err != nil {
+		return civil.Date{}, err
+	}
+	return epoch.AddDays(int(days)), nil
+}
+
+// errBadEpochUnit returns error for a unit epoch times can't be counted in.
+func errBadEpochUnit(unit time.Duration) error {
+	return wrapError(codes.InvalidArgument, "epoch time unit %v is not positive", unit)
+}
+
+// errEpochOverflow returns error for an epoch time out of the range of
+// time.Time in nanoseconds.
+func errEpochOverflow(x int64, unit time.Duration) error {
+	return wrapError(codes.OutOfRange, "%d units of %v since the Unix epoch overflows", x, unit)
+}
+
+// epochTime returns the time x units after the Unix epoch.
+func epochTime(x int64, unit time.Duration) (time.Time, error) {
+	switch {
+	case unit <= 0:
+		return time.Time{}, errBadEpochUnit(unit)
+	case time.Second%unit == 0:
+		per := int64(time.Second / unit)
+		return time.Unix(x/per, x%per*int64(unit)), nil
+	case unit%time.Second == 0:
+		m := int64(unit / time.Second)
+		if s := x * m; s/m == x {
+			return time.Unix(s, 0), nil
+		}
+	default:
+		if ns := x * int64(unit); ns/int64(unit) == x {
+			return time.Unix(0, ns), nil
+		}
+	}
+	return time.Time{}, errEpochOverflow(x, unit)
+}
+
+// ColumnEpochTime fetches the named INT64 column holding a time as a count of
+// unit since the Unix epoch, such as time.Second or time.Millisecond for
+// legacy epoch columns, and returns it as a time.Time in UTC, or in the
+// location of the decode options of the row.
+func (r *Row) ColumnEpochTime(name string, unit time.Duration) (time.Time, error) {
+	var x int64
+	if err := r.ColumnByName(name, &x); err != nil {
+		return time.Time{}, err
+	}
+	t, err := epochTime(x, unit)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return r.decodeOptions.inLocation(t.UTC()), nil
+}
+
 // errNumOfColValue returns error for providing wrong number of values to Columns.
 func errNumOfColValue(n int, r *Row) error {
 	return wrapError(codes.InvalidArgument,
@@ -260,12 +897,12 @@ func errNumOfColValue(n int, r *Row) error {
 // arguments must be equal to the number of columns. Pass nil to specify that a
 // column should be ignored.
 func (r *Row) Columns(ptrs ...interface{}) error {
-	if len(ptrs) != len(r.cells) {
+	if r.isResultRow() && len(r.vals) != len(r.fields) {
+		return errFieldsMismatchVals(r)
+	}
+	if len(ptrs) != r.Size() {
 		return errNumOfColValue(len(ptrs), r)
 	}
-	// if len(r.vals) != len(r.fields) {
-	// 	return errFieldsMismatchVals(r)
-	// }
 	for i, p := range ptrs {
 		if p == nil {
 			continue
@@ -287,20 +924,46 @@ func errToStructArgType(p interface{}) error {
 // ToStruct fetches the columns in a row into the fields of a struct.
 // The rules for mapping a row's columns into a struct's exported fields
 // are as the following:
-//   1. If a field has a `spanner: "column_name"` tag, then decode column
-//      'column_name' into the field. A special case is the `spanner: "-"`
-//      tag, which instructs ToStruct to ignore the field during decoding.
-//   2. Otherwise, if the name of a field matches the name of a column (ignoring case),
+//   1. If a field has a `column:"column_name"` tag, optionally with a
+//      `family:"family_name"` tag, then decode column 'column_name', or
+//      'family_name:column_name', into the field. A special case is the
+//      `column:"-"` tag, which instructs ToStruct to ignore the field during
+//      decoding.
+//   2. Otherwise, if a field has neither tag but a `spanner:"column_name"`
+//      tag, as on structs shared with Cloud Spanner, then decode column
+//      'column_name' into the field, or ignore it for `spanner:"-"`.
+//   3. Otherwise, if the name of a field matches the name of a column (ignoring case),
 //      decode the column into the field.
 //
 // The fields of the destination struct can be of any type that is acceptable
-// to (*spanner.Row).Column.
+// to (*spanner.Row).Column. A GenericColumnValue field captures the type and
+// value of its column as is, to be inspected or decoded later. A field of
+// type *tspb.ListValue or Row tagged `column:",raw"` receives a copy of the
+// raw values of the whole row instead of a column, for example to decode the
+// row again later.
 //
 // Slice and pointer fields will be set to nil if the source column
 // is NULL, and a non-nil value if the column is not NULL. To decode NULL
 // values of other types, use one of the spanner.Null* as the type of the
 // destination field.
+//
+// A field tagged `column:"name,default=value"` is set to value when its column
+// is NULL or absent from the row, for reading rows written before the column
+// existed. Defaults are supported for string, bool, integer and floating point
+// fields and for NullString, NullBool, NullInt64 and NullFloat64.
+//
+// If p implements PostDecoder, its PostDecode method is called once all
+// columns are decoded and its error is returned.
 func (r *Row) ToStruct(p interface{}) error {
+	if r.decodeOptions != nil {
+		return r.ToStructWithOptions(p, *r.decodeOptions)
+	}
+	return r.ToStructWithOptions(p, DecodeOptions{})
+}
+
+// ToStructWithOptions is like ToStruct, but decodes according to opts, for
+// example to map the columns with a different FieldCache.
+func (r *Row) ToStructWithOptions(p interface{}, opts DecodeOptions) error {
 	// Check if p is a pointer to a struct
 	if t := reflect.TypeOf(p); t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
 		return errToStructArgType(p)
@@ -309,13 +972,69 @@ func (r *Row) ToStruct(p interface{}) error {
 		return errFieldsMismatchVals(r)
 	}
 	// Call decodeStruct directly to decode the row as a typed proto.ListValue.
-	return decodeStruct(
+	return decodeStructWithOptions(
 		&tspb.StructType{Fields: r.fields},
 		&tspb.ListValue{Values: r.vals},
 		p,
+		&opts,
 	)
 }
 
+// errPositionalFieldCount returns error for a struct whose field count doesn't
+// match the column count of a row.
+func errPositionalFieldCount(p interface{}, nfields, ncols int) error {
+	return wrapError(codes.InvalidArgument,
+		"ToStructByPosition(): %T has %d fields but row has %d columns", p, nfields, ncols)
+}
+
+// ToStructByPosition is like ToStruct, but ignores column names: column k is
+// decoded into the kth exported field of the struct in declaration order,
+// which suits results whose column names are absent or unreliable. Fields
+// ignored with a `column:"-"` tag and raw row fields are skipped. The number
+// of fields must equal the number of columns. Like ToStruct, it decodes with
+// the options of the client or transaction that returned the row.
+func (r *Row) ToStructByPosition(p interface{}) error {
+	t := reflect.TypeOf(p)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return errToStructArgType(p)
+	}
+	if reflect.ValueOf(p).IsNil() {
+		return errNilDst(p)
+	}
+	fields, err := r.decodeOptions.fieldCache().Fields(t.Elem())
+	if err != nil {
+		return err
+	}
+	var index [][]int
+	for i := range fields {
+		if !isRawField(&fields[i]) {
+			index = append(index, fields[i].Index)
+		}
+	}
+	vals, types := r.vals, make([]*tspb.Type, len(r.fields))
+	for i, f := range r.fields {
+		types[i] = f.Type
+	}
+	if len(r.fields) == 0 {
+		vals, types = make([]*tspb.Value, len(r.cells)), make([]*tspb.Type, len(r.cells))
+		for i, cell := range r.cells {
+			vals[i], types[i] = cell.Value, cell.Type
+		}
+	} else if len(r.vals) != len(r.fields) {
+		return errFieldsMismatchVals(r)
+	}
+	if len(index) != len(vals) {
+		return errPositionalFieldCount(p, len(index), len(vals))
+	}
+	v := reflect.ValueOf(p).Elem()
+	for i := range vals {
+		if err := decodeValueWithOptions(vals[i], types[i], v.FieldByIndex(index[i]).Addr().Interface(), r.decodeOptions); err != nil {
+			return errDecodeColumn(i, err)
+		}
+	}
+	return nil
+}
+
 func (r *Row) ConvertToStruct(p interface{}) error {
 	// Check if p is a pointer to a struct
 	if t := reflect.TypeOf(p); t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
@@ -341,6 +1060,7 @@ func decodeCellStruct(cells []*tspb.Cell, ptr interface{}) error {
 		return err
 	}
 	seen := map[string]bool{}
+	decoded := map[string]bool{}
 	for i, f := range cells {
 		column := getColumnName(f.Family, f.Column)
 		if column == "" {
@@ -348,7 +1068,7 @@ func decodeCellStruct(cells []*tspb.Cell, ptr interface{}) error {
 
 		}
 		sf := fields.Match(column)
-		if sf == nil {
+		if sf == nil || isRawField(sf) {
 			return errNoOrDupGoField(ptr, column)
 		}
 		if seen[column] {
@@ -356,13 +1076,22 @@ func decodeCellStruct(cells []*tspb.Cell, ptr interface{}) error {
 			return errDupCellField(column, f)
 		}
 		// Try to decode a single field.
-		if err := decodeValue(f.Value, f.Type, v.FieldByIndex(sf.Index).Addr().Interface()); err != nil {
+		fv := v.FieldByIndex(sf.Index)
+		if hasFieldDefault(sf) && IsNullValue(f.Value) {
+			if err := setFieldDefault(fv, sf); err != nil {
+				return errDecodeCellField(f, column, err)
+			}
+		} else if err := decodeValue(f.Value, f.Type, fv.Addr().Interface()); err != nil {
 			return errDecodeCellField(f, column, err)
 		}
 		// Mark field f.Name as processed.
 		seen[column] = true
+		decoded[sf.Name] = true
 	}
-	return nil
+	if err := setAbsentFieldDefaults(v, fields, decoded); err != nil {
+		return err
+	}
+	return callPostDecoder(ptr)
 }
 
 func getColumnName(family, qualifier string) string {
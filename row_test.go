@@ -30,7 +30,13 @@ limitations under the License.
 package zetta
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"io"
 	"reflect"
 	"strconv"
 	"strings"
@@ -39,7 +45,9 @@ import (
 
 	"cloud.google.com/go/civil"
 	proto "github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
 	tspb "github.com/zhihu/zetta-proto/pkg/tablestore"
+	"google.golang.org/grpc/codes"
 )
 
 var (
@@ -152,6 +160,7 @@ var (
 		},
 		nil,
 		nil,
+		nil,
 	}
 )
 
@@ -300,6 +309,7 @@ func TestNilDst(t *testing.T) {
 				[]*tspb.Value{stringProto("value")},
 				nil,
 				nil,
+				nil,
 			},
 			nil,
 			errDecodeColumn(0, errNilDst(nil)),
@@ -314,6 +324,7 @@ func TestNilDst(t *testing.T) {
 				[]*tspb.Value{stringProto("value")},
 				nil,
 				nil,
+				nil,
 			},
 			(*string)(nil),
 			errDecodeColumn(0, errNilDst((*string)(nil))),
@@ -338,6 +349,7 @@ func TestNilDst(t *testing.T) {
 				)},
 				nil,
 				nil,
+				nil,
 			},
 			(*[]*struct {
 				Col1 int
@@ -502,6 +514,7 @@ func TestInvalidColumnRequest(t *testing.T) {
 					[]*tspb.Value{stringProto("value1"), stringProto("value2")},
 					nil,
 					nil,
+					nil,
 				}
 				return r.ColumnByName("Val", &s)
 			},
@@ -521,6 +534,7 @@ func TestInvalidColumnRequest(t *testing.T) {
 					[]*tspb.Value{stringProto("value1"), stringProto("value2")},
 					nil,
 					nil,
+					nil,
 				}
 				return r.ToStruct(s)
 			},
@@ -1716,6 +1730,130 @@ func TestToStruct(t *testing.T) {
 	}
 }
 
+// Test Row.ToStructWithOptions() with different tag conventions.
+func TestToStructWithFieldCache(t *testing.T) {
+	type user struct {
+		ID   int64  `spanner:"Id" column:"uid"`
+		Name string `spanner:"UserName" family:"info" column:"name"`
+	}
+	want := user{ID: 7, Name: "alice"}
+	for _, test := range []struct {
+		names []string
+		opts  DecodeOptions
+	}{
+		{[]string{"uid", "info:name"}, DecodeOptions{}},
+		{[]string{"uid", "info:name"}, DecodeOptions{FieldCache: NewFieldCache(ZettaTagParser)}},
+		{[]string{"Id", "UserName"}, DecodeOptions{FieldCache: NewFieldCache(SpannerTagParser)}},
+	} {
+		r, err := NewRow(test.names, []interface{}{want.ID, want.Name})
+		if err != nil {
+			t.Fatalf("NewRow(%v) returns error: %v", test.names, err)
+		}
+		var got user
+		if err := r.ToStructWithOptions(&got, test.opts); err != nil {
+			t.Errorf("ToStructWithOptions(%v) returns error: %v, want nil", test.names, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ToStructWithOptions(%v) = %+v, want %+v", test.names, got, want)
+		}
+	}
+	// By default zetta tags win over spanner tags.
+	r, err := NewRow([]string{"Id", "UserName"}, []interface{}{want.ID, want.Name})
+	if err != nil {
+		t.Fatalf("NewRow returns error: %v", err)
+	}
+	var got user
+	if err := r.ToStruct(&got); err == nil {
+		t.Errorf("ToStruct() with spanner column names returns nil, want error")
+	}
+}
+
+// Test that the default convention falls back to spanner tags for fields
+// without zetta tags.
+func TestToStructMixedTags(t *testing.T) {
+	type order struct {
+		ID      int64   `spanner:"OrderId" column:"oid"`
+		Buyer   string  `spanner:"BuyerName" family:"info" column:"buyer"`
+		Amount  float64 `spanner:"TotalAmount"`
+		Skipped string  `spanner:"-"`
+		Note    string
+	}
+	r, err := NewRow(
+		[]string{"oid", "info:buyer", "TotalAmount", "note"},
+		[]interface{}{int64(7), "alice", 9.5, "rush"},
+	)
+	if err != nil {
+		t.Fatalf("NewRow returns error: %v", err)
+	}
+	var got order
+	if err := r.ToStruct(&got); err != nil {
+		t.Fatalf("ToStruct() returns error: %v", err)
+	}
+	if want := (order{ID: 7, Buyer: "alice", Amount: 9.5, Note: "rush"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("ToStruct() = %+v, want %+v", got, want)
+	}
+	for _, name := range []string{"OrderId", "Skipped"} {
+		r, err := NewRow([]string{name}, []interface{}{int64(1)})
+		if err != nil {
+			t.Fatalf("NewRow(%v) returns error: %v", name, err)
+		}
+		if err := r.ToStruct(&got); err == nil {
+			t.Errorf("ToStruct() with column %v returns nil, want error", name)
+		}
+	}
+}
+
+// Test that invalidating a FieldCache re-parses the tags of a struct type.
+func TestFieldCacheInvalidate(t *testing.T) {
+	type user struct {
+		ID int64 `column:"uid" legacy:"user_id"`
+	}
+	tag := "column"
+	parser := func(st reflect.StructTag) (string, bool, interface{}, error) {
+		return st.Get(tag), true, nil, nil
+	}
+	fc := NewFieldCache(parser)
+	decode := func(name string) (user, error) {
+		r, err := NewRow([]string{name}, []interface{}{int64(7)})
+		if err != nil {
+			t.Fatalf("NewRow(%v) returns error: %v", name, err)
+		}
+		var u user
+		err = r.ToStructWithOptions(&u, DecodeOptions{FieldCache: fc})
+		return u, err
+	}
+	if u, err := decode("uid"); err != nil || u.ID != 7 {
+		t.Fatalf("decoding uid = %+v, %v, want ID 7", u, err)
+	}
+	// The stale mapping is served until the type is invalidated.
+	tag = "legacy"
+	if _, err := decode("user_id"); err == nil {
+		t.Errorf("decoding user_id with a stale mapping returns nil, want error")
+	}
+	fc.Invalidate(reflect.TypeOf(user{}))
+	if u, err := decode("user_id"); err != nil || u.ID != 7 {
+		t.Errorf("decoding user_id after Invalidate = %+v, %v, want ID 7", u, err)
+	}
+	tag = "column"
+	fc.Clear()
+	if u, err := decode("uid"); err != nil || u.ID != 7 {
+		t.Errorf("decoding uid after Clear = %+v, %v, want ID 7", u, err)
+	}
+
+	// The package level cache parses the type again after being reset.
+	InvalidateFieldCache(reflect.TypeOf(user{}))
+	ClearFieldCache()
+	r, err := NewRow([]string{"uid"}, []interface{}{int64(7)})
+	if err != nil {
+		t.Fatalf("NewRow returns error: %v", err)
+	}
+	var u user
+	if err := r.ToStruct(&u); err != nil || u.ID != 7 {
+		t.Errorf("ToStruct() after ClearFieldCache = %+v, %v, want ID 7", u, err)
+	}
+}
+
 // Test helpers for getting column names.
 func TestColumnNameAndIndex(t *testing.T) {
 	// Test Row.Size().
@@ -1750,6 +1888,49 @@ func TestColumnNameAndIndex(t *testing.T) {
 	}
 }
 
+// Test iterating columns of result set and cell rows generically.
+func TestColumnType(t *testing.T) {
+	rr, err := NewRow([]string{"id", "name"}, []interface{}{int64(1), "a"})
+	if err != nil {
+		t.Fatalf("NewRow returns error: %v", err)
+	}
+	cr := newCellRow(t, []string{"info:id", "name"}, []interface{}{int64(1), "a"})
+	for _, test := range []struct {
+		desc  string
+		r     *Row
+		names []string
+	}{
+		{"result set row", rr, []string{"id", "name"}},
+		{"cell row", cr, []string{"info:id", "name"}},
+	} {
+		if got := test.r.Size(); got != 2 {
+			t.Errorf("%s: Size() = %d, want 2", test.desc, got)
+		}
+		if got := test.r.ColumnNames(); !reflect.DeepEqual(got, test.names) {
+			t.Errorf("%s: ColumnNames() = %v, want %v", test.desc, got, test.names)
+		}
+		for i, want := range []*tspb.Type{intType(), stringType()} {
+			if got := test.r.ColumnName(i); got != test.names[i] {
+				t.Errorf("%s: ColumnName(%d) = %q, want %q", test.desc, i, got, test.names[i])
+			}
+			if got := test.r.ColumnType(i); !proto.Equal(got, want) {
+				t.Errorf("%s: ColumnType(%d) = %v, want %v", test.desc, i, got, want)
+			}
+		}
+		for _, i := range []int{-1, 2} {
+			if got := test.r.ColumnName(i); got != "" {
+				t.Errorf("%s: ColumnName(%d) = %q, want empty", test.desc, i, got)
+			}
+			if got := test.r.ColumnType(i); got != nil {
+				t.Errorf("%s: ColumnType(%d) = %v, want nil", test.desc, i, got)
+			}
+		}
+	}
+	if got := (&Row{}).ColumnType(0); got != nil {
+		t.Errorf("empty_row.ColumnType(0) = %v, want nil", got)
+	}
+}
+
 func TestNewRow(t *testing.T) {
 	for _, test := range []struct {
 		names   []string
@@ -1794,8 +1975,1468 @@ func TestNewRow(t *testing.T) {
 				t.Fatalf("NewRow(%v,%v).err = %s, want %s", test.names, test.values, err, test.wantErr)
 			}
 			if !reflect.DeepEqual(got, test.want) {
-				t.Fatalf("NewRow(%v,%v) = %s, want %s", test.names, test.values, got, test.want)
+				t.Fatalf("NewRow(%v,%v) = %v, want %v", test.names, test.values, got, test.want)
 			}
 		})
 	}
 }
+
+// newCellRow returns a Row of cells named by names holding values.
+func newCellRow(t *testing.T, names []string, values []interface{}) *Row {
+	t.Helper()
+	r := &Row{}
+	for i := range values {
+		v, typ, err := encodeValue(values[i])
+		if err != nil {
+			t.Fatalf("encodeValue(%v) returns error: %v", values[i], err)
+		}
+		r.cells = append(r.cells, &tspb.Cell{Column: names[i], Type: typ, Value: v})
+	}
+	return r
+}
+
+func TestColumnEnum(t *testing.T) {
+	labels := map[int64]string{0: "RED", 1: "GREEN", 2: "BLUE"}
+	r := newCellRow(t, []string{"known", "unknown"}, []interface{}{int64(1), int64(7)})
+	got, err := r.ColumnEnum("known", labels)
+	if err != nil {
+		t.Fatalf("ColumnEnum(known) returns error: %v", err)
+	}
+	if got != "GREEN" {
+		t.Errorf("ColumnEnum(known) = %q, want %q", got, "GREEN")
+	}
+	if _, err := r.ColumnEnum("unknown", labels); err == nil {
+		t.Errorf("ColumnEnum(unknown) returns nil, want error")
+	} else if ErrCode(err) != codes.OutOfRange {
+		t.Errorf("ColumnEnum(unknown) returns error code %v, want %v", ErrCode(err), codes.OutOfRange)
+	}
+	if _, err := r.ColumnEnum("missing", labels); err == nil {
+		t.Errorf("ColumnEnum(missing) returns nil, want error")
+	}
+}
+
+func TestToStructPostDecode(t *testing.T) {
+	type user struct {
+		ID    int64  `column:"uid"`
+		Name  string `family:"info" column:"name"`
+		Email string `family:"info" column:"email"`
+	}
+	r, err := NewRow([]string{"uid", "info:name", "info:email"}, []interface{}{int64(7), "  alice ", "\talice@example.com\n"})
+	if err != nil {
+		t.Fatalf("NewRow returns error: %v", err)
+	}
+	var columns []string
+	trim := DecodeOptions{PostDecode: func(column string, v reflect.Value) error {
+		columns = append(columns, column)
+		if v.Kind() == reflect.String {
+			v.SetString(strings.TrimSpace(v.String()))
+		}
+		return nil
+	}}
+	var got user
+	if err := r.ToStructWithOptions(&got, trim); err != nil {
+		t.Fatalf("ToStructWithOptions returns error: %v", err)
+	}
+	if want := (user{ID: 7, Name: "alice", Email: "alice@example.com"}); got != want {
+		t.Errorf("ToStructWithOptions = %+v, want %+v", got, want)
+	}
+	if want := []string{"uid", "info:name", "info:email"}; !reflect.DeepEqual(columns, want) {
+		t.Errorf("PostDecode called for columns %v, want %v", columns, want)
+	}
+
+	// An error from the hook aborts decoding and names the column.
+	reject := DecodeOptions{PostDecode: func(column string, v reflect.Value) error {
+		if column == "info:name" {
+			return fmt.Errorf("rejected %q", v.String())
+		}
+		return nil
+	}}
+	err = r.ToStructWithOptions(&got, reject)
+	if err == nil {
+		t.Fatalf("ToStructWithOptions with rejecting hook returns nil, want error")
+	}
+	if !strings.Contains(err.Error(), "info:name") || !strings.Contains(err.Error(), "rejected") {
+		t.Errorf("ToStructWithOptions error %q lacks column or hook context", err)
+	}
+}
+
+func TestDecodeErrorColumnAndSQLType(t *testing.T) {
+	type user struct {
+		ID   int64       `column:"uid"`
+		Name string      `column:"name"`
+		Tags []NullInt64 `column:"tags"`
+	}
+	for _, test := range []struct {
+		desc     string
+		decode   func(*user) error
+		column   string
+		sqlType  string
+		wantCode codes.Code
+	}{
+		{
+			"STRING into int64",
+			func(u *user) error {
+				r, err := NewRow([]string{"uid"}, []interface{}{"7"})
+				if err != nil {
+					t.Fatalf("NewRow returns error: %v", err)
+				}
+				return r.ToStruct(u)
+			},
+			"uid", "STRING", codes.InvalidArgument,
+		},
+		{
+			"bad ARRAY<INT64> element",
+			func(u *user) error {
+				r := &Row{
+					fields: []*tspb.StructType_Field{mkField("tags", listType(intType()))},
+					vals:   []*tspb.Value{listProto(intProto(1), boolProto(true))},
+				}
+				return r.ToStruct(u)
+			},
+			"tags", "INT64", codes.FailedPrecondition,
+		},
+		{
+			"cell of BOOL into string",
+			func(u *user) error {
+				return newCellRow(t, []string{"name"}, []interface{}{true}).ConvertToStruct(u)
+			},
+			"name", "BOOL", codes.InvalidArgument,
+		},
+	} {
+		var u user
+		err := test.decode(&u)
+		se, ok := err.(*Error)
+		if !ok {
+			t.Errorf("%s: got error %v, want *Error", test.desc, err)
+			continue
+		}
+		if se.ColumnName() != test.column || se.SQLType() != test.sqlType {
+			t.Errorf("%s: ColumnName(), SQLType() = %q, %q, want %q, %q",
+				test.desc, se.ColumnName(), se.SQLType(), test.column, test.sqlType)
+		}
+		if se.Code != test.wantCode {
+			t.Errorf("%s: error code = %v, want %v", test.desc, se.Code, test.wantCode)
+		}
+	}
+	if se := wrapError(codes.Internal, "not a decode error").(*Error); se.ColumnName() != "" || se.SQLType() != "" {
+		t.Errorf("plain error has ColumnName() = %q, SQLType() = %q, want empty", se.ColumnName(), se.SQLType())
+	}
+}
+
+func TestRename(t *testing.T) {
+	type user struct {
+		ID    int64  `column:"uid"`
+		Name  string `family:"info" column:"name"`
+		Score int64  `column:"score"`
+	}
+	r, err := NewRow([]string{"user_id", "user_name", "score"}, []interface{}{int64(7), "alice", int64(90)})
+	if err != nil {
+		t.Fatalf("NewRow returns error: %v", err)
+	}
+	nr, err := r.Rename(map[string]string{"user_id": "uid", "user_name": "info:name", "absent": "x"})
+	if err != nil {
+		t.Fatalf("Rename returns error: %v", err)
+	}
+	var got user
+	if err := nr.ToStruct(&got); err != nil {
+		t.Fatalf("ToStruct of renamed row returns error: %v", err)
+	}
+	if want := (user{ID: 7, Name: "alice", Score: 90}); got != want {
+		t.Errorf("ToStruct of renamed row = %+v, want %+v", got, want)
+	}
+	// The original row is untouched.
+	if err := r.ToStruct(&got); err == nil {
+		t.Errorf("ToStruct of original row succeeds, want error")
+	}
+
+	cr := newCellRow(t, []string{"user_id", "score"}, []interface{}{int64(7), int64(90)})
+	ncr, err := cr.Rename(map[string]string{"user_id": "info:uid"})
+	if err != nil {
+		t.Fatalf("Rename of cell row returns error: %v", err)
+	}
+	if got, want := ncr.ColumnNames(), []string{"info:uid", "score"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ColumnNames() of renamed cell row = %v, want %v", got, want)
+	}
+	if got, want := cr.ColumnNames(), []string{"user_id", "score"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ColumnNames() of original cell row = %v, want %v", got, want)
+	}
+
+	// Renaming must not create duplicated columns.
+	for _, mapping := range []map[string]string{
+		{"user_id": "score"},
+		{"user_id": "x", "user_name": "x"},
+	} {
+		if _, err := r.Rename(mapping); err == nil {
+			t.Errorf("Rename(%v) succeeds, want error", mapping)
+		}
+	}
+	if _, err := cr.Rename(map[string]string{"user_id": "score"}); err == nil {
+		t.Errorf("Rename of cell row into duplicated column succeeds, want error")
+	}
+}
+
+func TestRowGobRoundTrip(t *testing.T) {
+	names := []string{"s", "i", "f", "b", "bytes", "ts", "date", "null", "ints", "strs"}
+	values := []interface{}{
+		"alice",
+		int64(-7),
+		3.25,
+		true,
+		[]byte("raw"),
+		time.Date(2020, 5, 17, 8, 30, 0, 123, time.UTC),
+		civil.Date{Year: 2020, Month: 5, Day: 17},
+		NullString{},
+		[]NullInt64{{1, true}, {}},
+		[]string{"a", "b"},
+	}
+	sr, err := NewRow(names, values)
+	if err != nil {
+		t.Fatalf("NewRow returns error: %v", err)
+	}
+	cr := newCellRow(t, names, values)
+	cr.primaryKeys = []*tspb.Value{intProto(1)}
+
+	for _, in := range []*Row{sr, cr, {}} {
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(in); err != nil {
+			t.Fatalf("gob encoding of %v returns error: %v", in, err)
+		}
+		got := &Row{}
+		if err := gob.NewDecoder(&buf).Decode(got); err != nil {
+			t.Fatalf("gob decoding returns error: %v", err)
+		}
+		if !proto.Equal(&tspb.StructType{Fields: got.fields}, &tspb.StructType{Fields: in.fields}) ||
+			!proto.Equal(&tspb.ListValue{Values: got.vals}, &tspb.ListValue{Values: in.vals}) ||
+			!proto.Equal(&tspb.SliceCell{PrimaryKeys: got.primaryKeys, Cells: got.cells},
+				&tspb.SliceCell{PrimaryKeys: in.primaryKeys, Cells: in.cells}) {
+			t.Errorf("gob round trip of %+v = %+v", in, got)
+		}
+	}
+
+	if err := (&Row{}).UnmarshalBinary([]byte("not a row")); err == nil {
+		t.Errorf("UnmarshalBinary of garbage succeeds, want error")
+	}
+}
+
+func TestColumnDateFromDays(t *testing.T) {
+	unixEpoch := civil.Date{Year: 1970, Month: 1, Day: 1}
+	r := newCellRow(t, []string{"zero", "pos", "neg", "leap", "str"},
+		[]interface{}{int64(0), int64(18399), int64(-1), int64(60), "10"})
+	for _, test := range []struct {
+		name  string
+		epoch civil.Date
+		want  civil.Date
+	}{
+		{"zero", unixEpoch, unixEpoch},
+		{"pos", unixEpoch, civil.Date{Year: 2020, Month: 5, Day: 17}},
+		{"neg", unixEpoch, civil.Date{Year: 1969, Month: 12, Day: 31}},
+		{"leap", civil.Date{Year: 2000, Month: 1, Day: 1}, civil.Date{Year: 2000, Month: 3, Day: 1}},
+		{"neg", civil.Date{Year: 2000, Month: 3, Day: 1}, civil.Date{Year: 2000, Month: 2, Day: 29}},
+	} {
+		got, err := r.ColumnDateFromDays(test.name, test.epoch)
+		if err != nil {
+			t.Errorf("ColumnDateFromDays(%q, %v) returns error: %v", test.name, test.epoch, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ColumnDateFromDays(%q, %v) = %v, want %v", test.name, test.epoch, got, test.want)
+		}
+	}
+	for _, name := range []string{"str", "missing"} {
+		if _, err := r.ColumnDateFromDays(name, unixEpoch); err == nil {
+			t.Errorf("ColumnDateFromDays(%q) returns nil, want error", name)
+		}
+	}
+}
+
+func TestToStructStrictUnexported(t *testing.T) {
+	type user struct {
+		ID   int64  `column:"uid"`
+		name string `family:"info" column:"name"`
+		Age  int64
+	}
+	r, err := NewRow([]string{"uid", "info:name"}, []interface{}{int64(7), "alice"})
+	if err != nil {
+		t.Fatalf("NewRow returns error: %v", err)
+	}
+	var u user
+	err = r.ToStructWithOptions(&u, DecodeOptions{StrictUnexported: true})
+	if err == nil {
+		t.Fatalf("ToStructWithOptions with unexported field returns nil, want error")
+	}
+	if desc := ErrDesc(err); !strings.Contains(desc, `"info:name"`) || !strings.Contains(desc, "unexported field name ") {
+		t.Errorf("ToStructWithOptions error %q doesn't name column and field", err)
+	}
+	if u.ID != 0 {
+		t.Errorf("ToStructWithOptions decoded %+v before reporting the unexported field", u)
+	}
+	// The default mode only reports the column as unknown.
+	if err := r.ToStruct(&u); err == nil || strings.Contains(err.Error(), "unexported") {
+		t.Errorf("ToStruct error = %v, want error for unknown column", err)
+	}
+
+	// Columns matching exported fields, including by the field name, pass.
+	r, err = NewRow([]string{"uid", "age"}, []interface{}{int64(7), int64(30)})
+	if err != nil {
+		t.Fatalf("NewRow returns error: %v", err)
+	}
+	if err := r.ToStructWithOptions(&u, DecodeOptions{StrictUnexported: true}); err != nil {
+		t.Errorf("ToStructWithOptions returns error: %v", err)
+	}
+	if u.ID != 7 || u.Age != 30 {
+		t.Errorf("ToStructWithOptions = %+v", u)
+	}
+}
+
+func TestToStructDuplicateColumnPolicy(t *testing.T) {
+	type user struct {
+		ID   int64  `column:"uid"`
+		Name string `column:"name"`
+	}
+	r, err := NewRow([]string{"name", "uid", "name"}, []interface{}{"first", int64(7), "last"})
+	if err != nil {
+		t.Fatalf("NewRow returns error: %v", err)
+	}
+	for _, test := range []struct {
+		policy DuplicateColumnPolicy
+		want   user
+		fail   bool
+	}{
+		{DuplicateColumnError, user{}, true},
+		{DuplicateColumnFirst, user{7, "first"}, false},
+		{DuplicateColumnLast, user{7, "last"}, false},
+	} {
+		var got user
+		err := r.ToStructWithOptions(&got, DecodeOptions{DuplicateColumnPolicy: test.policy})
+		if test.fail {
+			if err == nil {
+				t.Errorf("policy %v: ToStructWithOptions = %+v, want error", test.policy, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("policy %v: ToStructWithOptions returns error: %v", test.policy, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("policy %v: ToStructWithOptions = %+v, want %+v", test.policy, got, test.want)
+		}
+	}
+	// The default is to reject duplicates.
+	var got user
+	if err := r.ToStruct(&got); err == nil {
+		t.Errorf("ToStruct of row with duplicated columns returns nil, want error")
+	}
+}
+
+func TestColumnReader(t *testing.T) {
+	blob := bytes.Repeat([]byte("0123456789abcdef"), 64*1024)
+	r := newCellRow(t, []string{"blob", "empty", "null", "str"}, []interface{}{blob, []byte{}, []byte(nil), "text"})
+	rd, err := r.ColumnReader("blob")
+	if err != nil {
+		t.Fatalf("ColumnReader(blob) returns error: %v", err)
+	}
+	var got bytes.Buffer
+	if n, err := io.Copy(&got, rd); err != nil || n != int64(len(blob)) {
+		t.Fatalf("reading ColumnReader(blob) = %d, %v, want %d bytes", n, err, len(blob))
+	}
+	if !bytes.Equal(got.Bytes(), blob) {
+		t.Errorf("ColumnReader(blob) read different bytes")
+	}
+	for _, name := range []string{"empty", "null"} {
+		rd, err := r.ColumnReader(name)
+		if err != nil {
+			t.Fatalf("ColumnReader(%s) returns error: %v", name, err)
+		}
+		if b, err := io.ReadAll(rd); err != nil || len(b) != 0 {
+			t.Errorf("ColumnReader(%s) read %q, %v, want nothing", name, b, err)
+		}
+	}
+	for _, name := range []string{"str", "missing"} {
+		if _, err := r.ColumnReader(name); err == nil {
+			t.Errorf("ColumnReader(%s) returns nil, want error", name)
+		}
+	}
+}
+
+func TestColumnReaderResultRow(t *testing.T) {
+	blob := bytes.Repeat([]byte("0123456789abcdef"), 1024)
+	r, err := NewRow([]string{"blob", "null", "str"}, []interface{}{blob, NullBytes{}, "text"})
+	if err != nil {
+		t.Fatalf("NewRow returns error: %v", err)
+	}
+	rd, err := r.ColumnReader("blob")
+	if err != nil {
+		t.Fatalf("ColumnReader(blob) returns error: %v", err)
+	}
+	if got, err := io.ReadAll(rd); err != nil || !bytes.Equal(got, blob) {
+		t.Errorf("reading ColumnReader(blob) = %d bytes, %v, want %d bytes", len(got), err, len(blob))
+	}
+	rd, err = r.ColumnReader("null")
+	if err != nil {
+		t.Fatalf("ColumnReader(null) returns error: %v", err)
+	}
+	if got, err := io.ReadAll(rd); err != nil || len(got) != 0 {
+		t.Errorf("ColumnReader(null) read %q, %v, want nothing", got, err)
+	}
+	for _, name := range []string{"str", "missing"} {
+		if _, err := r.ColumnReader(name); err == nil {
+			t.Errorf("ColumnReader(%s) returns nil, want error", name)
+		}
+	}
+}
+
+func TestToStructRuntimeStructType(t *testing.T) {
+	r, err := NewRow([]string{"uid", "info:name"}, []interface{}{int64(7), "alice"})
+	if err != nil {
+		t.Fatalf("NewRow returns error: %v", err)
+	}
+	// Structurally different types built at runtime must not share cached
+	// fields, while identical ones are the same type.
+	defs := [][]reflect.StructField{
+		{
+			{Name: "ID", Type: reflect.TypeOf(int64(0)), Tag: `column:"uid"`},
+			{Name: "Name", Type: reflect.TypeOf(""), Tag: `family:"info" column:"name"`},
+		},
+		{
+			{Name: "Name", Type: reflect.TypeOf(NullString{}), Tag: `family:"info" column:"name"`},
+			{Name: "UID", Type: reflect.TypeOf(NullInt64{}), Tag: `column:"uid"`},
+		},
+		{
+			{Name: "ID", Type: reflect.TypeOf(int64(0)), Tag: `column:"uid"`},
+			{Name: "Name", Type: reflect.TypeOf(""), Tag: `family:"info" column:"name"`},
+		},
+	}
+	if reflect.StructOf(defs[0]) != reflect.StructOf(defs[2]) {
+		t.Errorf("identical runtime struct definitions yield different types")
+	}
+	for _, fields := range defs {
+		typ := reflect.StructOf(fields)
+		p := reflect.New(typ)
+		if err := r.ToStruct(p.Interface()); err != nil {
+			t.Errorf("ToStruct(%v) returns error: %v", typ, err)
+			continue
+		}
+		for _, f := range fields {
+			got := p.Elem().FieldByName(f.Name).Interface()
+			var want interface{}
+			switch got.(type) {
+			case int64:
+				want = int64(7)
+			case string:
+				want = "alice"
+			case NullInt64:
+				want = NullInt64{7, true}
+			case NullString:
+				want = NullString{"alice", true}
+			}
+			if got != want {
+				t.Errorf("ToStruct(%v) field %s = %v, want %v", typ, f.Name, got, want)
+			}
+		}
+	}
+}
+
+func TestValidateSchema(t *testing.T) {
+	r, err := NewRow([]string{"uid", "name", "score", "tags"},
+		[]interface{}{int64(7), "alice", 9.5, []string{"a"}})
+	if err != nil {
+		t.Fatalf("NewRow returns error: %v", err)
+	}
+	cr := newCellRow(t, []string{"uid", "info:name"}, []interface{}{int64(7), "alice"})
+
+	for _, test := range []struct {
+		r        *Row
+		expected map[string]tspb.TypeCode
+		wantErrs []string
+	}{
+		{r, map[string]tspb.TypeCode{"uid": tspb.TypeCode_INT64, "name": tspb.TypeCode_STRING,
+			"score": tspb.TypeCode_FLOAT64, "tags": tspb.TypeCode_ARRAY}, nil},
+		// Extra columns are ignored.
+		{r, map[string]tspb.TypeCode{"uid": tspb.TypeCode_INT64}, nil},
+		{cr, map[string]tspb.TypeCode{"uid": tspb.TypeCode_INT64, "info:name": tspb.TypeCode_STRING}, nil},
+		{r, map[string]tspb.TypeCode{"uid": tspb.TypeCode_STRING, "name": tspb.TypeCode_STRING,
+			"score": tspb.TypeCode_INT64, "email": tspb.TypeCode_STRING}, []string{
+			`column "email" is missing, want STRING`,
+			`column "score" has type FLOAT64, want INT64`,
+			`column "uid" has type INT64, want STRING`,
+		}},
+		{cr, map[string]tspb.TypeCode{"info:name": tspb.TypeCode_BYTES}, []string{
+			`column "info:name" has type STRING, want BYTES`,
+		}},
+	} {
+		err := test.r.ValidateSchema(test.expected)
+		if test.wantErrs == nil {
+			if err != nil {
+				t.Errorf("ValidateSchema(%v) returns error: %v", test.expected, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("ValidateSchema(%v) returns nil, want error", test.expected)
+			continue
+		}
+		if ErrCode(err) != codes.FailedPrecondition {
+			t.Errorf("ValidateSchema(%v) returns code %v, want %v", test.expected, ErrCode(err), codes.FailedPrecondition)
+		}
+		desc := ErrDesc(err)
+		for _, want := range test.wantErrs {
+			if !strings.Contains(desc, want) {
+				t.Errorf("ValidateSchema(%v) error %q doesn't report %q", test.expected, desc, want)
+			}
+		}
+	}
+}
+
+func TestColumnBase64Proto(t *testing.T) {
+	want := &tspb.Type{Code: tspb.TypeCode_ARRAY, ArrayElementType: &tspb.Type{Code: tspb.TypeCode_INT64}}
+	b, err := proto.Marshal(want)
+	if err != nil {
+		t.Fatalf("proto.Marshal(%v) returns error: %v", want, err)
+	}
+	r := newCellRow(t, []string{"valid", "notbase64", "notproto", "number"}, []interface{}{
+		base64.StdEncoding.EncodeToString(b),
+		"&&",
+		base64.StdEncoding.EncodeToString([]byte{0xff}),
+		int64(1),
+	})
+
+	got := &tspb.Type{}
+	if err := r.ColumnBase64Proto("valid", got); err != nil {
+		t.Fatalf("ColumnBase64Proto(valid) returns error: %v", err)
+	}
+	if !proto.Equal(got, want) {
+		t.Errorf("ColumnBase64Proto(valid) = %v, want %v", got, want)
+	}
+	for _, test := range []struct {
+		name     string
+		wantDesc string
+	}{
+		{"notbase64", "wasn't correctly encoded"},
+		{"notproto", "doesn't hold a valid *tablestore.Type"},
+		{"number", "decoding INT64"},
+		{"missing", "not found"},
+	} {
+		err := r.ColumnBase64Proto(test.name, &tspb.Type{})
+		if err == nil {
+			t.Errorf("ColumnBase64Proto(%v) returns nil, want error", test.name)
+			continue
+		}
+		if !strings.Contains(ErrDesc(err), test.wantDesc) {
+			t.Errorf("ColumnBase64Proto(%v) returns error %q, want it to contain %q", test.name, ErrDesc(err), test.wantDesc)
+		}
+	}
+}
+
+func TestToOrderedPairs(t *testing.T) {
+	ts := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	names := []string{"zeta", "alpha", "mid", "blob", "flags", "nothing", "born", "at"}
+	r, err := NewRow(names, []interface{}{
+		int64(1), "a", 2.5, []byte("b"), []NullBool{{Bool: true, Valid: true}, {}}, NullString{},
+		civil.Date{Year: 2020, Month: 1, Day: 2}, ts,
+	})
+	if err != nil {
+		t.Fatalf("NewRow returns error: %v", err)
+	}
+	// Dates and timestamps are decoded from their string forms.
+	r.vals[6] = stringProto("2020-01-02")
+	r.vals[7] = stringProto(ts.Format(time.RFC3339Nano))
+	got, err := r.ToOrderedPairs()
+	if err != nil {
+		t.Fatalf("ToOrderedPairs returns error: %v", err)
+	}
+	want := []ColumnPair{
+		{"zeta", int64(1)},
+		{"alpha", "a"},
+		{"mid", 2.5},
+		{"blob", []byte("b")},
+		{"flags", []interface{}{true, nil}},
+		{"nothing", nil},
+		{"born", civil.Date{Year: 2020, Month: 1, Day: 2}},
+		{"at", ts},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ToOrderedPairs = %v, want %v", got, want)
+	}
+
+	cr := newCellRow(t, []string{"b", "info:a"}, []interface{}{"x", int64(2)})
+	got, err = cr.ToOrderedPairs()
+	if err != nil {
+		t.Fatalf("ToOrderedPairs of cell row returns error: %v", err)
+	}
+	want = []ColumnPair{{"b", "x"}, {"info:a", int64(2)}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ToOrderedPairs of cell row = %v, want %v", got, want)
+	}
+}
+
+func TestColumnAs(t *testing.T) {
+	r := newCellRow(t, []string{"id", "name", "tags", "score"},
+		[]interface{}{int64(7), NullString{"alice", true}, []string{"a", "b"}, NullFloat64{}})
+	// NULLs read from the server carry their column type.
+	r.cells[3].Type = floatType()
+
+	id, err := ColumnAs[int64](r, "id")
+	if err != nil || id != 7 {
+		t.Errorf("ColumnAs[int64](id) = %v, %v, want 7, nil", id, err)
+	}
+	name, err := ColumnAs[NullString](r, "name")
+	if err != nil || name != (NullString{"alice", true}) {
+		t.Errorf("ColumnAs[NullString](name) = %v, %v, want alice, nil", name, err)
+	}
+	tags, err := ColumnAs[[]string](r, "tags")
+	if err != nil || !reflect.DeepEqual(tags, []string{"a", "b"}) {
+		t.Errorf("ColumnAs[[]string](tags) = %v, %v, want [a b], nil", tags, err)
+	}
+	score, err := ColumnAs[NullFloat64](r, "score")
+	if err != nil || score.Valid {
+		t.Errorf("ColumnAs[NullFloat64](score) = %v, %v, want NULL, nil", score, err)
+	}
+
+	// Mismatched types and missing columns return the zero value.
+	if got, err := ColumnAs[string](r, "id"); err == nil || got != "" {
+		t.Errorf("ColumnAs[string](id) = %q, %v, want zero value and error", got, err)
+	}
+	if got, err := ColumnAs[[]int64](r, "tags"); err == nil || got != nil {
+		t.Errorf("ColumnAs[[]int64](tags) = %v, %v, want nil and error", got, err)
+	}
+	if _, err := ColumnAs[int64](r, "missing"); ErrCode(err) != codes.NotFound {
+		t.Errorf("ColumnAs[int64](missing) returns error %v, want code %v", err, codes.NotFound)
+	}
+}
+
+func TestToStructGenericColumnValueField(t *testing.T) {
+	r, err := NewRow([]string{"ID", "Extra", "Tags", "Missing"},
+		[]interface{}{int64(7), "dynamic", []int64{1, 2}, nil})
+	if err != nil {
+		t.Fatalf("NewRow returns error: %v", err)
+	}
+	r.fields[3].Type = floatType()
+	var s struct {
+		ID      int64
+		Extra   GenericColumnValue
+		Tags    GenericColumnValue
+		Missing GenericColumnValue
+	}
+	if err := r.ToStruct(&s); err != nil {
+		t.Fatalf("ToStruct returns error: %v", err)
+	}
+	if s.ID != 7 {
+		t.Errorf("ToStruct ID = %v, want 7", s.ID)
+	}
+	for _, test := range []struct {
+		name string
+		got  GenericColumnValue
+		want GenericColumnValue
+	}{
+		{"Extra", s.Extra, GenericColumnValue{stringType(), stringProto("dynamic")}},
+		{"Tags", s.Tags, GenericColumnValue{listType(intType()), listProto(intProto(1), intProto(2))}},
+		{"Missing", s.Missing, GenericColumnValue{floatType(), nullProto()}},
+	} {
+		if !proto.Equal(test.got.Type, test.want.Type) || !proto.Equal(test.got.Value, test.want.Value) {
+			t.Errorf("ToStruct %v = %v, want %v", test.name, test.got, test.want)
+		}
+	}
+	var n int64
+	if err := s.Extra.Decode(&n); err == nil {
+		t.Errorf("decoding captured STRING into int64 returns nil, want error")
+	}
+	var str string
+	if err := s.Extra.Decode(&str); err != nil || str != "dynamic" {
+		t.Errorf("decoding captured STRING = %q, %v, want %q, nil", str, err, "dynamic")
+	}
+}
+
+func TestToStructFieldDefaults(t *testing.T) {
+	type settings struct {
+		Name    string      `column:"name,default=anonymous"`
+		Retries int32       `column:"retries,default=3"`
+		Enabled bool        `column:"enabled,default=true"`
+		Ratio   float64     `column:"ratio,default=0.5"`
+		Limit   NullInt64   `column:"limit,default=10"`
+		Plain   NullFloat64 `column:"plain"`
+	}
+	want := settings{"anonymous", 3, true, 0.5, NullInt64{10, true}, NullFloat64{}}
+
+	// NULL columns take the default.
+	r, err := NewRow(
+		[]string{"name", "retries", "enabled", "ratio", "limit", "plain"},
+		[]interface{}{nil, nil, nil, nil, nil, NullFloat64{}},
+	)
+	if err != nil {
+		t.Fatalf("NewRow returns error: %v", err)
+	}
+	// A NULL without a default still needs a type to be decoded.
+	r.fields[5].Type = floatType()
+	var got settings
+	if err := r.ToStruct(&got); err != nil {
+		t.Fatalf("ToStruct() with NULL columns returns error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ToStruct() with NULL columns = %+v, want %+v", got, want)
+	}
+
+	// Absent columns take the default, present ones keep their value.
+	r, err = NewRow([]string{"name", "plain"}, []interface{}{"bob", 1.5})
+	if err != nil {
+		t.Fatalf("NewRow returns error: %v", err)
+	}
+	got = settings{Retries: 9}
+	if err := r.ToStruct(&got); err != nil {
+		t.Fatalf("ToStruct() with absent columns returns error: %v", err)
+	}
+	want.Name, want.Plain = "bob", NullFloat64{1.5, true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ToStruct() with absent columns = %+v, want %+v", got, want)
+	}
+
+	// The default must suit the field.
+	type bad struct {
+		Count int8 `column:"count,default=300"`
+	}
+	r, err = NewRow([]string{"count"}, []interface{}{nil})
+	if err != nil {
+		t.Fatalf("NewRow returns error: %v", err)
+	}
+	if err := r.ToStruct(&bad{}); ErrCode(err) != codes.InvalidArgument {
+		t.Errorf("ToStruct() with an out of range default returns error %v, want code %v", err, codes.InvalidArgument)
+	}
+}
+
+func TestToStructRawField(t *testing.T) {
+	r, err := NewRow([]string{"ID", "Name"}, []interface{}{int64(7), "alice"})
+	if err != nil {
+		t.Fatalf("NewRow returns error: %v", err)
+	}
+	var s struct {
+		ID     int64
+		Name   string
+		Raw    *tspb.ListValue `column:",raw"`
+		RawRow Row             `column:",raw"`
+	}
+	if err := r.ToStruct(&s); err != nil {
+		t.Fatalf("ToStruct returns error: %v", err)
+	}
+	if s.ID != 7 || s.Name != "alice" {
+		t.Errorf("ToStruct = %v, %q, want 7, alice", s.ID, s.Name)
+	}
+	want := &tspb.ListValue{Values: []*tspb.Value{intProto(7), stringProto("alice")}}
+	if !proto.Equal(s.Raw, want) {
+		t.Errorf("ToStruct raw values = %v, want %v", s.Raw, want)
+	}
+	// The raw fields don't share memory with the source row.
+	r.vals[1].Kind = stringKind("bob")
+	r.fields[1].Name = "Nickname"
+	if !proto.Equal(s.Raw, want) {
+		t.Errorf("raw values = %v after changing the source row, want %v", s.Raw, want)
+	}
+	var again struct {
+		ID   int64
+		Name string
+	}
+	if err := s.RawRow.ToStruct(&again); err != nil {
+		t.Fatalf("ToStruct of raw row returns error: %v", err)
+	}
+	if again.ID != 7 || again.Name != "alice" {
+		t.Errorf("ToStruct of raw row = %v, %q, want 7, alice", again.ID, again.Name)
+	}
+
+	// The raw field is not a column.
+	m, err := InsertStruct("t", &s)
+	if err != nil {
+		t.Fatalf("InsertStruct returns error: %v", err)
+	}
+	if want := []string{"ID", "Name"}; !reflect.DeepEqual(m.columns, want) {
+		t.Errorf("InsertStruct columns = %v, want %v", m.columns, want)
+	}
+	raw, err := NewRow([]string{"Raw"}, []interface{}{"x"})
+	if err != nil {
+		t.Fatalf("NewRow returns error: %v", err)
+	}
+	if err := raw.ToStruct(&s); err == nil {
+		t.Errorf("ToStruct of a column named like the raw field returns nil, want error")
+	}
+
+	var bad struct {
+		ID  int64
+		Raw string `column:",raw"`
+	}
+	if err := r.ToStruct(&bad); ErrCode(err) != codes.InvalidArgument {
+		t.Errorf("ToStruct with a string raw field returns error %v, want code %v", err, codes.InvalidArgument)
+	}
+}
+
+func TestRowClone(t *testing.T) {
+	blob := []byte("payload")
+	r, err := NewRow([]string{"id", "blob"}, []interface{}{int64(1), blob})
+	if err != nil {
+		t.Fatalf("NewRow returns error: %v", err)
+	}
+	r.cells = []*tspb.Cell{
+		{Column: "id", Type: intType(), Value: intProto(1)},
+		{Column: "blob", Type: bytesType(), Value: bytesProto(blob)},
+	}
+	c := r.Clone()
+	if !reflect.DeepEqual(c, r) {
+		t.Fatalf("Clone() = %+v, want %+v", c, r)
+	}
+
+	// Reuse the byte buffers of the source, as decoding the next message of
+	// a stream into them would.
+	copy(r.vals[1].GetBytesValue(), "XXXXXXX")
+	copy(r.cells[1].Value.GetBytesValue(), "XXXXXXX")
+	r.vals[0].Kind = &tspb.Value_IntegerValue{IntegerValue: 2}
+
+	var got []byte
+	if err := c.ColumnByName("blob", &got); err != nil {
+		t.Fatalf("ColumnByName(blob) on clone returns error: %v", err)
+	}
+	if string(got) != "payload" {
+		t.Errorf("clone BYTES column = %q after reusing the source buffer, want %q", got, "payload")
+	}
+	var s struct {
+		ID   int64  `column:"id"`
+		Blob []byte `column:"blob"`
+	}
+	if err := c.ToStruct(&s); err != nil {
+		t.Fatalf("ToStruct() on clone returns error: %v", err)
+	}
+	if s.ID != 1 || string(s.Blob) != "payload" {
+		t.Errorf("ToStruct() on clone = %+v, want ID 1 and blob %q", s, "payload")
+	}
+}
+
+func TestColumnPath(t *testing.T) {
+	type geo struct {
+		Lat float64 `column:"lat"`
+		Lng float64 `column:"lng"`
+	}
+	type address struct {
+		City string `column:"city"`
+		Geo  *geo   `column:"geo"`
+	}
+	r := newCellRow(t, []string{"home", "work", "id"}, []interface{}{
+		address{"Beijing", &geo{39.9, 116.4}},
+		address{City: "Remote"},
+		int64(7),
+	})
+
+	var lat float64
+	if err := r.ColumnPath("home.geo.lat", &lat); err != nil || lat != 39.9 {
+		t.Errorf("ColumnPath(home.geo.lat) = %v, %v, want 39.9, nil", lat, err)
+	}
+	var city string
+	if err := r.ColumnPath("work.city", &city); err != nil || city != "Remote" {
+		t.Errorf("ColumnPath(work.city) = %q, %v, want \"Remote\", nil", city, err)
+	}
+	// The fields of a NULL STRUCT are NULL.
+	nlat := NullFloat64{1, true}
+	if err := r.ColumnPath("work.geo.lat", &nlat); err != nil || nlat.Valid {
+		t.Errorf("ColumnPath(work.geo.lat) = %v, %v, want NULL", nlat, err)
+	}
+
+	for _, test := range []struct {
+		path string
+		code codes.Code
+		desc string
+	}{
+		{"home.geo.alt", codes.NotFound, `STRUCT field "home.geo.alt" not found`},
+		{"home.city.name", codes.InvalidArgument, `"home.city" is STRING, not a STRUCT`},
+		{"id.x", codes.InvalidArgument, `"id" is INT64, not a STRUCT`},
+		{"office.city", codes.NotFound, `column "office" not found`},
+	} {
+		err := r.ColumnPath(test.path, &lat)
+		if ErrCode(err) != test.code || !strings.Contains(ErrDesc(err), test.desc) {
+			t.Errorf("ColumnPath(%q) returns error %v, want code %v and %q", test.path, err, test.code, test.desc)
+		}
+	}
+}
+
+func TestColumnPathResultRow(t *testing.T) {
+	type geo struct {
+		Lat float64 `column:"lat"`
+	}
+	type address struct {
+		City string `column:"city"`
+		Geo  *geo   `column:"geo"`
+	}
+	r, err := NewRow([]string{"home", "work"}, []interface{}{address{"Beijing", &geo{39.9}}, address{City: "Remote"}})
+	if err != nil {
+		t.Fatalf("NewRow returns error: %v", err)
+	}
+	var lat float64
+	if err := r.ColumnPath("home.geo.lat", &lat); err != nil || lat != 39.9 {
+		t.Errorf("ColumnPath(home.geo.lat) = %v, %v, want 39.9, nil", lat, err)
+	}
+	nlat := NullFloat64{1, true}
+	if err := r.ColumnPath("work.geo.lat", &nlat); err != nil || nlat.Valid {
+		t.Errorf("ColumnPath(work.geo.lat) = %v, %v, want NULL", nlat, err)
+	}
+	if err := r.ColumnPath("office.city", &lat); ErrCode(err) != codes.NotFound {
+		t.Errorf("ColumnPath(office.city) returns error %v, want code %v", err, codes.NotFound)
+	}
+	broken := &Row{fields: []*tspb.StructType_Field{mkField("home", intType())}}
+	if err := broken.ColumnPath("home.city", &lat); err == nil {
+		t.Errorf("ColumnPath(home.city) of row without values returns nil, want error")
+	}
+}
+
+func TestColumnEpochTime(t *testing.T) {
+	want := time.Date(2020, 6, 2, 9, 40, 47, 123000000, time.UTC)
+	r := newCellRow(t,
+		[]string{"secs", "millis", "micros", "nanos", "before", "name"},
+		[]interface{}{want.Unix(), want.UnixNano() / 1e6, want.UnixNano() / 1e3, want.UnixNano(), int64(-1500), "x"})
+	for _, test := range []struct {
+		name string
+		unit time.Duration
+		want time.Time
+	}{
+		{"secs", time.Second, want.Truncate(time.Second)},
+		{"millis", time.Millisecond, want},
+		{"micros", time.Microsecond, want},
+		{"nanos", time.Nanosecond, want},
+		{"before", time.Millisecond, time.Date(1969, 12, 31, 23, 59, 58, 500000000, time.UTC)},
+		{"secs", time.Hour, time.Unix(want.Unix()*3600, 0).UTC()},
+	} {
+		got, err := r.ColumnEpochTime(test.name, test.unit)
+		if err != nil {
+			t.Errorf("ColumnEpochTime(%q, %v) returns error: %v", test.name, test.unit, err)
+			continue
+		}
+		if !got.Equal(test.want) || got.Location() != time.UTC {
+			t.Errorf("ColumnEpochTime(%q, %v) = %v, want %v", test.name, test.unit, got, test.want)
+		}
+	}
+	if _, err := r.ColumnEpochTime("nanos", time.Hour); ErrCode(err) != codes.OutOfRange {
+		t.Errorf("ColumnEpochTime(nanos, hour) returns error %v, want code %v", err, codes.OutOfRange)
+	}
+	if _, err := r.ColumnEpochTime("secs", 0); ErrCode(err) != codes.InvalidArgument {
+		t.Errorf("ColumnEpochTime(secs, 0) returns error %v, want code %v", err, codes.InvalidArgument)
+	}
+	if _, err := r.ColumnEpochTime("name", time.Second); err == nil {
+		t.Errorf("ColumnEpochTime(name) of a STRING returns nil, want error")
+	}
+}
+
+func TestColumnDigest(t *testing.T) {
+	blob := bytes.Repeat([]byte("zetta"), 1000)
+	r := newCellRow(t, []string{"blob", "empty", "name"}, []interface{}{blob, []byte{}, "x"})
+	null := newCellRow(t, []string{"blob"}, []interface{}{nil})
+	null.cells[0].Type = bytesType()
+
+	for _, test := range []struct {
+		name string
+		want []byte
+	}{
+		{"blob", blob},
+		{"empty", nil},
+	} {
+		h := sha256.New()
+		if err := r.ColumnDigest(test.name, h); err != nil {
+			t.Fatalf("ColumnDigest(%q) returns error: %v", test.name, err)
+		}
+		want := sha256.Sum256(test.want)
+		if got := h.Sum(nil); !bytes.Equal(got, want[:]) {
+			t.Errorf("ColumnDigest(%q) = %x, want %x", test.name, got, want)
+		}
+	}
+	if err := null.ColumnDigest("blob", sha256.New()); ErrCode(err) != codes.InvalidArgument {
+		t.Errorf("ColumnDigest(NULL) returns error %v, want code %v", err, codes.InvalidArgument)
+	}
+	if err := r.ColumnDigest("name", sha256.New()); ErrCode(err) != codes.InvalidArgument {
+		t.Errorf("ColumnDigest(STRING) returns error %v, want code %v", err, codes.InvalidArgument)
+	}
+}
+
+func TestColumnAsAny(t *testing.T) {
+	r := newCellRow(t, []string{"tags", "score"}, []interface{}{[]string{"a", "b"}, 1.5})
+	a, err := r.ColumnAsAny("tags")
+	if err != nil {
+		t.Fatalf("ColumnAsAny(tags) returns error: %v", err)
+	}
+	var cell tspb.Cell
+	if err := ptypes.UnmarshalAny(a, &cell); err != nil {
+		t.Fatalf("UnmarshalAny(%v) returns error: %v", a, err)
+	}
+	if cell.Column != "tags" || !proto.Equal(cell.Type, listType(stringType())) {
+		t.Errorf("ColumnAsAny(tags) wraps column %q of type %v, want \"tags\" of type %v", cell.Column, cell.Type, listType(stringType()))
+	}
+	var got []string
+	if err := decodeValue(cell.Value, cell.Type, &got); err != nil {
+		t.Fatalf("decoding the unwrapped cell returns error: %v", err)
+	}
+	if want := []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ColumnAsAny(tags) round trips to %v, want %v", got, want)
+	}
+	if _, err := r.ColumnAsAny("missing"); ErrCode(err) != codes.NotFound {
+		t.Errorf("ColumnAsAny(missing) returns error %v, want code %v", err, codes.NotFound)
+	}
+}
+
+func TestColumnHexAndBase64(t *testing.T) {
+	data := []byte{0x00, 0xde, 0xad, 0xbe, 0xef, 'z'}
+	r := newCellRow(t, []string{"data", "empty", "null", "text"},
+		[]interface{}{data, []byte{}, []byte(nil), "x"})
+	r.cells[2].Type = bytesType()
+
+	for _, test := range []struct {
+		name     string
+		hex, b64 string
+	}{
+		{"data", hex.EncodeToString(data), base64.StdEncoding.EncodeToString(data)},
+		{"empty", "", ""},
+		{"null", "", ""},
+	} {
+		if got, err := r.ColumnHex(test.name); err != nil || got != test.hex {
+			t.Errorf("ColumnHex(%v) = %q, %v, want %q, nil", test.name, got, err, test.hex)
+		}
+		if got, err := r.ColumnBase64(test.name); err != nil || got != test.b64 {
+			t.Errorf("ColumnBase64(%v) = %q, %v, want %q, nil", test.name, got, err, test.b64)
+		}
+	}
+	if _, err := r.ColumnHex("text"); err == nil {
+		t.Errorf("ColumnHex(text) returns nil, want error")
+	}
+	if _, err := r.ColumnBase64("missing"); ErrCode(err) != codes.NotFound {
+		t.Errorf("ColumnBase64(missing) returns error %v, want code %v", err, codes.NotFound)
+	}
+}
+
+func TestColumnString(t *testing.T) {
+	ts := time.Date(2020, 1, 2, 3, 4, 5, 600, time.UTC)
+	r := newCellRow(t,
+		[]string{"s", "i", "f", "b", "by", "d", "ts", "strs", "ints", "null", "nullarr"},
+		[]interface{}{"a b", int64(-3), 2.5, true, []byte{1, 2}, civil.Date{Year: 2020, Month: 1, Day: 2}, ts,
+			[]NullString{{"x", true}, {}, {`"q"`, true}}, []int64{1, 2}, NullString{}, []NullInt64(nil)})
+	// Dates and timestamps are read in their string forms, NULLs with their
+	// types.
+	r.cells[5].Value = stringProto("2020-01-02")
+	r.cells[6].Value = stringProto(ts.Format(time.RFC3339Nano))
+	r.cells[9].Type = stringType()
+	r.cells[10].Type = listType(intType())
+
+	for _, test := range []struct {
+		name string
+		want string
+		null bool
+	}{
+		{"s", "a b", false},
+		{"i", "-3", false},
+		{"f", "2.5", false},
+		{"b", "true", false},
+		{"by", "AQI=", false},
+		{"d", "2020-01-02", false},
+		{"ts", "2020-01-02T03:04:05.0000006Z", false},
+		{"strs", `["x", NULL, "\"q\""]`, false},
+		{"ints", "[1, 2]", false},
+		{"null", "", true},
+		{"nullarr", "", true},
+	} {
+		got, null, err := r.ColumnString(test.name)
+		if err != nil {
+			t.Errorf("ColumnString(%v) returns error: %v", test.name, err)
+			continue
+		}
+		if got != test.want || null != test.null {
+			t.Errorf("ColumnString(%v) = %q, %v, want %q, %v", test.name, got, null, test.want, test.null)
+		}
+	}
+	if _, _, err := r.ColumnString("missing"); ErrCode(err) != codes.NotFound {
+		t.Errorf("ColumnString(missing) returns error %v, want code %v", err, codes.NotFound)
+	}
+}
+
+func TestToStructByPosition(t *testing.T) {
+	// Aggregations often have no useful column names.
+	r, err := NewRow([]string{"", "", "COUNT(*)"}, []interface{}{"a", 2.5, int64(3)})
+	if err != nil {
+		t.Fatalf("NewRow returns error: %v", err)
+	}
+	type stats struct {
+		Key     string
+		Ignored int64 `column:"-"`
+		Avg     float64
+		Count   int64 `column:"n"`
+	}
+	var got stats
+	if err := r.ToStructByPosition(&got); err != nil {
+		t.Fatalf("ToStructByPosition returns error: %v", err)
+	}
+	if want := (stats{Key: "a", Avg: 2.5, Count: 3}); got != want {
+		t.Errorf("ToStructByPosition = %+v, want %+v", got, want)
+	}
+
+	cr := newCellRow(t, []string{"x", "y", "z"}, []interface{}{"b", 1.5, int64(4)})
+	if err := cr.ToStructByPosition(&got); err != nil {
+		t.Fatalf("ToStructByPosition of cell row returns error: %v", err)
+	}
+	if want := (stats{Key: "b", Avg: 1.5, Count: 4}); got != want {
+		t.Errorf("ToStructByPosition of cell row = %+v, want %+v", got, want)
+	}
+
+	var short struct {
+		Key string
+		Avg float64
+	}
+	if err := r.ToStructByPosition(&short); ErrCode(err) != codes.InvalidArgument {
+		t.Errorf("ToStructByPosition with too few fields returns error %v, want code %v", err, codes.InvalidArgument)
+	}
+	var long struct {
+		Key   string
+		Avg   float64
+		Count int64
+		Extra int64
+	}
+	if err := r.ToStructByPosition(&long); ErrCode(err) != codes.InvalidArgument {
+		t.Errorf("ToStructByPosition with too many fields returns error %v, want code %v", err, codes.InvalidArgument)
+	}
+	var swapped struct {
+		Avg   float64
+		Key   string
+		Count int64
+	}
+	if err := r.ToStructByPosition(&swapped); err == nil {
+		t.Errorf("ToStructByPosition with mismatched field types returns nil, want error")
+	}
+	if err := r.ToStructByPosition(got); err == nil {
+		t.Errorf("ToStructByPosition(non pointer) returns nil, want error")
+	}
+
+	// The row's decode options apply, so FLOAT64 columns decode into
+	// integer fields with NumericCoercion.
+	var ints struct {
+		Key   string
+		Avg   int64
+		Count int64
+	}
+	fr, err := NewRow([]string{"", "", ""}, []interface{}{"c", 2.0, int64(5)})
+	if err != nil {
+		t.Fatalf("NewRow returns error: %v", err)
+	}
+	if err := fr.ToStructByPosition(&ints); err == nil {
+		t.Errorf("ToStructByPosition of FLOAT64 into int64 without options returns nil, want error")
+	}
+	fr.decodeOptions = &DecodeOptions{NumericCoercion: true}
+	if err := fr.ToStructByPosition(&ints); err != nil {
+		t.Fatalf("ToStructByPosition with NumericCoercion returns error: %v", err)
+	}
+	if ints.Key != "c" || ints.Avg != 2 || ints.Count != 5 {
+		t.Errorf("ToStructByPosition with NumericCoercion = %+v, want {c 2 5}", ints)
+	}
+}
+
+func TestDefaultDecodeLocation(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+	instants := []time.Time{
+		time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		time.Date(2020, 6, 1, 23, 0, 0, 0, time.FixedZone("", -5*3600)),
+		time.Date(1969, 12, 31, 23, 59, 59, 0, time.UTC),
+	}
+	names := []string{"a", "b", "c", "all"}
+	r := &Row{}
+	var elems []*tspb.Value
+	for i, ts := range instants {
+		v := stringProto(ts.Format(time.RFC3339Nano))
+		r.cells = append(r.cells, &tspb.Cell{Column: names[i], Type: timeType(), Value: v})
+		elems = append(elems, v)
+	}
+	r.cells = append(r.cells, &tspb.Cell{Column: "all", Type: listType(timeType()), Value: listProto(elems...)})
+
+	// Rows yielded by an iterator inherit its options.
+	iter := &RowIterator{rows: []*Row{r}}
+	iter.SetDecodeOptions(DecodeOptions{Location: loc})
+	row, err := iter.Next()
+	if err != nil {
+		t.Fatalf("Next returns error: %v", err)
+	}
+	for i, want := range instants {
+		var got time.Time
+		if err := row.ColumnByName(names[i], &got); err != nil {
+			t.Fatalf("ColumnByName(%v) returns error: %v", names[i], err)
+		}
+		if !got.Equal(want) || got.Location() != loc {
+			t.Errorf("ColumnByName(%v) = %v, want %v in %v", names[i], got, want, loc)
+		}
+		var nt NullTime
+		if err := row.ColumnByName(names[i], &nt); err != nil || !nt.Time.Equal(want) || nt.Time.Location() != loc {
+			t.Errorf("ColumnByName(%v) into NullTime = %v, %v, want %v in %v", names[i], nt, err, want, loc)
+		}
+	}
+	var all []time.Time
+	if err := row.ColumnByName("all", &all); err != nil {
+		t.Fatalf("ColumnByName(all) returns error: %v", err)
+	}
+	for i, got := range all {
+		if !got.Equal(instants[i]) || got.Location() != loc {
+			t.Errorf("ColumnByName(all)[%d] = %v, want %v in %v", i, got, instants[i], loc)
+		}
+	}
+
+	// Without options the offsets are kept as stored.
+	var got time.Time
+	plain := &Row{cells: r.cells}
+	if err := plain.ColumnByName("b", &got); err != nil {
+		t.Fatalf("ColumnByName(b) returns error: %v", err)
+	}
+	if _, offset := got.Zone(); offset != -5*3600 {
+		t.Errorf("ColumnByName(b) = %v, want the stored -05:00 offset", got)
+	}
+
+	// Transactions of a client pass its options on.
+	dc := &DataClient{decodeOptions: &DecodeOptions{Location: loc}}
+	if tx := dc.Single(); tx.txReadOnly.decodeOptions != dc.decodeOptions {
+		t.Errorf("Single() has decode options %v, want the client's", tx.txReadOnly.decodeOptions)
+	}
+	if tx := dc.ReadOnlyTransaction(); tx.txReadOnly.decodeOptions != dc.decodeOptions {
+		t.Errorf("ReadOnlyTransaction() has decode options %v, want the client's", tx.txReadOnly.decodeOptions)
+	}
+}
+
+func TestToStructRejectUnexpectedNull(t *testing.T) {
+	type account struct {
+		ID      int64
+		Name    string
+		Email   NullString
+		Balance float64
+		Active  bool
+	}
+	r, err := NewRow(
+		[]string{"ID", "Name", "Email", "Balance", "Active"},
+		[]interface{}{int64(7), NullString{}, NullString{}, NullFloat64{}, NullBool{}},
+	)
+	if err != nil {
+		t.Fatalf("NewRow returns error: %v", err)
+	}
+	r.fields[1].Type = stringType()
+	r.fields[2].Type = stringType()
+	r.fields[3].Type = floatType()
+	r.fields[4].Type = boolType()
+
+	// By default the first NULL fails the decoding.
+	var got account
+	err = r.ToStruct(&got)
+	if ErrCode(err) != codes.InvalidArgument || !strings.Contains(ErrDesc(err), "field Name") {
+		t.Errorf("ToStruct() returns error %v, want NULL in column Name", err)
+	}
+
+	got = account{}
+	err = r.ToStructWithOptions(&got, DecodeOptions{RejectUnexpectedNull: true})
+	if want := errUnexpectedNulls(&got, []string{"Name", "Balance", "Active"}); !reflect.DeepEqual(err, want) {
+		t.Errorf("ToStructWithOptions(RejectUnexpectedNull) returns error %v, want %v", err, want)
+	}
+	if got.ID != 7 || got.Email.Valid {
+		t.Errorf("ToStructWithOptions(RejectUnexpectedNull) decoded %+v, want the other columns decoded", got)
+	}
+
+	// Other errors are still reported right away.
+	r.fields[0].Type = stringType()
+	r.vals[0] = stringProto("seven")
+	err = r.ToStructWithOptions(&got, DecodeOptions{RejectUnexpectedNull: true})
+	if ErrCode(err) != codes.InvalidArgument || !strings.Contains(ErrDesc(err), "field ID") {
+		t.Errorf("ToStructWithOptions(RejectUnexpectedNull) with a type mismatch returns error %v, want it for column ID", err)
+	}
+}
+
+// Test ColumnByName on a row of a result set, which has fields and values
+// rather than cells.
+func TestColumnByNameResultRow(t *testing.T) {
+	r, err := NewRow([]string{"id", "name", "name"}, []interface{}{int64(7), "a", "b"})
+	if err != nil {
+		t.Fatalf("NewRow returns error: %v", err)
+	}
+	var id int64
+	if err := r.ColumnByName("id", &id); err != nil || id != 7 {
+		t.Errorf("ColumnByName(id) = %v, %v, want 7, nil", id, err)
+	}
+	var s string
+	if err := r.Column(2, &s); err != nil || s != "b" {
+		t.Errorf("Column(2) = %q, %v, want b, nil", s, err)
+	}
+	if got := r.ColumnName(1); got != "name" {
+		t.Errorf("ColumnName(1) = %q, want name", got)
+	}
+	if err := r.ColumnByName("missing", &s); !reflect.DeepEqual(err, errColNotFound("missing")) {
+		t.Errorf("ColumnByName(missing) returns error %v, want %v", err, errColNotFound("missing"))
+	}
+	if err := r.ColumnByName("name", &s); !reflect.DeepEqual(err, errDupColName("name")) {
+		t.Errorf("ColumnByName(name) returns error %v, want %v", err, errDupColName("name"))
+	}
+	if err := r.ColumnByName("id", &s); !reflect.DeepEqual(err, errDecodeColumn(0, errTypeMismatch(tspb.TypeCode_INT64, false, &s))) {
+		t.Errorf("ColumnByName(id, *string) returns error %v, want a type mismatch for column 0", err)
+	}
+	if err := r.Column(3, &s); !reflect.DeepEqual(err, errColIdxOutOfRange(3, r)) {
+		t.Errorf("Column(3) returns error %v, want %v", err, errColIdxOutOfRange(3, r))
+	}
+}
+
+func TestToStructProfiler(t *testing.T) {
+	type point struct {
+		X int64
+		Y int64
+	}
+	type shape struct {
+		Name   string
+		Center *point
+		Tags   []string
+	}
+	r, err := NewRow(
+		[]string{"Name", "Center", "Tags"},
+		[]interface{}{"dot", point{1, 2}, []string{"a", "b"}},
+	)
+	if err != nil {
+		t.Fatalf("NewRow returns error: %v", err)
+	}
+	var columns []string
+	opts := DecodeOptions{Profiler: func(column string, d time.Duration) {
+		if d < 0 {
+			t.Errorf("Profiler(%v) called with negative duration %v", column, d)
+		}
+		columns = append(columns, column)
+	}}
+	var got shape
+	if err := r.ToStructWithOptions(&got, opts); err != nil {
+		t.Fatalf("ToStructWithOptions(Profiler) returns error: %v", err)
+	}
+	// Nested fields come before the column holding them.
+	if want := []string{"Name", "X", "Y", "Center", "Tags"}; !reflect.DeepEqual(columns, want) {
+		t.Errorf("Profiler called for %v, want %v", columns, want)
+	}
+	if want := (shape{"dot", &point{1, 2}, []string{"a", "b"}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("ToStructWithOptions(Profiler) = %+v, want %+v", got, want)
+	}
+}
+
+// testRange rejects rows whose bounds are out of order once decoded.
+type testRange struct {
+	Low  int64 `column:"low"`
+	High int64 `column:"high"`
+}
+
+func (r *testRange) PostDecode() error {
+	if r.Low > r.High {
+		return fmt.Errorf("low %d above high %d", r.Low, r.High)
+	}
+	return nil
+}
+
+func TestToStructPostDecoder(t *testing.T) {
+	for _, test := range []struct {
+		low, high int64
+		wantErr   bool
+	}{
+		{1, 2, false},
+		{2, 2, false},
+		{3, 2, true},
+	} {
+		names, vals := []string{"low", "high"}, []interface{}{test.low, test.high}
+		r, err := NewRow(names, vals)
+		if err != nil {
+			t.Fatalf("NewRow returns error: %v", err)
+		}
+		for _, decode := range []struct {
+			desc string
+			f    func(interface{}) error
+		}{
+			{"ToStruct", r.ToStruct},
+			{"ConvertToStruct", newCellRow(t, names, vals).ConvertToStruct},
+		} {
+			var got testRange
+			err := decode.f(&got)
+			if test.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "low 3 above high 2") {
+					t.Errorf("%s of %v = %v, want PostDecode error", decode.desc, vals, err)
+				}
+				continue
+			}
+			if want := (testRange{test.low, test.high}); err != nil || got != want {
+				t.Errorf("%s of %v = %+v, %v, want %+v", decode.desc, vals, got, err, want)
+			}
+		}
+	}
+
+	// Nested STRUCT columns are checked too.
+	type outer struct {
+		Ranges []*testRange `column:"ranges"`
+	}
+	st := structType(mkField("low", intType()), mkField("high", intType()))
+	r, err := NewRow([]string{"ranges"}, []interface{}{GenericColumnValue{
+		Type:  listType(st),
+		Value: listProto(listProto(intProto(1), intProto(2)), listProto(intProto(5), intProto(4))),
+	}})
+	if err != nil {
+		t.Fatalf("NewRow returns error: %v", err)
+	}
+	var o outer
+	if err := r.ToStruct(&o); err == nil || !strings.Contains(err.Error(), "low 5 above high 4") {
+		t.Errorf("ToStruct of nested out of order range = %v, want PostDecode error", err)
+	}
+}
+
+// Test the named column accessors on result set rows, which hold fields and
+// values rather than cells.
+func TestColumnAccessorsResultRow(t *testing.T) {
+	msg := &tspb.Type{Code: tspb.TypeCode_ARRAY, ArrayElementType: &tspb.Type{Code: tspb.TypeCode_INT64}}
+	b, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatalf("proto.Marshal(%v) returns error: %v", msg, err)
+	}
+	r, err := NewRow([]string{"s", "tags", "null", "msg"},
+		[]interface{}{"x", []string{"a", "b"}, NullInt64{}, base64.StdEncoding.EncodeToString(b)})
+	if err != nil {
+		t.Fatalf("NewRow returns error: %v", err)
+	}
+
+	if got, null, err := r.ColumnString("s"); err != nil || got != "x" || null {
+		t.Errorf("ColumnString(s) = %q, %v, %v, want \"x\", false, nil", got, null, err)
+	}
+	if got, null, err := r.ColumnString("tags"); err != nil || got != `["a", "b"]` || null {
+		t.Errorf("ColumnString(tags) = %q, %v, %v, want [\"a\", \"b\"], false, nil", got, null, err)
+	}
+	if _, null, err := r.ColumnString("null"); err != nil || !null {
+		t.Errorf("ColumnString(null) = %v, %v, want NULL", null, err)
+	}
+
+	a, err := r.ColumnAsAny("tags")
+	if err != nil {
+		t.Fatalf("ColumnAsAny(tags) returns error: %v", err)
+	}
+	var cell tspb.Cell
+	if err := ptypes.UnmarshalAny(a, &cell); err != nil {
+		t.Fatalf("UnmarshalAny(%v) returns error: %v", a, err)
+	}
+	if want := (&tspb.Cell{Column: "tags", Type: listType(stringType()), Value: listProto(stringProto("a"), stringProto("b"))}); !proto.Equal(&cell, want) {
+		t.Errorf("ColumnAsAny(tags) wraps %v, want %v", &cell, want)
+	}
+
+	got := &tspb.Type{}
+	if err := r.ColumnBase64Proto("msg", got); err != nil || !proto.Equal(got, msg) {
+		t.Errorf("ColumnBase64Proto(msg) = %v, %v, want %v", got, err, msg)
+	}
+	if err := r.ColumnBase64Proto("s", got); err == nil {
+		t.Errorf("ColumnBase64Proto(s) returns nil, want error")
+	}
+
+	if _, _, err := r.ColumnString("missing"); ErrCode(err) != codes.NotFound {
+		t.Errorf("ColumnString(missing) returns error %v, want code %v", err, codes.NotFound)
+	}
+	if _, err := r.ColumnAsAny("missing"); ErrCode(err) != codes.NotFound {
+		t.Errorf("ColumnAsAny(missing) returns error %v, want code %v", err, codes.NotFound)
+	}
+	if err := r.ColumnBase64Proto("missing", got); ErrCode(err) != codes.NotFound {
+		t.Errorf("ColumnBase64Proto(missing) returns error %v, want code %v", err, codes.NotFound)
+	}
+
+	// Broken rows are reported rather than indexed out of range.
+	for _, br := range []*Row{
+		{fields: []*tspb.StructType_Field{}, vals: []*tspb.Value{stringProto("x")}},
+		{fields: []*tspb.StructType_Field{nil}, vals: []*tspb.Value{stringProto("x")}},
+		{fields: []*tspb.StructType_Field{mkField("s", stringType())}},
+	} {
+		if _, _, err := br.ColumnString("s"); err == nil {
+			t.Errorf("ColumnString(s) of broken row %v returns nil, want error", br)
+		}
+		if _, err := br.ColumnAsAny("s"); err == nil {
+			t.Errorf("ColumnAsAny(s) of broken row %v returns nil, want error", br)
+		}
+	}
+}
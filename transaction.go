@@ -37,6 +37,8 @@ type txReadEnv interface {
 type txReadOnly struct {
 	// read-transaction environment for performing transactional read operations.
 	txReadEnv
+	// decodeOptions are the default options of the rows read.
+	decodeOptions *DecodeOptions
 }
 
 // errSessionClosed returns error for using a recycled/destroyed session
@@ -88,7 +90,7 @@ func (t *txReadOnly) ReadUsingIndex(ctx context.Context, table, index string, ke
 		// Might happen if transaction is closed in the middle of a API call.
 		return &RowIterator{err: errSessionClosed(sh)}
 	}
-	return stream(
+	iter := stream(
 		ctx,
 		func(ctx context.Context, resumeToken []byte) (streamingReceiver, error) {
 			return client.StreamingRead(ctx,
@@ -104,6 +106,8 @@ func (t *txReadOnly) ReadUsingIndex(ctx context.Context, table, index string, ke
 		},
 		t.release,
 	)
+	iter.decodeOptions = t.decodeOptions
+	return iter
 }
 
 // errRowNotFound returns error for not being able to read the row identified by key.
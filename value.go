@@ -14,13 +14,24 @@
 package zetta
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"hash"
+	"hash/fnv"
 	"math"
+	"math/big"
+	"net/netip"
+	"net/url"
 	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"cloud.google.com/go/civil"
+	"github.com/gogo/protobuf/types"
 	"github.com/golang/protobuf/proto"
 	"github.com/sunxiaoguang/zetta-client-go/internal/fields"
 	tspb "github.com/zhihu/zetta-proto/pkg/tablestore"
@@ -44,6 +55,24 @@ func (n NullInt64) String() string {
 	return fmt.Sprintf("%v", n.Int64)
 }
 
+// NullUint64 represents a Cloud Spanner INT64 holding an unsigned integer
+// that may be NULL. INT64 is signed, so only values up to math.MaxInt64 are
+// stored: negative INT64 values can't be decoded into it, and encoding values
+// above math.MaxInt64 fails with codes.InvalidArgument rather than wrapping
+// them around.
+type NullUint64 struct {
+	Uint64 uint64
+	Valid  bool // Valid is true if Uint64 is not NULL.
+}
+
+// String implements Stringer.String for NullUint64
+func (n NullUint64) String() string {
+	if !n.Valid {
+		return fmt.Sprintf("%v", "<null>")
+	}
+	return fmt.Sprintf("%v", n.Uint64)
+}
+
 // NullString represents a Cloud Spanner STRING that may be NULL.
 type NullString struct {
 	StringVal string
@@ -114,6 +143,121 @@ func (n NullDate) String() string {
 	return fmt.Sprintf("%q", n.Date)
 }
 
+// NullURL represents a STRING holding an URL that may be NULL.
+type NullURL struct {
+	URL   url.URL
+	Valid bool // Valid is true if URL is not NULL.
+}
+
+// String implements Stringer.String for NullURL
+func (n NullURL) String() string {
+	if !n.Valid {
+		return fmt.Sprintf("%s", "<null>")
+	}
+	return fmt.Sprintf("%q", n.URL.String())
+}
+
+// NullPrefix represents a STRING holding an IP prefix in CIDR notation that
+// may be NULL.
+type NullPrefix struct {
+	Prefix netip.Prefix
+	Valid  bool // Valid is true if Prefix is not NULL.
+}
+
+// String implements Stringer.String for NullPrefix
+func (n NullPrefix) String() string {
+	if !n.Valid {
+		return fmt.Sprintf("%s", "<null>")
+	}
+	return fmt.Sprintf("%q", n.Prefix.String())
+}
+
+// NullDuration represents an INT64 holding a time.Duration in nanoseconds
+// that may be NULL.
+type NullDuration struct {
+	Duration time.Duration
+	Valid    bool // Valid is true if Duration is not NULL.
+}
+
+// String implements Stringer.String for NullDuration
+func (n NullDuration) String() string {
+	if !n.Valid {
+		return fmt.Sprintf("%s", "<null>")
+	}
+	return fmt.Sprintf("%v", n.Duration)
+}
+
+// NumericScaleDigits is the number of digits after the decimal point of a
+// NUMERIC value.
+const NumericScaleDigits = 9
+
+// NumericString returns the canonical decimal text of a NUMERIC value, r
+// rounded to NumericScaleDigits digits after the decimal point.
+func NumericString(r *big.Rat) string {
+	return r.FloatString(NumericScaleDigits)
+}
+
+// NullNumeric represents a NUMERIC value that may be NULL. Zetta carries
+// NUMERIC as the decimal text of a STRING column.
+type NullNumeric struct {
+	Numeric big.Rat
+	Valid   bool // Valid is true if Numeric is not NULL.
+}
+
+// String implements Stringer.String for NullNumeric
+func (n NullNumeric) String() string {
+	if !n.Valid {
+		return fmt.Sprintf("%s", "<null>")
+	}
+	return NumericString(&n.Numeric)
+}
+
+// NullJSON represents a STRING holding a JSON document that may be NULL. Value
+// is what encoding/json unmarshals the document into, or marshals it from.
+type NullJSON struct {
+	Value interface{}
+	Valid bool // Valid is true if Value is not NULL.
+}
+
+// String implements Stringer.String for NullJSON
+func (n NullJSON) String() string {
+	if !n.Valid {
+		return fmt.Sprintf("%s", "<null>")
+	}
+	b, err := json.Marshal(n.Value)
+	if err != nil {
+		return fmt.Sprintf("%v", n.Value)
+	}
+	return string(b)
+}
+
+// NullBytes represents a Cloud Spanner BYTES that may be NULL. Unlike a
+// []byte, it tells a NULL column from an empty one.
+type NullBytes struct {
+	Bytes []byte
+	Valid bool // Valid is true if Bytes is not NULL.
+}
+
+// String implements Stringer.String for NullBytes
+func (n NullBytes) String() string {
+	if !n.Valid {
+		return fmt.Sprintf("%s", "<null>")
+	}
+	return fmt.Sprintf("%q", n.Bytes)
+}
+
+// NullArray encodes a NULL ARRAY whose elements have type ElementType, so the
+// server can tell the type of the NULL, unlike a nil slice which encodes an
+// untyped NULL. ElementType must be a scalar type.
+type NullArray struct {
+	ElementType tspb.TypeCode
+}
+
+// String implements Stringer.String for NullArray
+func (n NullArray) String() string {
+	return fmt.Sprintf("%s", "<null>")
+}
+
 // NullRow represents a Cloud Spanner STRUCT that may be NULL.
 // See also the document for Row.
 // Note that NullRow is not a valid Cloud Spanner column Type.
@@ -122,6 +266,15 @@ type NullRow struct {
 	Valid bool // Valid is true if Row is not NULL.
 }
 
+// ToStruct decodes the STRUCT held by n into the Go struct ptr points to, as
+// Row.ToStruct does. It is an error if n is NULL.
+func (n NullRow) ToStruct(ptr interface{}) error {
+	if !n.Valid {
+		return errDstNotForNull(ptr)
+	}
+	return n.Row.ToStruct(ptr)
+}
+
 // 通用的字段类型和字段值，用于查询结果类型不可知的查询
 // GenericColumnValue represents the generic encoded value and type of the
 // column.  See google.spanner.v1.ResultSet proto for details.  This can be
@@ -139,6 +292,12 @@ func (v GenericColumnValue) Decode(ptr interface{}) error {
 	return decodeValue(v.Value, v.Type, ptr)
 }
 
+// DecodeWithOptions is like Decode, but decodes according to opts, for
+// example to allow numeric coercion.
+func (v GenericColumnValue) DecodeWithOptions(ptr interface{}, opts DecodeOptions) error {
+	return decodeValueWithOptions(v.Value, v.Type, ptr, &opts)
+}
+
 // NewGenericColumnValue creates a GenericColumnValue from Go value that is
 // valid for Cloud Spanner.
 func NewGenericColumnValue(v interface{}) (*GenericColumnValue, error) {
@@ -149,6 +308,16 @@ func NewGenericColumnValue(v interface{}) (*GenericColumnValue, error) {
 	return &GenericColumnValue{Value: value, Type: typ}, nil
 }
 
+// NewGenericColumnValueWithOptions is like NewGenericColumnValue, but encodes
+// v according to opts.
+func NewGenericColumnValueWithOptions(v interface{}, opts EncodeOptions) (*GenericColumnValue, error) {
+	value, typ, err := encodeValueWithOptions(v, &opts)
+	if err != nil {
+		return nil, err
+	}
+	return &GenericColumnValue{Value: value, Type: typ}, nil
+}
+
 // errTypeMismatch returns error for destination not having a compatible type
 // with source Cloud Spanner type.
 func errTypeMismatch(srcType tspb.TypeCode, isArray bool, dst interface{}) error {
@@ -174,6 +343,19 @@ func errNilDst(dst interface{}) error {
 	return wrapError(codes.InvalidArgument, "cannot decode into nil type %T", dst)
 }
 
+// isDstNotForNull returns true if err is the error of decoding a NULL value
+// into dst, which doesn't support NULL values.
+func isDstNotForNull(err error, dst interface{}) bool {
+	return ErrCode(err) == codes.InvalidArgument && ErrDesc(err) == ErrDesc(errDstNotForNull(dst))
+}
+
+// errUnexpectedNulls returns error for NULL columns decoded into fields of a
+// Go struct which can't hold NULL.
+func errUnexpectedNulls(ptr interface{}, columns []string) error {
+	return wrapError(codes.InvalidArgument,
+		"unexpected NULL in %d column(s) %q of Go struct %T", len(columns), columns, ptr)
+}
+
 // errNilArrElemType returns error for input Cloud Spanner data type being a array but without a
 // non-nil array element type.
 func errNilArrElemType(t *tspb.Type) error {
@@ -186,11 +368,65 @@ func errDstNotForNull(dst interface{}) error {
 	return wrapError(codes.InvalidArgument, "destination %T cannot support NULL SQL values", dst)
 }
 
+// errNonFiniteBigFloat returns error for decoding a NaN or infinite FLOAT64
+// into a big.Float.
+func errNonFiniteBigFloat(v *tspb.Value) error {
+	return wrapError(codes.OutOfRange, "%v is not a finite number and cannot be decoded into big.Float", v)
+}
+
 // errBadEncoding returns error for decoding wrongly encoded BYTES/INT64.
 func errBadEncoding(v *tspb.Value, err error) error {
 	return wrapError(codes.FailedPrecondition, "%v wasn't correctly encoded: <%v>", v, err)
 }
 
+// timestampLayouts are the layouts tried in order to parse a TIMESTAMP.
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	// Offsets without a colon, such as +0800.
+	"2006-01-02T15:04:05.999999999Z0700",
+}
+
+// parseTimestamp parses s as a TIMESTAMP in RFC 3339 format, tolerating
+// offsets without a colon and fractional seconds with more than nanosecond
+// precision, which are truncated. The error of the RFC 3339 layout is
+// returned if no layout matches.
+func parseTimestamp(s string) (time.Time, error) {
+	s = truncateFractionalSeconds(s)
+	var firstErr error
+	for _, layout := range timestampLayouts {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return t, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return time.Time{}, firstErr
+}
+
+// truncateFractionalSeconds drops the fractional second digits of timestamp
+// s beyond the ninth.
+func truncateFractionalSeconds(s string) string {
+	t := strings.IndexByte(s, 'T')
+	if t < 0 {
+		return s
+	}
+	dot := strings.IndexByte(s[t:], '.')
+	if dot < 0 {
+		return s
+	}
+	start := t + dot + 1
+	end := start
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		end++
+	}
+	if end-start <= 9 {
+		return s
+	}
+	return s[:start+9] + s[end:]
+}
+
 func parseNullTime(v *tspb.Value, p *NullTime, code tspb.TypeCode, isNull bool) error {
 	if p == nil {
 		return errNilDst(p)
@@ -206,7 +442,7 @@ func parseNullTime(v *tspb.Value, p *NullTime, code tspb.TypeCode, isNull bool)
 	if err != nil {
 		return err
 	}
-	y, err := time.Parse(time.RFC3339Nano, x)
+	y, err := parseTimestamp(x)
 	if err != nil {
 		return errBadEncoding(v, err)
 	}
@@ -220,12 +456,24 @@ func parseNullTime(v *tspb.Value, p *NullTime, code tspb.TypeCode, isNull bool)
 //
 // decodeValue decodes a protobuf Value into a pointer to a Go value, as specified by tspb.Type.
 func decodeValue(v *tspb.Value, t *tspb.Type, ptr interface{}) error {
+	return decodeValueWithOptions(v, t, ptr, nil)
+}
+
+// decodeValueWithOptions is decodeValue with the behavior tuned by opts, a nil
+// opts decodes with the defaults.
+func decodeValueWithOptions(v *tspb.Value, t *tspb.Type, ptr interface{}, opts *DecodeOptions) error {
 	if v == nil {
 		return errNilSrc()
 	}
 	if t == nil {
 		return errNilSpannerType()
 	}
+	if d, ok := ptr.(Decoder); ok {
+		if rv := reflect.ValueOf(ptr); rv.Kind() == reflect.Ptr && rv.IsNil() {
+			return errNilDst(ptr)
+		}
+		return d.DecodeSpanner(v, t)
+	}
 	code := t.Code
 
 	if t.Code == tspb.TypeCode_TYPE_CODE_UNSPECIFIED {
@@ -238,12 +486,16 @@ func decodeValue(v *tspb.Value, t *tspb.Type, ptr interface{}) error {
 		}
 		acode = t.ArrayElementType.Code
 	}
-	typeErr := errTypeMismatch(code, false, ptr)
-	if code == tspb.TypeCode_ARRAY {
-		typeErr = errTypeMismatch(acode, true, ptr)
+	// The errors are only built when needed, decoding large results must not
+	// pay for them on the success path.
+	typeErr := func() error {
+		if code == tspb.TypeCode_ARRAY {
+			return errTypeMismatch(acode, true, ptr)
+		}
+		return errTypeMismatch(code, false, ptr)
 	}
-	nullErr := errDstNotForNull(ptr)
-	_, isNull := v.Kind.(*tspb.Value_NullValue)
+	nullErr := func() error { return errDstNotForNull(ptr) }
+	isNull := IsNullValue(v)
 
 	// Do the decoding based on the type of ptr.
 	switch p := ptr.(type) {
@@ -254,10 +506,10 @@ func decodeValue(v *tspb.Value, t *tspb.Type, ptr interface{}) error {
 			return errNilDst(p)
 		}
 		if code != tspb.TypeCode_STRING {
-			return typeErr
+			return typeErr()
 		}
 		if isNull {
-			return nullErr
+			return nullErr()
 		}
 		x, err := getStringValue(v)
 		if err != nil {
@@ -269,7 +521,7 @@ func decodeValue(v *tspb.Value, t *tspb.Type, ptr interface{}) error {
 			return errNilDst(p)
 		}
 		if code != tspb.TypeCode_STRING {
-			return typeErr
+			return typeErr()
 		}
 		if isNull {
 			*p = NullString{}
@@ -285,8 +537,8 @@ func decodeValue(v *tspb.Value, t *tspb.Type, ptr interface{}) error {
 		if p == nil {
 			return errNilDst(p)
 		}
-		if acode != tspb.TypeCode_STRING {
-			return typeErr
+		if acode != tspb.TypeCode_STRING && acode != tspb.TypeCode_BYTES {
+			return typeErr()
 		}
 		if isNull {
 			*p = nil
@@ -296,287 +548,333 @@ func decodeValue(v *tspb.Value, t *tspb.Type, ptr interface{}) error {
 		if err != nil {
 			return err
 		}
-		y, err := decodeStringArray(x)
+		var y []NullString
+		if acode == tspb.TypeCode_BYTES {
+			y, err = decodeBytesAsStringArray(x)
+		} else {
+			y, err = decodeStringArray(x, opts)
+		}
 		if err != nil {
 			return err
 		}
 		*p = y
-	case *[]byte:
+	case *[]string:
 		if p == nil {
 			return errNilDst(p)
 		}
-		if code != tspb.TypeCode_BYTES {
-			return typeErr
+		if acode != tspb.TypeCode_STRING && acode != tspb.TypeCode_BYTES {
+			return typeErr()
 		}
 		if isNull {
 			*p = nil
 			break
 		}
-		x, err := getBytesValue(v)
+		x, err := getListValue(v)
 		if err != nil {
 			return err
 		}
-		*p = x
-	case *[][]byte:
+		var y []NullString
+		if acode == tspb.TypeCode_BYTES {
+			y, err = decodeBytesAsStringArray(x)
+		} else {
+			y, err = decodeStringArray(x, opts)
+		}
+		if err != nil {
+			return err
+		}
+		// NULL elements are decoded as empty strings.
+		a := make([]string, len(y))
+		for i := range y {
+			a[i] = y[i].StringVal
+		}
+		*p = a
+	case *json.RawMessage:
 		if p == nil {
 			return errNilDst(p)
 		}
-		if acode != tspb.TypeCode_BYTES {
-			return typeErr
+		if code != tspb.TypeCode_STRING {
+			return typeErr()
 		}
 		if isNull {
 			*p = nil
 			break
 		}
-		x, err := getListValue(v)
+		x, err := getStringValue(v)
 		if err != nil {
 			return err
 		}
-		y, err := decodeByteArray(x)
-		if err != nil {
-			return err
+		if opts.validatesJSON() && !json.Valid([]byte(x)) {
+			return errBadEncoding(v, fmt.Errorf("%q is not valid JSON", x))
 		}
-		*p = y
-	case *int64:
+		*p = json.RawMessage(x)
+	case *NullJSON:
 		if p == nil {
 			return errNilDst(p)
 		}
-		if code != tspb.TypeCode_INT64 {
-			return typeErr
+		if code != tspb.TypeCode_STRING {
+			return typeErr()
 		}
 		if isNull {
-			return nullErr
+			*p = NullJSON{}
+			break
 		}
-
-		x, err := getInteger64Value(v)
+		x, err := getStringValue(v)
 		if err != nil {
 			return err
 		}
-
-		*p = x
-	case *NullInt64:
+		var y interface{}
+		if err := json.Unmarshal([]byte(x), &y); err != nil {
+			return errBadEncoding(v, err)
+		}
+		p.Valid = true
+		p.Value = y
+	case *url.URL:
 		if p == nil {
 			return errNilDst(p)
 		}
-		if code != tspb.TypeCode_INT64 {
-			return typeErr
+		if code != tspb.TypeCode_STRING {
+			return typeErr()
 		}
 		if isNull {
-			*p = NullInt64{}
-			break
+			return nullErr()
 		}
-		x, err := getInteger64Value(v)
+		x, err := getStringValue(v)
 		if err != nil {
 			return err
 		}
-
-		p.Valid = true
-		p.Int64 = x
-	case *[]NullInt64:
+		y, err := url.Parse(x)
+		if err != nil {
+			return errBadEncoding(v, err)
+		}
+		*p = *y
+	case **regexp.Regexp:
 		if p == nil {
 			return errNilDst(p)
 		}
-		if acode != tspb.TypeCode_INT64 {
-			return typeErr
+		if code != tspb.TypeCode_STRING {
+			return typeErr()
 		}
 		if isNull {
 			*p = nil
 			break
 		}
-		x, err := getListValue(v)
+		x, err := getStringValue(v)
 		if err != nil {
 			return err
 		}
-		y, err := decodeIntArray(x)
+		y, err := regexp.Compile(x)
 		if err != nil {
-			return err
+			return errBadEncoding(v, err)
 		}
 		*p = y
-	case *bool:
+	case *NullURL:
 		if p == nil {
 			return errNilDst(p)
 		}
-		if code != tspb.TypeCode_BOOL {
-			return typeErr
+		if code != tspb.TypeCode_STRING {
+			return typeErr()
 		}
 		if isNull {
-			return nullErr
+			*p = NullURL{}
+			break
 		}
-		x, err := getBoolValue(v)
+		x, err := getStringValue(v)
 		if err != nil {
 			return err
 		}
-		*p = x
-	case *NullBool:
+		y, err := url.Parse(x)
+		if err != nil {
+			return errBadEncoding(v, err)
+		}
+		p.Valid = true
+		p.URL = *y
+	case *big.Rat:
 		if p == nil {
 			return errNilDst(p)
 		}
-		if code != tspb.TypeCode_BOOL {
-			return typeErr
+		if code != tspb.TypeCode_STRING {
+			return typeErr()
 		}
 		if isNull {
-			*p = NullBool{}
-			break
+			return nullErr()
 		}
-		x, err := getBoolValue(v)
+		x, err := getStringValue(v)
 		if err != nil {
 			return err
 		}
-		p.Valid = true
-		p.Bool = x
-	case *[]NullBool:
+		y, ok := new(big.Rat).SetString(x)
+		if !ok {
+			return errBadEncoding(v, fmt.Errorf("%q is not a fraction", x))
+		}
+		p.Set(y)
+	case *NullNumeric:
 		if p == nil {
 			return errNilDst(p)
 		}
-		if acode != tspb.TypeCode_BOOL {
-			return typeErr
+		if code != tspb.TypeCode_STRING {
+			return typeErr()
 		}
 		if isNull {
-			*p = nil
+			*p = NullNumeric{}
 			break
 		}
-		x, err := getListValue(v)
+		x, err := getStringValue(v)
 		if err != nil {
 			return err
 		}
-		y, err := decodeBoolArray(x)
-		if err != nil {
-			return err
+		y, ok := new(big.Rat).SetString(x)
+		if !ok {
+			return errBadEncoding(v, fmt.Errorf("%q is not a NUMERIC", x))
 		}
-		*p = y
-	case *float64:
+		p.Valid = true
+		p.Numeric.Set(y)
+	case *netip.Prefix:
 		if p == nil {
 			return errNilDst(p)
 		}
-		if code != tspb.TypeCode_FLOAT64 {
-			return typeErr
+		if code != tspb.TypeCode_STRING {
+			return typeErr()
 		}
 		if isNull {
-			return nullErr
+			return nullErr()
 		}
-		x, err := getFloat64Value(v)
+		x, err := getStringValue(v)
 		if err != nil {
 			return err
 		}
-		*p = x
-	case *NullFloat64:
+		y, err := netip.ParsePrefix(x)
+		if err != nil {
+			return errBadEncoding(v, err)
+		}
+		*p = y
+	case *NullPrefix:
 		if p == nil {
 			return errNilDst(p)
 		}
-		if code != tspb.TypeCode_FLOAT64 {
-			return typeErr
+		if code != tspb.TypeCode_STRING {
+			return typeErr()
 		}
 		if isNull {
-			*p = NullFloat64{}
+			*p = NullPrefix{}
 			break
 		}
-		x, err := getFloat64Value(v)
+		x, err := getStringValue(v)
 		if err != nil {
 			return err
 		}
+		y, err := netip.ParsePrefix(x)
+		if err != nil {
+			return errBadEncoding(v, err)
+		}
 		p.Valid = true
-		p.Float64 = x
-	case *[]NullFloat64:
+		p.Prefix = y
+	case *SemVer:
 		if p == nil {
 			return errNilDst(p)
 		}
-		if acode != tspb.TypeCode_FLOAT64 {
-			return typeErr
+		if code != tspb.TypeCode_STRING {
+			return typeErr()
 		}
 		if isNull {
-			*p = nil
-			break
+			return nullErr()
 		}
-		x, err := getListValue(v)
+		x, err := getStringValue(v)
 		if err != nil {
 			return err
 		}
-		y, err := decodeFloat64Array(x)
+		y, err := ParseSemVer(x)
 		if err != nil {
-			return err
+			return errBadEncoding(v, err)
 		}
 		*p = y
-	case *time.Time:
-		var nt NullTime
+	case *NullSemVer:
+		if p == nil {
+			return errNilDst(p)
+		}
+		if code != tspb.TypeCode_STRING {
+			return typeErr()
+		}
 		if isNull {
-			return nullErr
+			*p = NullSemVer{}
+			break
 		}
-		err := parseNullTime(v, &nt, code, isNull)
+		x, err := getStringValue(v)
 		if err != nil {
-			return nil
+			return err
 		}
-		*p = nt.Time
-	case *NullTime:
-		err := parseNullTime(v, p, code, isNull)
+		y, err := ParseSemVer(x)
 		if err != nil {
-			return err
+			return errBadEncoding(v, err)
 		}
-	case *[]NullTime:
+		p.Valid = true
+		p.SemVer = y
+	case *[]byte:
 		if p == nil {
 			return errNilDst(p)
 		}
-		if acode != tspb.TypeCode_TIMESTAMP {
-			return typeErr
+		if code != tspb.TypeCode_BYTES {
+			return typeErr()
 		}
 		if isNull {
 			*p = nil
 			break
 		}
-		x, err := getListValue(v)
+		x, err := getBytesValue(v)
 		if err != nil {
 			return err
 		}
-		y, err := decodeTimeArray(x)
-		if err != nil {
-			return err
+		if x == nil {
+			// Empty BYTES may come back from the wire as a nil slice, keep
+			// nil for NULL only.
+			x = []byte{}
 		}
-		*p = y
-	case *civil.Date:
+		*p = x
+	case *[][]byte:
 		if p == nil {
 			return errNilDst(p)
 		}
-		if code != tspb.TypeCode_DATE {
-			return typeErr
+		if acode != tspb.TypeCode_BYTES {
+			return typeErr()
 		}
 		if isNull {
-			return nullErr
+			*p = nil
+			break
 		}
-		x, err := getStringValue(v)
+		x, err := getListValue(v)
 		if err != nil {
 			return err
 		}
-		y, err := civil.ParseDate(x)
+		y, err := decodeByteArray(x, opts)
 		if err != nil {
-			return errBadEncoding(v, err)
+			return err
 		}
 		*p = y
-	case *NullDate:
+	case *NullBytes:
 		if p == nil {
 			return errNilDst(p)
 		}
-		if code != tspb.TypeCode_DATE {
-			return typeErr
+		if code != tspb.TypeCode_BYTES {
+			return typeErr()
 		}
 		if isNull {
-			*p = NullDate{}
+			*p = NullBytes{}
 			break
 		}
-		x, err := getStringValue(v)
+		x, err := getBytesValue(v)
 		if err != nil {
 			return err
 		}
-		y, err := civil.ParseDate(x)
-		if err != nil {
-			return errBadEncoding(v, err)
+		if x == nil {
+			x = []byte{}
 		}
 		p.Valid = true
-		p.Date = y
-	case *[]NullDate:
+		p.Bytes = x
+	case *[]NullBytes:
 		if p == nil {
 			return errNilDst(p)
 		}
-		if acode != tspb.TypeCode_DATE {
-			return typeErr
+		if acode != tspb.TypeCode_BYTES {
+			return typeErr()
 		}
 		if isNull {
 			*p = nil
@@ -586,42 +884,725 @@ func decodeValue(v *tspb.Value, t *tspb.Type, ptr interface{}) error {
 		if err != nil {
 			return err
 		}
-		y, err := decodeDateArray(x)
+		y, err := decodeNullBytesArray(x, opts)
 		if err != nil {
 			return err
 		}
 		*p = y
-	case *[]NullRow:
+	case *int64:
 		if p == nil {
 			return errNilDst(p)
 		}
-		if acode != tspb.TypeCode_STRUCT {
-			return typeErr
+		if code != tspb.TypeCode_INT64 && !opts.coercesNumeric(code) {
+			return typeErr()
 		}
 		if isNull {
-			*p = nil
-			break
+			return nullErr()
 		}
-		x, err := getListValue(v)
+
+		x, err := getCoercedInteger64Value(v, code)
 		if err != nil {
 			return err
 		}
-		y, err := decodeRowArray(t.ArrayElementType.StructType, x)
-		if err != nil {
-			return err
+
+		*p = x
+	case *NullInt64:
+		if p == nil {
+			return errNilDst(p)
+		}
+		if code != tspb.TypeCode_INT64 && !opts.coercesNumeric(code) {
+			return typeErr()
+		}
+		if isNull {
+			*p = NullInt64{}
+			break
+		}
+		x, err := getCoercedInteger64Value(v, code)
+		if err != nil {
+			return err
+		}
+
+		p.Valid = true
+		p.Int64 = x
+	case *uint64:
+		if p == nil {
+			return errNilDst(p)
+		}
+		if code != tspb.TypeCode_INT64 {
+			return typeErr()
+		}
+		if isNull {
+			return nullErr()
+		}
+		x, err := getInteger64Value(v)
+		if err != nil {
+			return err
+		}
+		if x < 0 {
+			// Not reinterpreted, the encoder doesn't write such values.
+			return errIntOverflowDst(v, reflect.TypeOf(*p))
+		}
+		*p = uint64(x)
+	case *NullUint64:
+		if p == nil {
+			return errNilDst(p)
+		}
+		if code != tspb.TypeCode_INT64 {
+			return typeErr()
+		}
+		if isNull {
+			*p = NullUint64{}
+			break
+		}
+		x, err := getInteger64Value(v)
+		if err != nil {
+			return err
+		}
+		if x < 0 {
+			return errIntOverflowDst(v, reflect.TypeOf(p.Uint64))
+		}
+		p.Valid = true
+		p.Uint64 = uint64(x)
+	case *[]NullInt64:
+		if p == nil {
+			return errNilDst(p)
+		}
+		if acode != tspb.TypeCode_INT64 {
+			return typeErr()
+		}
+		if isNull {
+			*p = nil
+			break
+		}
+		x, err := getListValue(v)
+		if err != nil {
+			return err
+		}
+		y, err := decodeIntArray(x, opts)
+		if err != nil {
+			return err
+		}
+		*p = y
+	case *[][]NullString:
+		if p == nil {
+			return errNilDst(p)
+		}
+		if err := checkNestedArrayType(t, tspb.TypeCode_STRING, p); err != nil {
+			return err
+		}
+		if isNull {
+			*p = nil
+			break
+		}
+		x, err := getListValue(v)
+		if err != nil {
+			return err
+		}
+		y := make([][]NullString, len(x.GetValues()))
+		if err := decodeNestedArray(x, t.ArrayElementType, func(i int) interface{} { return &y[i] }, opts); err != nil {
+			return err
+		}
+		*p = y
+	case *[][]NullInt64:
+		if p == nil {
+			return errNilDst(p)
+		}
+		if err := checkNestedArrayType(t, tspb.TypeCode_INT64, p); err != nil {
+			return err
+		}
+		if isNull {
+			*p = nil
+			break
+		}
+		x, err := getListValue(v)
+		if err != nil {
+			return err
+		}
+		y := make([][]NullInt64, len(x.GetValues()))
+		if err := decodeNestedArray(x, t.ArrayElementType, func(i int) interface{} { return &y[i] }, opts); err != nil {
+			return err
+		}
+		*p = y
+	case *[][]NullFloat64:
+		if p == nil {
+			return errNilDst(p)
+		}
+		if err := checkNestedArrayType(t, tspb.TypeCode_FLOAT64, p); err != nil {
+			return err
+		}
+		if isNull {
+			*p = nil
+			break
+		}
+		x, err := getListValue(v)
+		if err != nil {
+			return err
+		}
+		y := make([][]NullFloat64, len(x.GetValues()))
+		if err := decodeNestedArray(x, t.ArrayElementType, func(i int) interface{} { return &y[i] }, opts); err != nil {
+			return err
+		}
+		*p = y
+	case *[][]NullBool:
+		if p == nil {
+			return errNilDst(p)
+		}
+		if err := checkNestedArrayType(t, tspb.TypeCode_BOOL, p); err != nil {
+			return err
+		}
+		if isNull {
+			*p = nil
+			break
+		}
+		x, err := getListValue(v)
+		if err != nil {
+			return err
+		}
+		y := make([][]NullBool, len(x.GetValues()))
+		if err := decodeNestedArray(x, t.ArrayElementType, func(i int) interface{} { return &y[i] }, opts); err != nil {
+			return err
+		}
+		*p = y
+	case *time.Duration:
+		if p == nil {
+			return errNilDst(p)
+		}
+		if code != tspb.TypeCode_INT64 && code != tspb.TypeCode_STRING {
+			return typeErr()
+		}
+		if isNull {
+			return nullErr()
+		}
+		x, err := getDurationValue(v, code)
+		if err != nil {
+			return err
+		}
+		*p = x
+	case *NullDuration:
+		if p == nil {
+			return errNilDst(p)
+		}
+		if code != tspb.TypeCode_INT64 && code != tspb.TypeCode_STRING {
+			return typeErr()
+		}
+		if isNull {
+			*p = NullDuration{}
+			break
+		}
+		x, err := getDurationValue(v, code)
+		if err != nil {
+			return err
+		}
+		p.Valid = true
+		p.Duration = x
+	case *[]time.Duration:
+		if p == nil {
+			return errNilDst(p)
+		}
+		if acode != tspb.TypeCode_INT64 {
+			return typeErr()
+		}
+		if isNull {
+			*p = nil
+			break
+		}
+		x, err := getListValue(v)
+		if err != nil {
+			return err
+		}
+		y, err := decodeNonNullDurationArray(x, opts)
+		if err != nil {
+			return err
+		}
+		*p = y
+	case *[]NullDuration:
+		if p == nil {
+			return errNilDst(p)
+		}
+		if acode != tspb.TypeCode_INT64 {
+			return typeErr()
+		}
+		if isNull {
+			*p = nil
+			break
+		}
+		x, err := getListValue(v)
+		if err != nil {
+			return err
+		}
+		y, err := decodeDurationArray(x, opts)
+		if err != nil {
+			return err
+		}
+		*p = y
+	case *bool:
+		if p == nil {
+			return errNilDst(p)
+		}
+		if code != tspb.TypeCode_BOOL && !opts.coercesIntBool(code) {
+			return typeErr()
+		}
+		if isNull {
+			return nullErr()
+		}
+		x, err := getCoercedBoolValue(v, code)
+		if err != nil {
+			return err
+		}
+		*p = x
+	case *NullBool:
+		if p == nil {
+			return errNilDst(p)
+		}
+		if code != tspb.TypeCode_BOOL && !opts.coercesIntBool(code) {
+			return typeErr()
+		}
+		if isNull {
+			*p = NullBool{}
+			break
+		}
+		x, err := getCoercedBoolValue(v, code)
+		if err != nil {
+			return err
+		}
+		p.Valid = true
+		p.Bool = x
+	case *[]NullBool:
+		if p == nil {
+			return errNilDst(p)
+		}
+		if acode != tspb.TypeCode_BOOL && !opts.coercesIntBool(acode) {
+			return typeErr()
+		}
+		if isNull {
+			*p = nil
+			break
+		}
+		x, err := getListValue(v)
+		if err != nil {
+			return err
+		}
+		var y []NullBool
+		if acode == tspb.TypeCode_INT64 {
+			y, err = decodeIntAsBoolArray(x, opts)
+		} else {
+			y, err = decodeBoolArray(x, opts)
+		}
+		if err != nil {
+			return err
+		}
+		*p = y
+	case *float64:
+		if p == nil {
+			return errNilDst(p)
+		}
+		if code != tspb.TypeCode_FLOAT64 && !opts.coercesNumeric(code) {
+			return typeErr()
+		}
+		if isNull {
+			return nullErr()
+		}
+		x, err := getCoercedFloat64Value(v, code)
+		if err != nil {
+			return err
+		}
+		*p = x
+	case *big.Float:
+		if p == nil {
+			return errNilDst(p)
+		}
+		if code != tspb.TypeCode_FLOAT64 && !opts.coercesNumeric(code) {
+			return typeErr()
+		}
+		if isNull {
+			return nullErr()
+		}
+		x, err := getCoercedFloat64Value(v, code)
+		if err != nil {
+			return err
+		}
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			return errNonFiniteBigFloat(v)
+		}
+		if prec := opts.bigFloatPrec(); prec > 0 {
+			p.SetPrec(prec)
+		}
+		p.SetFloat64(x)
+	case *NullFloat64:
+		if p == nil {
+			return errNilDst(p)
+		}
+		if code != tspb.TypeCode_FLOAT64 && !opts.coercesNumeric(code) {
+			return typeErr()
+		}
+		if isNull {
+			*p = NullFloat64{}
+			break
+		}
+		x, err := getCoercedFloat64Value(v, code)
+		if err != nil {
+			return err
+		}
+		if opts.nanAsNull() && math.IsNaN(x) {
+			*p = NullFloat64{}
+			break
+		}
+		p.Valid = true
+		p.Float64 = x
+	case *[]NullFloat64:
+		if p == nil {
+			return errNilDst(p)
+		}
+		if acode != tspb.TypeCode_FLOAT64 {
+			return typeErr()
+		}
+		if isNull {
+			*p = nil
+			break
+		}
+		x, err := getListValue(v)
+		if err != nil {
+			return err
+		}
+		y, err := decodeFloat64Array(x, opts)
+		if err != nil {
+			return err
+		}
+		*p = y
+	case *[]float32:
+		if p == nil {
+			return errNilDst(p)
+		}
+		if acode != tspb.TypeCode_FLOAT64 {
+			return typeErr()
+		}
+		if isNull {
+			*p = nil
+			break
+		}
+		x, err := getListValue(v)
+		if err != nil {
+			return err
+		}
+		y, err := decodeFloat32Array(x, opts)
+		if err != nil {
+			return err
+		}
+		*p = y
+	case *time.Time:
+		if p == nil {
+			return errNilDst(p)
+		}
+		if code != tspb.TypeCode_TIMESTAMP {
+			return typeErr()
+		}
+		if isNull {
+			return nullErr()
+		}
+		var nt NullTime
+		if err := parseNullTime(v, &nt, code, isNull); err != nil {
+			return err
+		}
+		*p = opts.inLocation(nt.Time)
+	case *NullTime:
+		err := parseNullTime(v, p, code, isNull)
+		if err != nil {
+			return err
+		}
+		if p.Valid {
+			p.Time = opts.inLocation(p.Time)
+		}
+	case *[]time.Time:
+		if p == nil {
+			return errNilDst(p)
+		}
+		if acode != tspb.TypeCode_TIMESTAMP {
+			return typeErr()
+		}
+		if isNull {
+			*p = nil
+			break
+		}
+		x, err := getListValue(v)
+		if err != nil {
+			return err
+		}
+		y, err := decodeNonNullTimeArray(x, opts)
+		if err != nil {
+			return err
+		}
+		*p = y
+	case *[]NullTime:
+		if p == nil {
+			return errNilDst(p)
+		}
+		if acode != tspb.TypeCode_TIMESTAMP {
+			return typeErr()
+		}
+		if isNull {
+			*p = nil
+			break
+		}
+		x, err := getListValue(v)
+		if err != nil {
+			return err
+		}
+		y, err := decodeTimeArray(x, opts)
+		if err != nil {
+			return err
+		}
+		*p = y
+	case *[]int64:
+		if p == nil {
+			return errNilDst(p)
+		}
+		millis := acode == tspb.TypeCode_TIMESTAMP && opts.timestampsAsEpochMillis()
+		if acode != tspb.TypeCode_INT64 && !millis {
+			return typeErr()
+		}
+		if isNull {
+			*p = nil
+			break
+		}
+		x, err := getListValue(v)
+		if err != nil {
+			return err
+		}
+		var y []int64
+		if millis {
+			y, err = decodeTimeArrayAsEpochMillis(x, opts)
+		} else {
+			y, err = decodeNonNullIntArray(x, opts)
+		}
+		if err != nil {
+			return err
+		}
+		*p = y
+	case *civil.Date:
+		if p == nil {
+			return errNilDst(p)
+		}
+		if code != tspb.TypeCode_DATE {
+			return typeErr()
+		}
+		if isNull {
+			return nullErr()
+		}
+		y, err := getParsedDateValue(v)
+		if err != nil {
+			return err
+		}
+		*p = y
+	case *NullDate:
+		if p == nil {
+			return errNilDst(p)
+		}
+		if code != tspb.TypeCode_DATE {
+			return typeErr()
+		}
+		if isNull {
+			*p = NullDate{}
+			break
+		}
+		y, err := getParsedDateValue(v)
+		if err != nil {
+			return err
+		}
+		p.Valid = true
+		p.Date = y
+	case *[]NullDate:
+		if p == nil {
+			return errNilDst(p)
+		}
+		if acode != tspb.TypeCode_DATE {
+			return typeErr()
+		}
+		if isNull {
+			*p = nil
+			break
+		}
+		x, err := getListValue(v)
+		if err != nil {
+			return err
+		}
+		y, err := decodeDateArray(x, opts)
+		if err != nil {
+			return err
+		}
+		*p = y
+	case *[]NullRow:
+		if p == nil {
+			return errNilDst(p)
+		}
+		if acode != tspb.TypeCode_STRUCT {
+			return typeErr()
+		}
+		if isNull {
+			*p = nil
+			break
+		}
+		x, err := getListValue(v)
+		if err != nil {
+			return err
+		}
+		y, err := decodeRowArray(t.ArrayElementType.StructType, x)
+		if err != nil {
+			return err
+		}
+		*p = y
+	case *GenericColumnValue:
+		*p = GenericColumnValue{
+			// Deep clone to ensure subsequent changes to t or v
+			// don't affect our decoded value.
+			Type:  proto.Clone(t).(*tspb.Type),
+			Value: proto.Clone(v).(*tspb.Value),
+		}
+	case *[]GenericColumnValue:
+		if p == nil {
+			return errNilDst(p)
+		}
+		if code != tspb.TypeCode_ARRAY {
+			return typeErr()
+		}
+		if isNull {
+			*p = nil
+			break
+		}
+		x, err := getListValue(v)
+		if err != nil {
+			return err
+		}
+		y, err := decodeGenericArray(t.ArrayElementType, x)
+		if err != nil {
+			return err
 		}
 		*p = y
-	case *GenericColumnValue:
-		*p = GenericColumnValue{
-			// Deep clone to ensure subsequent changes to t or v
-			// don't affect our decoded value.
-			Type:  proto.Clone(t).(*tspb.Type),
-			Value: proto.Clone(v).(*tspb.Value),
-		}
 	default:
+		// Decode STRING into types with a Set(string) error method, like
+		// flag.Value.
+		if setter, ok := p.(stringSetter); ok && code == tspb.TypeCode_STRING {
+			if vp := reflect.ValueOf(p); vp.Kind() == reflect.Ptr && vp.IsNil() {
+				return errNilDst(p)
+			}
+			if isNull {
+				return nullErr()
+			}
+			x, err := getStringValue(v)
+			if err != nil {
+				return err
+			}
+			if err := setter.Set(x); err != nil {
+				return errBadEncoding(v, err)
+			}
+			break
+		}
+		// Decode INT64 into the other integer kinds, such as int32 or named
+		// enum types, through reflection.
+		if vp := reflect.ValueOf(p); vp.Kind() == reflect.Ptr && isIntegerKind(vp.Type().Elem().Kind()) {
+			if vp.IsNil() {
+				return errNilDst(p)
+			}
+			if code != tspb.TypeCode_INT64 && !opts.coercesNumeric(code) {
+				return typeErr()
+			}
+			if isNull {
+				return nullErr()
+			}
+			x, err := getCoercedInteger64Value(v, code)
+			if err != nil {
+				return err
+			}
+			return setIntegerKind(vp, x, v)
+		}
+		// Decode ARRAY into fixed size Go arrays, such as [3]float64, whose
+		// length must match, element by element.
+		if vp := reflect.ValueOf(p); code == tspb.TypeCode_ARRAY && vp.Kind() == reflect.Ptr && vp.Type().Elem().Kind() == reflect.Array {
+			if vp.IsNil() {
+				return errNilDst(p)
+			}
+			if isNull {
+				return nullErr()
+			}
+			x, err := getListValue(v)
+			if err != nil {
+				return err
+			}
+			if n := vp.Elem().Len(); len(x.GetValues()) != n {
+				return errArrayLength(p, len(x.GetValues()), n)
+			}
+			// Decode into a copy, so that *p is left untouched on error.
+			a := reflect.New(vp.Type().Elem()).Elem()
+			for i, e := range x.Values {
+				if err := decodeValueWithOptions(e, t.ArrayElementType, a.Index(i).Addr().Interface(), opts); err != nil {
+					return errDecodeArrayElement(i, e, sqlTypeName(t.ArrayElementType), err)
+				}
+			}
+			vp.Elem().Set(a)
+			break
+		}
+		// Check if the proto encoding is for a struct, decoded into a pointer
+		// to a Go struct or to a pointer to one, which is set to nil for NULL.
+		if code == tspb.TypeCode_STRUCT {
+			vp := reflect.ValueOf(p)
+			if !vp.IsValid() || vp.Kind() != reflect.Ptr || !isStructOrStructPtr(vp.Type().Elem()) {
+				return typeErr()
+			}
+			if vp.IsNil() {
+				return errNilDst(p)
+			}
+			// sp points to the struct to decode into.
+			sp := vp
+			byPtr := vp.Elem().Kind() == reflect.Ptr
+			if byPtr {
+				if isNull {
+					vp.Elem().Set(reflect.Zero(vp.Elem().Type()))
+					break
+				}
+				sp = reflect.New(vp.Type().Elem().Elem())
+			} else if isNull {
+				return nullErr()
+			}
+			x, err := getListValue(v)
+			if err != nil {
+				return err
+			}
+			if err := decodeStructWithOptions(t.StructType, x, sp.Interface(), opts); err != nil {
+				return err
+			}
+			if byPtr {
+				vp.Elem().Set(sp)
+			}
+			break
+		}
+		// Check if the proto encoding is for an array of arrays of structs.
+		if code == tspb.TypeCode_ARRAY && acode == tspb.TypeCode_ARRAY &&
+			t.ArrayElementType.ArrayElementType.GetCode() == tspb.TypeCode_STRUCT {
+			vp := reflect.ValueOf(p)
+			if !vp.IsValid() {
+				return errNilDst(p)
+			}
+			if !isPtrNestedStructSlice(vp.Type()) {
+				return typeErr()
+			}
+			if vp.IsNil() {
+				return errNilDst(p)
+			}
+			if isNull {
+				vp.Elem().Set(reflect.Zero(vp.Elem().Type()))
+				break
+			}
+			x, err := getListValue(v)
+			if err != nil {
+				return err
+			}
+			if err = decodeNestedStructArray(t.ArrayElementType.ArrayElementType.StructType, x, p, opts); err != nil {
+				return err
+			}
+			break
+		}
 		// Check if the proto encoding is for an array of structs.
 		if !(code == tspb.TypeCode_ARRAY && acode == tspb.TypeCode_STRUCT) {
-			return typeErr
+			return typeErr()
 		}
 		vp := reflect.ValueOf(p)
 		if !vp.IsValid() {
@@ -629,7 +1610,7 @@ func decodeValue(v *tspb.Value, t *tspb.Type, ptr interface{}) error {
 		}
 		if !isPtrStructPtrSlice(vp.Type()) {
 			// The container is not a pointer to a struct pointer slice.
-			return typeErr
+			return typeErr()
 		}
 		// Only use reflection for nil detection on slow path.
 		// Also, IsNil panics on many types, so check it after the type check.
@@ -646,7 +1627,7 @@ func decodeValue(v *tspb.Value, t *tspb.Type, ptr interface{}) error {
 		if err != nil {
 			return err
 		}
-		if err = decodeStructArray(t.ArrayElementType.StructType, x, p); err != nil {
+		if err = decodeStructArray(t.ArrayElementType.StructType, x, p, opts); err != nil {
 			return err
 		}
 	}
@@ -655,8 +1636,8 @@ func decodeValue(v *tspb.Value, t *tspb.Type, ptr interface{}) error {
 
 // errSrvVal returns an error for getting a wrong source protobuf value in decoding.
 func errSrcVal(v *tspb.Value, want string) error {
-	return wrapError(codes.FailedPrecondition, "cannot use %v(Kind: %T) as Value_%sValue in decoding",
-		v, v.GetKind(), want)
+	return wrapError(codes.FailedPrecondition, "cannot use %v(Kind: %s) as Value_%sValue in decoding",
+		v, ValueKindName(v), want)
 }
 
 // getStringValue returns the string value encoded in tspb.Value v whose
@@ -668,6 +1649,42 @@ func getStringValue(v *tspb.Value) (string, error) {
 	return "", errSrcVal(v, "String")
 }
 
+// getParsedDateValue returns the DATE stored in v as YYYY-MM-DD text. Dates
+// which don't exist, such as 2020-02-30 or a month 13, are rejected rather
+// than normalized.
+func getParsedDateValue(v *tspb.Value) (civil.Date, error) {
+	x, err := getStringValue(v)
+	if err != nil {
+		return civil.Date{}, err
+	}
+	d, err := civil.ParseDate(x)
+	if err != nil {
+		return civil.Date{}, errBadEncoding(v, err)
+	}
+	if !d.IsValid() || d.String() != x {
+		return civil.Date{}, errBadEncoding(v, fmt.Errorf("%q is not a valid date", x))
+	}
+	return d, nil
+}
+
+// getDurationValue returns the time.Duration stored in v, either as INT64
+// nanoseconds or as a STRING parsed by time.ParseDuration, such as "1h30m".
+func getDurationValue(v *tspb.Value, code tspb.TypeCode) (time.Duration, error) {
+	if code != tspb.TypeCode_STRING {
+		x, err := getInteger64Value(v)
+		return time.Duration(x), err
+	}
+	x, err := getStringValue(v)
+	if err != nil {
+		return 0, err
+	}
+	d, err := time.ParseDuration(x)
+	if err != nil {
+		return 0, errBadEncoding(v, err)
+	}
+	return d, nil
+}
+
 // getBoolValue returns the bool value encoded in tspb.Value v whose
 // kind is tspb.Value_BoolValue.
 func getBoolValue(v *tspb.Value) (bool, error) {
@@ -729,6 +1746,65 @@ func getInteger64Value(v *tspb.Value) (int64, error) {
 	return 0, errSrcVal(v, "Integer")
 }
 
+// errLossyNumber returns error for a FLOAT64 that can't become an INT64 exactly.
+func errLossyNumber(v *tspb.Value) error {
+	return wrapError(codes.InvalidArgument, "%v cannot be converted to INT64 without loss", v)
+}
+
+// getCoercedInteger64Value returns the int64 value encoded in tspb.Value v of
+// type code INT64, or of type code FLOAT64 if it holds an integral number.
+func getCoercedInteger64Value(v *tspb.Value, code tspb.TypeCode) (int64, error) {
+	if code != tspb.TypeCode_FLOAT64 {
+		return getInteger64Value(v)
+	}
+	x, err := getFloat64Value(v)
+	if err != nil {
+		return 0, err
+	}
+	// float64(math.MaxInt64) rounds up to 2^63, which doesn't fit.
+	if x != math.Trunc(x) || x < math.MinInt64 || x >= math.MaxInt64 {
+		return 0, errLossyNumber(v)
+	}
+	return int64(x), nil
+}
+
+// errIntNotBool returns error for an INT64 other than 0 and 1 decoded as BOOL.
+func errIntNotBool(v *tspb.Value) error {
+	return wrapError(codes.OutOfRange, "%v is neither 0 nor 1 and cannot be decoded as BOOL", v)
+}
+
+// getCoercedBoolValue returns the bool value encoded in tspb.Value v of type
+// code BOOL, or of type code INT64 if it holds 0 or 1.
+func getCoercedBoolValue(v *tspb.Value, code tspb.TypeCode) (bool, error) {
+	if code != tspb.TypeCode_INT64 {
+		return getBoolValue(v)
+	}
+	x, err := getInteger64Value(v)
+	if err != nil {
+		return false, err
+	}
+	switch x {
+	case 0:
+		return false, nil
+	case 1:
+		return true, nil
+	}
+	return false, errIntNotBool(v)
+}
+
+// getCoercedFloat64Value returns the float64 value encoded in tspb.Value v of
+// type code FLOAT64 or INT64.
+func getCoercedFloat64Value(v *tspb.Value, code tspb.TypeCode) (float64, error) {
+	if code != tspb.TypeCode_INT64 {
+		return getFloat64Value(v)
+	}
+	x, err := getInteger64Value(v)
+	if err != nil {
+		return 0, err
+	}
+	return float64(x), nil
+}
+
 // getTimestampValue returns the timestamp value encoded in tspb.Value v whose
 // kind is tspb.Value_TimestampValue
 func getTimestampValue(v *tspb.Value) (time.Time, error) {
@@ -768,35 +1844,204 @@ func errNilListValue(sqlType string) error {
 func errDecodeArrayElement(i int, v proto.Message, sqlType string, err error) error {
 	se, ok := err.(*Error)
 	if !ok {
-		return wrapError(codes.Unknown,
-			"cannot decode %v(array element %v) as %v, error = <%v>", v, i, sqlType, err)
+		se = &Error{Code: codes.Unknown,
+			Desc: fmt.Sprintf("cannot decode %v(array element %v) as %v, error = <%v>", v, i, sqlType, err)}
+	} else {
+		se.decorate(fmt.Sprintf("cannot decode %v(array element %v) as %v", v, i, sqlType))
 	}
-	se.decorate(fmt.Sprintf("cannot decode %v(array element %v) as %v", v, i, sqlType))
+	se.annotate("", sqlType)
 	return se
 }
 
+// sqlTypeName returns the SQL name of t used to annotate decoding errors.
+func sqlTypeName(t *tspb.Type) string {
+	if t.GetCode() == tspb.TypeCode_ARRAY {
+		return fmt.Sprintf("%v<%v>", tspb.TypeCode_ARRAY, sqlTypeName(t.ArrayElementType))
+	}
+	return t.GetCode().String()
+}
+
+// errNestedArrayTypeMismatch returns error for decoding t, which is not an
+// ARRAY<ARRAY> of the element type dst holds, into dst.
+func errNestedArrayTypeMismatch(t *tspb.Type, dst interface{}) error {
+	return wrapError(codes.InvalidArgument, "type %T cannot be used for decoding %v", dst, sqlTypeName(t))
+}
+
+// checkNestedArrayType returns error if t, an ARRAY, is not an ARRAY<ARRAY<code>>.
+func checkNestedArrayType(t *tspb.Type, code tspb.TypeCode, dst interface{}) error {
+	at := t.ArrayElementType
+	if at.Code != tspb.TypeCode_ARRAY {
+		return errNestedArrayTypeMismatch(t, dst)
+	}
+	if at.ArrayElementType == nil {
+		return errNilArrElemType(at)
+	}
+	if at.ArrayElementType.Code != code {
+		return errNestedArrayTypeMismatch(t, dst)
+	}
+	return nil
+}
+
+// decodeNestedArray decodes tspb.ListValue pb, whose elements are ARRAYs of
+// type t, by decoding element i into at(i). NULL inner ARRAYs are decoded as
+// nil slices.
+func decodeNestedArray(pb *tspb.ListValue, t *tspb.Type, at func(int) interface{}, opts *DecodeOptions) error {
+	if pb == nil {
+		return errNilListValue(sqlTypeName(t))
+	}
+	for i, v := range pb.Values {
+		if err := decodeValueWithOptions(v, t, at(i), opts); err != nil {
+			return errDecodeArrayElement(i, v, sqlTypeName(t), err)
+		}
+	}
+	return nil
+}
+
 // decodeStringArray decodes tspb.ListValue pb into a NullString slice.
-func decodeStringArray(pb *tspb.ListValue) ([]NullString, error) {
+func decodeStringArray(pb *tspb.ListValue, opts *DecodeOptions) ([]NullString, error) {
 	if pb == nil {
 		return nil, errNilListValue("STRING")
 	}
 	a := make([]NullString, len(pb.Values))
 	for i, v := range pb.Values {
-		if err := decodeValue(v, stringType(), &a[i]); err != nil {
+		if err := decodeValueWithOptions(v, stringType(), &a[i], opts); err != nil {
 			return nil, errDecodeArrayElement(i, v, "STRING", err)
 		}
 	}
 	return a, nil
 }
 
+// errInvalidUTF8 returns error for BYTES that can't be decoded as a string.
+func errInvalidUTF8(v *tspb.Value) error {
+	return wrapError(codes.InvalidArgument, "%v is not valid UTF-8", v)
+}
+
+// JoinNullStrings concatenates the elements of vals, for example as decoded
+// from an ARRAY<STRING>, separated by sep, rendering NULL elements as
+// nullToken so they can be told from empty strings.
+func JoinNullStrings(vals []NullString, sep, nullToken string) string {
+	elems := make([]string, len(vals))
+	for i, v := range vals {
+		if v.Valid {
+			elems[i] = v.StringVal
+		} else {
+			elems[i] = nullToken
+		}
+	}
+	return strings.Join(elems, sep)
+}
+
+// decodeBytesAsStringArray decodes tspb.ListValue pb of BYTES into a NullString slice,
+// every non-NULL element must be valid UTF-8.
+func decodeBytesAsStringArray(pb *tspb.ListValue) ([]NullString, error) {
+	if pb == nil {
+		return nil, errNilListValue("BYTES")
+	}
+	a := make([]NullString, len(pb.Values))
+	for i, v := range pb.Values {
+		var b []byte
+		if err := decodeValue(v, bytesType(), &b); err != nil {
+			return nil, errDecodeArrayElement(i, v, "BYTES", err)
+		}
+		if b == nil {
+			continue
+		}
+		if !utf8.Valid(b) {
+			return nil, errDecodeArrayElement(i, v, "BYTES", errInvalidUTF8(v))
+		}
+		a[i] = NullString{StringVal: string(b), Valid: true}
+	}
+	return a, nil
+}
+
+// DecodeStringArrayToSet decodes v, an ARRAY<STRING> as described by t, into
+// a set of its elements. Duplicated elements collapse into one entry and NULL
+// elements are skipped. A NULL array decodes into a nil set.
+func DecodeStringArrayToSet(v *tspb.Value, t *tspb.Type) (map[string]struct{}, error) {
+	if t == nil {
+		return nil, errNilSpannerType()
+	}
+	if v == nil {
+		return nil, errNilSrc()
+	}
+	if t.Code != tspb.TypeCode_ARRAY {
+		return nil, errTypeMismatch(t.Code, false, map[string]struct{}(nil))
+	}
+	if acode := t.ArrayElementType.GetCode(); acode != tspb.TypeCode_STRING {
+		return nil, errTypeMismatch(acode, true, map[string]struct{}(nil))
+	}
+	if IsNullValue(v) {
+		return nil, nil
+	}
+	x, err := getListValue(v)
+	if err != nil {
+		return nil, err
+	}
+	y, err := decodeStringArray(x, nil)
+	if err != nil {
+		return nil, err
+	}
+	set := make(map[string]struct{}, len(y))
+	for _, s := range y {
+		if s.Valid {
+			set[s.StringVal] = struct{}{}
+		}
+	}
+	return set, nil
+}
+
 // decodeIntArray decodes tspb.ListValue pb into a NullInt64 slice.
-func decodeIntArray(pb *tspb.ListValue) ([]NullInt64, error) {
+func decodeIntArray(pb *tspb.ListValue, opts *DecodeOptions) ([]NullInt64, error) {
 	if pb == nil {
 		return nil, errNilListValue("INT64")
 	}
 	a := make([]NullInt64, len(pb.Values))
 	for i, v := range pb.Values {
-		if err := decodeValue(v, intType(), &a[i]); err != nil {
+		if err := decodeValueWithOptions(v, intType(), &a[i], opts); err != nil {
+			return nil, errDecodeArrayElement(i, v, "INT64", err)
+		}
+	}
+	return a, nil
+}
+
+// decodeNonNullIntArray decodes tspb.ListValue pb into a int64 slice, NULL
+// elements are rejected.
+func decodeNonNullIntArray(pb *tspb.ListValue, opts *DecodeOptions) ([]int64, error) {
+	if pb == nil {
+		return nil, errNilListValue("INT64")
+	}
+	a := make([]int64, len(pb.Values))
+	for i, v := range pb.Values {
+		if err := decodeValueWithOptions(v, intType(), &a[i], opts); err != nil {
+			return nil, errDecodeArrayElement(i, v, "INT64", err)
+		}
+	}
+	return a, nil
+}
+
+// decodeDurationArray decodes tspb.ListValue pb into a NullDuration slice.
+func decodeDurationArray(pb *tspb.ListValue, opts *DecodeOptions) ([]NullDuration, error) {
+	if pb == nil {
+		return nil, errNilListValue("INT64")
+	}
+	a := make([]NullDuration, len(pb.Values))
+	for i, v := range pb.Values {
+		if err := decodeValueWithOptions(v, intType(), &a[i], opts); err != nil {
+			return nil, errDecodeArrayElement(i, v, "INT64", err)
+		}
+	}
+	return a, nil
+}
+
+// decodeNonNullDurationArray decodes tspb.ListValue pb into a time.Duration
+// slice, NULL elements are rejected.
+func decodeNonNullDurationArray(pb *tspb.ListValue, opts *DecodeOptions) ([]time.Duration, error) {
+	if pb == nil {
+		return nil, errNilListValue("INT64")
+	}
+	a := make([]time.Duration, len(pb.Values))
+	for i, v := range pb.Values {
+		if err := decodeValueWithOptions(v, intType(), &a[i], opts); err != nil {
 			return nil, errDecodeArrayElement(i, v, "INT64", err)
 		}
 	}
@@ -804,73 +2049,243 @@ func decodeIntArray(pb *tspb.ListValue) ([]NullInt64, error) {
 }
 
 // decodeBoolArray decodes tspb.ListValue pb into a NullBool slice.
-func decodeBoolArray(pb *tspb.ListValue) ([]NullBool, error) {
+func decodeBoolArray(pb *tspb.ListValue, opts *DecodeOptions) ([]NullBool, error) {
 	if pb == nil {
 		return nil, errNilListValue("BOOL")
 	}
 	a := make([]NullBool, len(pb.Values))
 	for i, v := range pb.Values {
-		if err := decodeValue(v, boolType(), &a[i]); err != nil {
+		if err := decodeValueWithOptions(v, boolType(), &a[i], opts); err != nil {
 			return nil, errDecodeArrayElement(i, v, "BOOL", err)
 		}
 	}
 	return a, nil
 }
 
+// decodeIntAsBoolArray decodes tspb.ListValue pb of INT64 0 or 1 into a
+// NullBool slice, opts must allow IntBoolCoercion.
+func decodeIntAsBoolArray(pb *tspb.ListValue, opts *DecodeOptions) ([]NullBool, error) {
+	if pb == nil {
+		return nil, errNilListValue("INT64")
+	}
+	a := make([]NullBool, len(pb.Values))
+	for i, v := range pb.Values {
+		if err := decodeValueWithOptions(v, intType(), &a[i], opts); err != nil {
+			return nil, errDecodeArrayElement(i, v, "INT64", err)
+		}
+	}
+	return a, nil
+}
+
+// DecodeIntArrayAsBools decodes v, an ARRAY<INT64> of legacy boolean flags
+// holding 0 or 1, into a NullBool slice. NULL elements decode to an invalid
+// NullBool, other integers are rejected, a NULL array decodes to nil.
+func DecodeIntArrayAsBools(v *tspb.Value, t *tspb.Type) ([]NullBool, error) {
+	var a []NullBool
+	if t.GetCode() != tspb.TypeCode_ARRAY {
+		return nil, errTypeMismatch(t.GetCode(), false, &a)
+	}
+	if code := t.GetArrayElementType().GetCode(); code != tspb.TypeCode_INT64 {
+		return nil, errTypeMismatch(code, true, &a)
+	}
+	if err := decodeValueWithOptions(v, t, &a, &DecodeOptions{IntBoolCoercion: true}); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
 // decodeFloat64Array decodes tspb.ListValue pb into a NullFloat64 slice.
-func decodeFloat64Array(pb *tspb.ListValue) ([]NullFloat64, error) {
+func decodeFloat64Array(pb *tspb.ListValue, opts *DecodeOptions) ([]NullFloat64, error) {
 	if pb == nil {
 		return nil, errNilListValue("FLOAT64")
 	}
 	a := make([]NullFloat64, len(pb.Values))
 	for i, v := range pb.Values {
-		if err := decodeValue(v, floatType(), &a[i]); err != nil {
+		if err := decodeValueWithOptions(v, floatType(), &a[i], opts); err != nil {
+			return nil, errDecodeArrayElement(i, v, "FLOAT64", err)
+		}
+	}
+	return a, nil
+}
+
+// errFloat32Overflow returns error for a FLOAT64 too large for a float32.
+func errFloat32Overflow(v *tspb.Value) error {
+	return wrapError(codes.OutOfRange, "%v overflows float32", v)
+}
+
+// decodeFloat32Array decodes tspb.ListValue pb into a float32 slice, rounding
+// each element to the nearest float32. Finite elements out of the float32
+// range become ±Inf, or are rejected if opts.StrictFloat32 is set.
+func decodeFloat32Array(pb *tspb.ListValue, opts *DecodeOptions) ([]float32, error) {
+	if pb == nil {
+		return nil, errNilListValue("FLOAT64")
+	}
+	a := make([]float32, len(pb.Values))
+	for i, v := range pb.Values {
+		var x float64
+		if err := decodeValueWithOptions(v, floatType(), &x, opts); err != nil {
 			return nil, errDecodeArrayElement(i, v, "FLOAT64", err)
 		}
+		a[i] = float32(x)
+		if opts != nil && opts.StrictFloat32 && math.IsInf(float64(a[i]), 0) && !math.IsInf(x, 0) {
+			return nil, errDecodeArrayElement(i, v, "FLOAT64", errFloat32Overflow(v))
+		}
 	}
 	return a, nil
 }
 
 // decodeByteArray decodes tspb.ListValue pb into a slice of byte slice.
-func decodeByteArray(pb *tspb.ListValue) ([][]byte, error) {
+func decodeByteArray(pb *tspb.ListValue, opts *DecodeOptions) ([][]byte, error) {
+	if pb == nil {
+		return nil, errNilListValue("BYTES")
+	}
+	a := make([][]byte, len(pb.Values))
+	for i, v := range pb.Values {
+		if err := decodeValueWithOptions(v, bytesType(), &a[i], opts); err != nil {
+			return nil, errDecodeArrayElement(i, v, "BYTES", err)
+		}
+	}
+	return a, nil
+}
+
+// decodeNullBytesArray decodes tspb.ListValue pb into a NullBytes slice.
+func decodeNullBytesArray(pb *tspb.ListValue, opts *DecodeOptions) ([]NullBytes, error) {
 	if pb == nil {
 		return nil, errNilListValue("BYTES")
 	}
-	a := make([][]byte, len(pb.Values))
+	a := make([]NullBytes, len(pb.Values))
+	for i, v := range pb.Values {
+		if err := decodeValueWithOptions(v, bytesType(), &a[i], opts); err != nil {
+			return nil, errDecodeArrayElement(i, v, "BYTES", err)
+		}
+	}
+	return a, nil
+}
+
+// decodeTimeArray decodes tspb.ListValue pb into a NullTime slice.
+func decodeTimeArray(pb *tspb.ListValue, opts *DecodeOptions) ([]NullTime, error) {
+	if pb == nil {
+		return nil, errNilListValue("TIMESTAMP")
+	}
+	a := make([]NullTime, len(pb.Values))
+	for i, v := range pb.Values {
+		if err := decodeValueWithOptions(v, timeType(), &a[i], opts); err != nil {
+			return nil, errDecodeArrayElement(i, v, "TIMESTAMP", err)
+		}
+	}
+	return a, nil
+}
+
+// decodeNonNullTimeArray decodes tspb.ListValue pb into a time.Time slice,
+// NULL elements are rejected.
+func decodeNonNullTimeArray(pb *tspb.ListValue, opts *DecodeOptions) ([]time.Time, error) {
+	if pb == nil {
+		return nil, errNilListValue("TIMESTAMP")
+	}
+	a := make([]time.Time, len(pb.Values))
+	for i, v := range pb.Values {
+		if err := decodeValueWithOptions(v, timeType(), &a[i], opts); err != nil {
+			return nil, errDecodeArrayElement(i, v, "TIMESTAMP", err)
+		}
+	}
+	return a, nil
+}
+
+// decodeTimeArrayAsEpochMillis decodes tspb.ListValue pb into a int64 slice
+// of milliseconds since the Unix epoch, NULL elements are replaced by
+// opts.NullEpochMillis or rejected if it is nil.
+func decodeTimeArrayAsEpochMillis(pb *tspb.ListValue, opts *DecodeOptions) ([]int64, error) {
+	ts, err := decodeTimeArray(pb, opts)
+	if err != nil {
+		return nil, err
+	}
+	a := make([]int64, len(ts))
+	for i, t := range ts {
+		if t.Valid {
+			a[i] = t.Time.UnixMilli()
+			continue
+		}
+		if opts == nil || opts.NullEpochMillis == nil {
+			return nil, errDecodeArrayElement(i, pb.Values[i], "TIMESTAMP", errDstNotForNull(&a[i]))
+		}
+		a[i] = *opts.NullEpochMillis
+	}
+	return a, nil
+}
+
+// decodeDateArray decodes tspb.ListValue pb into a NullDate slice.
+func decodeDateArray(pb *tspb.ListValue, opts *DecodeOptions) ([]NullDate, error) {
+	if pb == nil {
+		return nil, errNilListValue("DATE")
+	}
+	a := make([]NullDate, len(pb.Values))
 	for i, v := range pb.Values {
-		if err := decodeValue(v, bytesType(), &a[i]); err != nil {
-			return nil, errDecodeArrayElement(i, v, "BYTES", err)
+		if err := decodeValueWithOptions(v, dateType(), &a[i], opts); err != nil {
+			return nil, errDecodeArrayElement(i, v, "DATE", err)
 		}
 	}
 	return a, nil
 }
 
-// decodeTimeArray decodes tspb.ListValue pb into a NullTime slice.
-func decodeTimeArray(pb *tspb.ListValue) ([]NullTime, error) {
+// decodeGenericArray decodes tspb.ListValue pb into a GenericColumnValue
+// slice whose elements all have type t.
+func decodeGenericArray(t *tspb.Type, pb *tspb.ListValue) ([]GenericColumnValue, error) {
 	if pb == nil {
-		return nil, errNilListValue("TIMESTAMP")
+		return nil, errNilListValue(t.GetCode().String())
 	}
-	a := make([]NullTime, len(pb.Values))
+	a := make([]GenericColumnValue, len(pb.Values))
 	for i, v := range pb.Values {
-		if err := decodeValue(v, timeType(), &a[i]); err != nil {
-			return nil, errDecodeArrayElement(i, v, "TIMESTAMP", err)
+		if err := decodeValue(v, t, &a[i]); err != nil {
+			return nil, errDecodeArrayElement(i, v, t.GetCode().String(), err)
 		}
 	}
 	return a, nil
 }
 
-// decodeDateArray decodes tspb.ListValue pb into a NullDate slice.
-func decodeDateArray(pb *tspb.ListValue) ([]NullDate, error) {
-	if pb == nil {
-		return nil, errNilListValue("DATE")
+// decodeInterface decodes v of type t into the natural Go value for the type:
+// bool, int64, float64, string, []byte, time.Time, civil.Date or, for ARRAY,
+// an []interface{} of such elements. NULL decodes to nil, other types to a
+// GenericColumnValue.
+func decodeInterface(v *tspb.Value, t *tspb.Type) (interface{}, error) {
+	if IsNullValue(v) {
+		return nil, nil
 	}
-	a := make([]NullDate, len(pb.Values))
-	for i, v := range pb.Values {
-		if err := decodeValue(v, dateType(), &a[i]); err != nil {
-			return nil, errDecodeArrayElement(i, v, "DATE", err)
+	var ptr interface{}
+	switch t.GetCode() {
+	case tspb.TypeCode_BOOL:
+		ptr = new(bool)
+	case tspb.TypeCode_INT64:
+		ptr = new(int64)
+	case tspb.TypeCode_FLOAT64:
+		ptr = new(float64)
+	case tspb.TypeCode_STRING:
+		ptr = new(string)
+	case tspb.TypeCode_BYTES:
+		ptr = new([]byte)
+	case tspb.TypeCode_TIMESTAMP:
+		ptr = new(time.Time)
+	case tspb.TypeCode_DATE:
+		ptr = new(civil.Date)
+	case tspb.TypeCode_ARRAY:
+		x, err := getListValue(v)
+		if err != nil {
+			return nil, err
+		}
+		et := t.ArrayElementType
+		a := make([]interface{}, len(x.Values))
+		for i, e := range x.Values {
+			if a[i], err = decodeInterface(e, et); err != nil {
+				return nil, errDecodeArrayElement(i, e, et.GetCode().String(), err)
+			}
 		}
+		return a, nil
+	default:
+		ptr = new(GenericColumnValue)
 	}
-	return a, nil
+	if err := decodeValue(v, t, ptr); err != nil {
+		return nil, err
+	}
+	return reflect.ValueOf(ptr).Elem().Interface(), nil
 }
 
 func errNotStructElement(i int, v *tspb.Value) error {
@@ -928,6 +2343,45 @@ func structFieldColumn(typ reflect.Type, i int) (col string, ok bool) {
 	return col, true
 }
 
+// FingerprintStructType returns a stable fingerprint of the shape of ty, its
+// field names and types in order, the element types of ARRAYs and the fields
+// of nested STRUCTs included. STRUCT types of the same shape fingerprint
+// equally, so it can key what is derived from a result set schema, like how
+// a Go struct decodes rows of it.
+func FingerprintStructType(ty *tspb.StructType) uint64 {
+	h := fnv.New64a()
+	fingerprintStructType(h, ty)
+	return h.Sum64()
+}
+
+// fingerprintStructType writes the shape of ty to h.
+func fingerprintStructType(h hash.Hash64, ty *tspb.StructType) {
+	fmt.Fprintf(h, "%d{", len(ty.GetFields()))
+	for _, f := range ty.GetFields() {
+		// Prefixing the length keeps names from running into each other.
+		fmt.Fprintf(h, "%d:%s", len(f.GetName()), f.GetName())
+		fingerprintType(h, f.GetType())
+	}
+	h.Write([]byte{'}'})
+}
+
+// fingerprintType writes the shape of t to h.
+func fingerprintType(h hash.Hash64, t *tspb.Type) {
+	if t == nil {
+		h.Write([]byte{'-'})
+		return
+	}
+	fmt.Fprintf(h, "%d;", t.Code)
+	switch t.Code {
+	case tspb.TypeCode_ARRAY:
+		h.Write([]byte{'<'})
+		fingerprintType(h, t.ArrayElementType)
+		h.Write([]byte{'>'})
+	case tspb.TypeCode_STRUCT:
+		fingerprintStructType(h, t.StructType)
+	}
+}
+
 // errNilSpannerStructType returns error for unexpected nil Cloud Spanner STRUCT schema type in decoding.
 func errNilSpannerStructType() error {
 	return wrapError(codes.FailedPrecondition, "unexpected nil StructType in decoding Cloud Spanner STRUCT")
@@ -948,6 +2402,249 @@ func errNoOrDupGoField(s interface{}, f string) error {
 	return wrapError(codes.InvalidArgument, "Go struct %+v(type %T) has no or duplicate fields for Cloud Spanner STRUCT field %v", s, s, f)
 }
 
+// errTypedMapArgType returns error for a DecodeStructToTypedMap destination
+// which isn't a pointer to a map keyed by string.
+func errTypedMapArgType(dst interface{}) error {
+	return wrapError(codes.InvalidArgument, "DecodeStructToTypedMap(): type %T is not a valid pointer to map[string]T", dst)
+}
+
+// errStructValueCount returns error for a STRUCT whose value count doesn't
+// match its field count.
+func errStructValueCount(ty *tspb.StructType, pb *tspb.ListValue) error {
+	return wrapError(codes.FailedPrecondition, "STRUCT has %v fields but %v values", len(ty.Fields), len(pb.Values))
+}
+
+// DecodeStructToTypedMap decodes the STRUCT pb of type ty into dst, which must
+// be a pointer to a map[string]T, keyed by field name. Every field must be
+// decodable into a T, which suits STRUCTs whose fields share a type. The map
+// is allocated if it is nil, existing entries for other names are kept.
+func DecodeStructToTypedMap(ty *tspb.StructType, pb *tspb.ListValue, dst interface{}) error {
+	dv := reflect.ValueOf(dst)
+	if !dv.IsValid() || dv.Kind() != reflect.Ptr || dv.Type().Elem().Kind() != reflect.Map ||
+		dv.Type().Elem().Key().Kind() != reflect.String {
+		return errTypedMapArgType(dst)
+	}
+	if dv.IsNil() {
+		return errNilDst(dst)
+	}
+	if ty == nil {
+		return errNilSpannerStructType()
+	}
+	if pb == nil {
+		return errNilListValue("STRUCT")
+	}
+	if len(pb.Values) != len(ty.Fields) {
+		return errStructValueCount(ty, pb)
+	}
+	m := dv.Elem()
+	mt := m.Type()
+	seen := map[string]bool{}
+	decoded := reflect.MakeMapWithSize(mt, len(ty.Fields))
+	for i, f := range ty.Fields {
+		if f.Name == "" {
+			return errUnnamedField(ty, i)
+		}
+		if seen[f.Name] {
+			return errDupSpannerField(f.Name, ty)
+		}
+		seen[f.Name] = true
+		ev := reflect.New(mt.Elem())
+		if err := decodeValue(pb.Values[i], f.Type, ev.Interface()); err != nil {
+			return errDecodeStructField(ty, f.Name, err)
+		}
+		decoded.SetMapIndex(reflect.ValueOf(f.Name).Convert(mt.Key()), ev.Elem())
+	}
+	// Only touch dst once every field decoded.
+	if m.IsNil() {
+		m.Set(decoded)
+		return nil
+	}
+	iter := decoded.MapRange()
+	for iter.Next() {
+		m.SetMapIndex(iter.Key(), iter.Value())
+	}
+	return nil
+}
+
+// errStructMapArgType returns error for a DecodeStructArrayToMap destination
+// which isn't a pointer to a map of Go structs or struct pointers.
+func errStructMapArgType(dst interface{}) error {
+	return wrapError(codes.InvalidArgument,
+		"DecodeStructArrayToMap(): type %T is not a valid pointer to map[K]T or map[K]*T of Go struct T", dst)
+}
+
+// errStructMapKey returns error for a key field which can't key the map.
+func errStructMapKey(keyField string, ft, kt reflect.Type) error {
+	return wrapError(codes.InvalidArgument, "key field %q of type %v cannot be used as map key of type %v", keyField, ft, kt)
+}
+
+// errDupStructMapKey returns error for two STRUCTs having the same key.
+func errDupStructMapKey(keyField string, key interface{}, i int) error {
+	return wrapError(codes.FailedPrecondition, "STRUCT %d has duplicate key %v = %v", i, keyField, key)
+}
+
+// DecodeStructArrayToMap decodes the ARRAY<STRUCT> pb whose elements have type
+// ty into dst, which must be a pointer to a map[K]T or map[K]*T of Go struct
+// T, keyed by the value of the field decoded from column keyField. It is an
+// error for two elements to have the same key, or for an element to be NULL.
+// The map is allocated if it is nil, entries with other keys are kept. It is
+// only changed if every element decoded.
+func DecodeStructArrayToMap(ty *tspb.StructType, pb *tspb.ListValue, keyField string, dst interface{}) error {
+	dv := reflect.ValueOf(dst)
+	if !dv.IsValid() || dv.Kind() != reflect.Ptr || dv.Type().Elem().Kind() != reflect.Map {
+		return errStructMapArgType(dst)
+	}
+	mt := dv.Type().Elem()
+	et, isPtr := mt.Elem(), false
+	if et.Kind() == reflect.Ptr {
+		et, isPtr = et.Elem(), true
+	}
+	if et.Kind() != reflect.Struct {
+		return errStructMapArgType(dst)
+	}
+	if dv.IsNil() {
+		return errNilDst(dst)
+	}
+	if ty == nil {
+		return errNilSpannerStructType()
+	}
+	if pb == nil {
+		return errNilListValue("STRUCT")
+	}
+	fields, err := fieldCache.Fields(et)
+	if err != nil {
+		return err
+	}
+	kf := fields.Match(keyField)
+	if kf == nil {
+		return errNoOrDupGoField(reflect.New(et).Interface(), keyField)
+	}
+	if !kf.Type.AssignableTo(mt.Key()) {
+		return errStructMapKey(keyField, kf.Type, mt.Key())
+	}
+	decoded := reflect.MakeMapWithSize(mt, len(pb.Values))
+	for i, v := range pb.Values {
+		if IsNullValue(v) {
+			return errDecodeArrayElement(i, v, "STRUCT", errDstNotForNull(dst))
+		}
+		l, err := getListValue(v)
+		if err != nil {
+			return errDecodeArrayElement(i, v, "STRUCT", err)
+		}
+		if len(l.Values) != len(ty.Fields) {
+			return errDecodeArrayElement(i, v, "STRUCT", errStructValueCount(ty, l))
+		}
+		s := reflect.New(et)
+		if err := decodeStruct(ty, l, s.Interface()); err != nil {
+			return errDecodeArrayElement(i, v, "STRUCT", err)
+		}
+		key := s.Elem().FieldByIndex(kf.Index)
+		if decoded.MapIndex(key).IsValid() {
+			return errDupStructMapKey(keyField, key.Interface(), i)
+		}
+		if !isPtr {
+			s = s.Elem()
+		}
+		decoded.SetMapIndex(key, s)
+	}
+	m := dv.Elem()
+	if m.IsNil() {
+		m.Set(decoded)
+		return nil
+	}
+	iter := decoded.MapRange()
+	for iter.Next() {
+		m.SetMapIndex(iter.Key(), iter.Value())
+	}
+	return nil
+}
+
+// errStructChanArgType returns error for a DecodeStructArrayToChan
+// destination which isn't a channel of Go structs or struct pointers which
+// can be sent to.
+func errStructChanArgType(ch interface{}) error {
+	return wrapError(codes.InvalidArgument,
+		"DecodeStructArrayToChan(): type %T is not a valid chan T or chan *T of Go struct T", ch)
+}
+
+// DecodeStructArrayToChan decodes the ARRAY<STRUCT> pb whose elements have
+// type ty one at a time and sends each to ch, a chan T or chan *T of Go
+// struct T, so only the structs not yet received are held in memory. A NULL
+// element is sent as a nil *T, and is an error for a chan T. The channel is
+// closed when DecodeStructArrayToChan returns, the elements decoded before an
+// error are sent. Sends block, so ch is usually consumed by another goroutine.
+func DecodeStructArrayToChan(ty *tspb.StructType, pb *tspb.ListValue, ch interface{}) error {
+	cv := reflect.ValueOf(ch)
+	if !cv.IsValid() || cv.Kind() != reflect.Chan || cv.Type().ChanDir()&reflect.SendDir == 0 {
+		return errStructChanArgType(ch)
+	}
+	et, isPtr := cv.Type().Elem(), false
+	if et.Kind() == reflect.Ptr {
+		et, isPtr = et.Elem(), true
+	}
+	if et.Kind() != reflect.Struct {
+		return errStructChanArgType(ch)
+	}
+	if cv.IsNil() {
+		return errNilDst(ch)
+	}
+	defer cv.Close()
+	if ty == nil {
+		return errNilSpannerStructType()
+	}
+	if pb == nil {
+		return errNilListValue("STRUCT")
+	}
+	for i, v := range pb.Values {
+		if IsNullValue(v) {
+			if !isPtr {
+				return errDecodeArrayElement(i, v, "STRUCT", errDstNotForNull(reflect.New(et).Interface()))
+			}
+			cv.Send(reflect.Zero(cv.Type().Elem()))
+			continue
+		}
+		l, err := getListValue(v)
+		if err != nil {
+			return errDecodeArrayElement(i, v, "STRUCT", err)
+		}
+		if len(l.Values) != len(ty.Fields) {
+			return errDecodeArrayElement(i, v, "STRUCT", errStructValueCount(ty, l))
+		}
+		s := reflect.New(et)
+		if err := decodeStruct(ty, l, s.Interface()); err != nil {
+			return errDecodeArrayElement(i, v, "STRUCT", err)
+		}
+		if !isPtr {
+			s = s.Elem()
+		}
+		cv.Send(s)
+	}
+	return nil
+}
+
+// errBadRawFieldType returns error for a raw row field of unsupported type.
+func errBadRawFieldType(t reflect.Type) error {
+	return wrapError(codes.InvalidArgument, "raw row field must be *tspb.ListValue or Row, not %v", t)
+}
+
+// setRawField stores a copy of the values pb of a row with type ty in raw
+// row field fv, so it stays valid however the source is reused.
+func setRawField(fv reflect.Value, ty *tspb.StructType, pb *tspb.ListValue) error {
+	vals := proto.Clone(pb).(*tspb.ListValue)
+	switch p := fv.Addr().Interface().(type) {
+	case **tspb.ListValue:
+		*p = vals
+	case *Row:
+		*p = Row{
+			fields: proto.Clone(ty).(*tspb.StructType).Fields,
+			vals:   vals.Values,
+		}
+	default:
+		return errBadRawFieldType(fv.Type())
+	}
+	return nil
+}
+
 // errDupColNames returns error for duplicated Cloud Spanner STRUCT field names found in decoding a Cloud Spanner STRUCT into a Go struct.
 func errDupSpannerField(f string, ty *tspb.StructType) error {
 	return wrapError(codes.InvalidArgument, "duplicated field name %q in Cloud Spanner STRUCT %+v", f, ty)
@@ -961,26 +2658,42 @@ func errDupCellField(f string, ty *tspb.Cell) error {
 func errDecodeStructField(ty *tspb.StructType, f string, err error) error {
 	se, ok := err.(*Error)
 	if !ok {
-		return wrapError(codes.Unknown,
-			"cannot decode field %v of Cloud Spanner STRUCT %+v, error = <%v>", f, ty, err)
+		se = &Error{Code: codes.Unknown,
+			Desc: fmt.Sprintf("cannot decode field %v of Cloud Spanner STRUCT %+v, error = <%v>", f, ty, err)}
+	} else {
+		se.decorate(fmt.Sprintf("cannot decode field %v of Cloud Spanner STRUCT %+v", f, ty))
+	}
+	var sqlType string
+	for _, field := range ty.GetFields() {
+		if field.Name == f {
+			sqlType = sqlTypeName(field.Type)
+			break
+		}
 	}
-	se.decorate(fmt.Sprintf("cannot decode field %v of Cloud Spanner STRUCT %+v", f, ty))
+	se.annotate(f, sqlType)
 	return se
 }
 
 func errDecodeCellField(ty *tspb.Cell, f string, err error) error {
 	se, ok := err.(*Error)
 	if !ok {
-		return wrapError(codes.Unknown,
-			"cannot decode field %v of Zetta Cell %+v, error = <%v>", f, ty, err)
+		se = &Error{Code: codes.Unknown,
+			Desc: fmt.Sprintf("cannot decode field %v of Zetta Cell %+v, error = <%v>", f, ty, err)}
+	} else {
+		se.decorate(fmt.Sprintf("cannot decode field %v of Zetta Cell %+v", f, ty))
 	}
-	se.decorate(fmt.Sprintf("cannot decode field %v of Zetta Cell %+v", f, ty))
+	se.annotate(f, sqlTypeName(ty.GetType()))
 	return se
 }
 
 // decodeStruct decodes tspb.ListValue pb into struct referenced by pointer ptr, according to
 // the structual information given in tspb.StructType ty.
 func decodeStruct(ty *tspb.StructType, pb *tspb.ListValue, ptr interface{}) error {
+	return decodeStructWithOptions(ty, pb, ptr, nil)
+}
+
+// decodeStructWithOptions is decodeStruct with the behavior tuned by opts.
+func decodeStructWithOptions(ty *tspb.StructType, pb *tspb.ListValue, ptr interface{}, opts *DecodeOptions) error {
 	if reflect.ValueOf(ptr).IsNil() {
 		return errNilDst(ptr)
 	}
@@ -992,30 +2705,118 @@ func decodeStruct(ty *tspb.StructType, pb *tspb.ListValue, ptr interface{}) erro
 	// v is the actual value that ptr points to.
 	v := reflect.ValueOf(ptr).Elem()
 
-	fields, err := fieldCache.Fields(t)
+	fields, err := opts.fieldCache().Fields(t)
 	if err != nil {
 		return err
 	}
+	if opts != nil && opts.StrictUnexported {
+		if err := checkUnexportedFields(ty, t, fields, opts.tagParser()); err != nil {
+			return err
+		}
+	}
+	for i := range fields {
+		if isRawField(&fields[i]) {
+			if err := setRawField(v.FieldByIndex(fields[i].Index), ty, pb); err != nil {
+				return err
+			}
+		}
+	}
 	seen := map[string]bool{}
+	decoded := map[string]bool{}
+	var nulls []string
 	for i, f := range ty.Fields {
 		if f.Name == "" {
 			return errUnnamedField(ty, i)
 		}
 		sf := fields.Match(f.Name)
-		if sf == nil {
+		if sf == nil || isRawField(sf) {
 
 			return errNoOrDupGoField(ptr, f.Name)
 		}
 		if seen[f.Name] {
-			// We don't allow duplicated field name.
-			return errDupSpannerField(f.Name, ty)
+			switch opts.duplicateColumnPolicy() {
+			case DuplicateColumnFirst:
+				continue
+			case DuplicateColumnLast:
+				// Decode again to overwrite the earlier column.
+			default:
+				// We don't allow duplicated field name.
+				return errDupSpannerField(f.Name, ty)
+			}
 		}
 		// Try to decode a single field.
-		if err := decodeValue(pb.Values[i], f.Type, v.FieldByIndex(sf.Index).Addr().Interface()); err != nil {
+		fv := v.FieldByIndex(sf.Index)
+		var start time.Time
+		if opts.profiling() {
+			start = time.Now()
+		}
+		if hasFieldDefault(sf) && IsNullValue(pb.Values[i]) {
+			if err := setFieldDefault(fv, sf); err != nil {
+				return errDecodeStructField(ty, f.Name, err)
+			}
+		} else if err := decodeValueWithOptions(pb.Values[i], f.Type, fv.Addr().Interface(), opts); err != nil {
+			if !opts.rejectUnexpectedNull() || !isDstNotForNull(err, fv.Addr().Interface()) {
+				return errDecodeStructField(ty, f.Name, err)
+			}
+			// Go on to report all such columns at once.
+			nulls = append(nulls, f.Name)
+			seen[f.Name] = true
+			decoded[sf.Name] = true
+			continue
+		}
+		if opts.profiling() {
+			opts.Profiler(f.Name, time.Since(start))
+		}
+		if err := opts.postDecode(f.Name, fv); err != nil {
 			return errDecodeStructField(ty, f.Name, err)
 		}
 		// Mark field f.Name as processed.
 		seen[f.Name] = true
+		decoded[sf.Name] = true
+	}
+	if len(nulls) > 0 {
+		return errUnexpectedNulls(ptr, nulls)
+	}
+	if err := setAbsentFieldDefaults(v, fields, decoded); err != nil {
+		return err
+	}
+	return callPostDecoder(ptr)
+}
+
+// errUnexportedField returns error for a column only matching an unexported
+// field of a Go struct.
+func errUnexportedField(t reflect.Type, column, field string) error {
+	return wrapError(codes.InvalidArgument,
+		"column %q maps to unexported field %v of Go struct %v", column, field, t)
+}
+
+// checkUnexportedFields returns error if a column of ty has no field in
+// exported, the exported fields of struct type t, but matches an unexported
+// field of t when named by parser.
+func checkUnexportedFields(ty *tspb.StructType, t reflect.Type, exported fields.List, parser TagParser) error {
+	for _, f := range ty.Fields {
+		if f.Name == "" || exported.Match(f.Name) != nil {
+			continue
+		}
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if sf.PkgPath == "" || sf.Anonymous {
+				continue
+			}
+			name, keep, _, err := parser(sf.Tag)
+			if err != nil {
+				return err
+			}
+			if !keep {
+				continue
+			}
+			if name == "" {
+				name = sf.Name
+			}
+			if strings.EqualFold(name, f.Name) {
+				return errUnexportedField(t, f.Name, sf.Name)
+			}
+		}
 	}
 	return nil
 }
@@ -1033,9 +2834,73 @@ func isPtrStructPtrSlice(t reflect.Type) bool {
 	return true
 }
 
+// isPtrNestedStructSlice returns true if t is a pointer to a slice of slices
+// of structs or of struct pointers.
+func isPtrNestedStructSlice(t reflect.Type) bool {
+	if t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Slice || t.Elem().Elem().Kind() != reflect.Slice {
+		return false
+	}
+	et := t.Elem().Elem().Elem()
+	if et.Kind() == reflect.Ptr {
+		et = et.Elem()
+	}
+	return et.Kind() == reflect.Struct
+}
+
+// decodeNestedStructArray decodes tspb.ListValue pb holding ARRAY<STRUCT>
+// values into the slice of slices referenced by ptr. A NULL inner array
+// decodes to a nil slice, a NULL struct to a nil pointer, which a slice of
+// structs cannot hold.
+func decodeNestedStructArray(ty *tspb.StructType, pb *tspb.ListValue, ptr interface{}, opts *DecodeOptions) error {
+	if pb == nil {
+		return errNilListValue("ARRAY<STRUCT>")
+	}
+	v := reflect.ValueOf(ptr).Elem()
+	v.Set(reflect.MakeSlice(v.Type(), len(pb.Values), len(pb.Values)))
+	byPtr := v.Type().Elem().Elem().Kind() == reflect.Ptr
+	for i, pv := range pb.Values {
+		if IsNullValue(pv) {
+			continue
+		}
+		l, err := getListValue(pv)
+		if err != nil {
+			return errDecodeArrayElement(i, pv, "ARRAY<STRUCT>", err)
+		}
+		inner := v.Index(i)
+		if byPtr {
+			err = decodeStructArray(ty, l, inner.Addr().Interface(), opts)
+		} else {
+			err = decodeStructValueArray(ty, l, inner, opts)
+		}
+		if err != nil {
+			return errDecodeArrayElement(i, pv, "ARRAY<STRUCT>", err)
+		}
+	}
+	return nil
+}
+
+// decodeStructValueArray decodes tspb.ListValue pb into v, a slice of
+// structs, which cannot hold NULL elements.
+func decodeStructValueArray(ty *tspb.StructType, pb *tspb.ListValue, v reflect.Value, opts *DecodeOptions) error {
+	v.Set(reflect.MakeSlice(v.Type(), len(pb.Values), len(pb.Values)))
+	for i, pv := range pb.Values {
+		if IsNullValue(pv) {
+			return errDecodeArrayElement(i, pv, "STRUCT", errDstNotForNull(v.Index(i).Addr().Interface()))
+		}
+		l, err := getListValue(pv)
+		if err != nil {
+			return errDecodeArrayElement(i, pv, "STRUCT", err)
+		}
+		if err = decodeStructWithOptions(ty, l, v.Index(i).Addr().Interface(), opts); err != nil {
+			return errDecodeArrayElement(i, pv, "STRUCT", err)
+		}
+	}
+	return nil
+}
+
 // decodeStructArray decodes tspb.ListValue pb into struct slice referenced by pointer ptr, according to the
 // structual information given in a tspb.StructType.
-func decodeStructArray(ty *tspb.StructType, pb *tspb.ListValue, ptr interface{}) error {
+func decodeStructArray(ty *tspb.StructType, pb *tspb.ListValue, ptr interface{}, opts *DecodeOptions) error {
 	if pb == nil {
 		return errNilListValue("STRUCT")
 	}
@@ -1048,7 +2913,7 @@ func decodeStructArray(ty *tspb.StructType, pb *tspb.ListValue, ptr interface{})
 	// Decode every struct in pb.Values.
 	for i, pv := range pb.Values {
 		// Check if pv is a NULL value.
-		if _, isNull := pv.Kind.(*tspb.Value_NullValue); isNull {
+		if IsNullValue(pv) {
 			// Append a nil pointer to the slice.
 			v.Set(reflect.Append(v, reflect.New(ts).Elem()))
 			continue
@@ -1061,7 +2926,7 @@ func decodeStructArray(ty *tspb.StructType, pb *tspb.ListValue, ptr interface{})
 			return errDecodeArrayElement(i, pv, "STRUCT", err)
 		}
 		// Decode tspb.ListValue l into struct referenced by s.Interface().
-		if err = decodeStruct(ty, l, s.Interface()); err != nil {
+		if err = decodeStructWithOptions(ty, l, s.Interface(), opts); err != nil {
 			return errDecodeArrayElement(i, pv, "STRUCT", err)
 		}
 		// Append the decoded struct back into the slice.
@@ -1070,14 +2935,194 @@ func decodeStructArray(ty *tspb.StructType, pb *tspb.ListValue, ptr interface{})
 	return nil
 }
 
+// errDecodeResultRow returns error for failure in decoding a single row of a
+// result set.
+func errDecodeResultRow(i int, err error) error {
+	se, ok := err.(*Error)
+	if !ok {
+		return wrapError(codes.Unknown, "cannot decode row %d, error = <%v>", i, err)
+	}
+	se.decorate(fmt.Sprintf("cannot decode row %d", i))
+	return se
+}
+
+// errArrayLength returns error for decoding an ARRAY of n elements into dst,
+// a pointer to a Go array of length want.
+func errArrayLength(dst interface{}, n, want int) error {
+	return wrapError(codes.InvalidArgument, "cannot decode ARRAY of %d elements into %T of length %d", n, dst, want)
+}
+
+// errResultRowWidth returns error for a row not having a value for every field.
+func errResultRowWidth(got, want int) error {
+	return wrapError(codes.FailedPrecondition, "row has %d values, want %d", got, want)
+}
+
+// DecodeResultSetLenient decodes each of rows, whose columns are described by
+// fields, into a new struct appended to the slice of struct pointers that
+// slicePtr points to, like *[]*some_go_struct. Unlike decoding the rows as an
+// ARRAY<STRUCT>, a row which fails to decode doesn't abort the others: its
+// slice element is left nil and its error is stored at the same index of the
+// returned error slice, which is nil if every row decoded. The error result
+// only reports problems with the arguments.
+func DecodeResultSetLenient(fields []*tspb.StructType_Field, rows []*tspb.ListValue, slicePtr interface{}) ([]error, error) {
+	vp := reflect.ValueOf(slicePtr)
+	if !vp.IsValid() {
+		return nil, errNilDst(slicePtr)
+	}
+	if !isPtrStructPtrSlice(vp.Type()) {
+		return nil, errTypeMismatch(tspb.TypeCode_STRUCT, true, slicePtr)
+	}
+	if vp.IsNil() {
+		return nil, errNilDst(slicePtr)
+	}
+	ty := &tspb.StructType{Fields: fields}
+	// Type of the struct pointers stored in the slice.
+	ts := vp.Type().Elem().Elem()
+	v := vp.Elem()
+	v.Set(reflect.MakeSlice(v.Type(), len(rows), len(rows)))
+	var errs []error
+	for i, row := range rows {
+		s := reflect.New(ts.Elem())
+		var err error
+		switch {
+		case row == nil:
+			err = errNilListValue("STRUCT")
+		case len(row.Values) != len(fields):
+			err = errResultRowWidth(len(row.Values), len(fields))
+		default:
+			err = decodeStruct(ty, row, s.Interface())
+		}
+		if err == nil {
+			v.Index(i).Set(s)
+			continue
+		}
+		if errs == nil {
+			errs = make([]error, len(rows))
+		}
+		errs[i] = errDecodeResultRow(i, err)
+	}
+	return errs, nil
+}
+
 // errEncoderUnsupportedType returns error for not being able to encode a value of
 // certain type.
 func errEncoderUnsupportedType(v interface{}) error {
 	return wrapError(codes.InvalidArgument, "encoder doesn't support type %T", v)
 }
 
+// errInvalidPrefix returns error for encoding the zero or an invalid netip.Prefix.
+func errInvalidPrefix(p netip.Prefix) error {
+	return wrapError(codes.InvalidArgument, "cannot encode invalid IP prefix %v", p)
+}
+
+// errJSONMarshal returns error for encoding a NullJSON whose Value can't be
+// marshaled.
+func errJSONMarshal(v interface{}, err error) error {
+	return wrapError(codes.InvalidArgument, "cannot marshal %T as JSON, error = <%v>", v, err)
+}
+
+// errInvalidSemVer returns error for encoding a SemVer whose text doesn't parse.
+func errInvalidSemVer(err error) error {
+	return wrapError(codes.InvalidArgument, "cannot encode invalid semantic version: %v", err)
+}
+
+// errNULInString returns error for encoding a STRING with a NUL byte when it
+// is rejected.
+func errNULInString() error {
+	return wrapError(codes.InvalidArgument,
+		"cannot encode STRING containing a NUL byte, use []byte to encode binary data as BYTES")
+}
+
+// errZeroTime returns error for encoding the zero time.Time when it is rejected.
+func errZeroTime() error {
+	return wrapError(codes.InvalidArgument,
+		"cannot encode zero time.Time, use an invalid NullTime for NULL or an explicit sentinel time")
+}
+
+// errMixedArrayElementTypes returns error for array elements not sharing the
+// type of the first element.
+func errMixedArrayElementTypes(i int, want, got *tspb.Type) error {
+	return wrapError(codes.InvalidArgument, "array element %d has type %v, want %v", i, got, want)
+}
+
+// errBadNullArrayElementType returns error for a NullArray of a non scalar
+// element type.
+func errBadNullArrayElementType(code tspb.TypeCode) error {
+	return wrapError(codes.InvalidArgument, "NullArray element type %v is not a scalar type", code)
+}
+
+// errUntypedArray returns error for an array whose element type can't be told.
+func errUntypedArray(v interface{}) error {
+	return wrapError(codes.InvalidArgument, "cannot infer element type of empty %T", v)
+}
+
+// ForceNull is encoded as a NULL of the type Value would be encoded with,
+// whatever Value holds, for example ForceNull{int64(0)} is an INT64 NULL. It
+// forces a column to NULL in a mutation or a map of parameters while keeping
+// its type.
+type ForceNull struct {
+	Value interface{}
+}
+
+// errForceNullType returns error for a ForceNull whose Value has no type.
+func errForceNullType(v ForceNull) error {
+	return wrapError(codes.InvalidArgument, "cannot infer type of ForceNull from %T value", v.Value)
+}
+
+// errUntypedNil returns error for a typed nil which says nothing about the
+// type of the column.
+func errUntypedNil(v interface{}) error {
+	return wrapError(codes.InvalidArgument,
+		"cannot infer type of nil %T, use untyped nil, a Null type or GenericColumnValue", v)
+}
+
+// encodeTypedNil encodes v, a nil pointer, slice, map, channel or function,
+// as a NULL. A nil pointer gets the type its target would be encoded with,
+// the other kinds don't tell the type of the column and are rejected.
+func encodeTypedNil(v interface{}) (*tspb.Value, *tspb.Type, error) {
+	t := reflect.TypeOf(v)
+	if t.Kind() != reflect.Ptr {
+		return nil, nil, errUntypedNil(v)
+	}
+	pt := nullFieldType(t.Elem(), nil)
+	if pt == nil {
+		_, pt, _ = encodeValue(reflect.Zero(t.Elem()).Interface())
+	}
+	if pt == nil {
+		return nil, nil, errUntypedNil(v)
+	}
+	return nullProto(), pt, nil
+}
+
+// isTypedNil reports whether v is a nil of a kind which can be nil, held by a
+// non-nil interface.
+func isTypedNil(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Chan, reflect.Func, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}
+
 // 将 Go 原生类型编码成为 protobuf 的 tspb.Value，以及自定义的 type
 func encodeValue(v interface{}) (*tspb.Value, *tspb.Type, error) {
+	return encodeValueWithOptions(v, nil)
+}
+
+// encodeValueWithOptions is encodeValue with the behavior tuned by opts, a nil
+// opts encodes with the defaults.
+func encodeValueWithOptions(v interface{}, opts *EncodeOptions) (*tspb.Value, *tspb.Type, error) {
+	if e, ok := v.(Encoder); ok && !isTypedNil(v) {
+		pb, pt, err := e.EncodeSpanner()
+		if err != nil {
+			return nil, nil, err
+		}
+		if pb == nil {
+			return nil, nil, errEncoderNilValue(v)
+		}
+		return pb, pt, nil
+	}
 	pb := &tspb.Value{
 		Kind: &tspb.Value_NullValue{NullValue: tspb.NullValue_NULL_VALUE},
 	}
@@ -1086,15 +3131,18 @@ func encodeValue(v interface{}) (*tspb.Value, *tspb.Type, error) {
 	switch v := v.(type) {
 	case nil:
 	case string:
+		if err := opts.checkString(v); err != nil {
+			return nil, nil, err
+		}
 		pb.Kind = stringKind(v)
 		pt = stringType()
 	case NullString:
 		if v.Valid {
-			return encodeValue(v.StringVal)
+			return encodeValueWithOptions(v.StringVal, opts)
 		}
 	case []string:
 		if v != nil {
-			pb, err = encodeArray(len(v), func(i int) interface{} { return v[i] })
+			pb, err = encodeArrayWithOptions(len(v), func(i int) interface{} { return v[i] }, opts)
 			if err != nil {
 				return nil, nil, err
 			}
@@ -1102,12 +3150,71 @@ func encodeValue(v interface{}) (*tspb.Value, *tspb.Type, error) {
 		}
 	case []NullString:
 		if v != nil {
-			pb, err = encodeArray(len(v), func(i int) interface{} { return v[i] })
+			pb, err = encodeArrayWithOptions(len(v), func(i int) interface{} { return v[i] }, opts)
 			if err != nil {
 				return nil, nil, err
 			}
 			pt = listType(stringType())
 		}
+	case json.RawMessage:
+		if v != nil {
+			if err := opts.checkString(string(v)); err != nil {
+				return nil, nil, err
+			}
+			pb.Kind = stringKind(string(v))
+			pt = stringType()
+		}
+	case NullJSON:
+		if v.Valid {
+			b, err := json.Marshal(v.Value)
+			if err != nil {
+				return nil, nil, errJSONMarshal(v.Value, err)
+			}
+			return encodeValueWithOptions(string(b), opts)
+		}
+	case url.URL:
+		return encodeValueWithOptions(v.String(), opts)
+	case *url.URL:
+		if v != nil {
+			return encodeValueWithOptions(v.String(), opts)
+		}
+	case *regexp.Regexp:
+		if v != nil {
+			return encodeValueWithOptions(v.String(), opts)
+		}
+	case NullURL:
+		if v.Valid {
+			return encodeValueWithOptions(v.URL, opts)
+		}
+	case big.Rat:
+		return encodeValueWithOptions(v.String(), opts)
+	case *big.Rat:
+		if v != nil {
+			return encodeValueWithOptions(v.String(), opts)
+		}
+	case NullNumeric:
+		if v.Valid {
+			return encodeValueWithOptions(NumericString(&v.Numeric), opts)
+		}
+	case netip.Prefix:
+		if !v.IsValid() {
+			return nil, nil, errInvalidPrefix(v)
+		}
+		return encodeValueWithOptions(v.String(), opts)
+	case NullPrefix:
+		if v.Valid {
+			return encodeValueWithOptions(v.Prefix, opts)
+		}
+	case SemVer:
+		// Fields set by hand may not make a version that decodes back.
+		if _, err := ParseSemVer(v.String()); err != nil {
+			return nil, nil, errInvalidSemVer(err)
+		}
+		return encodeValueWithOptions(v.String(), opts)
+	case NullSemVer:
+		if v.Valid {
+			return encodeValueWithOptions(v.SemVer, opts)
+		}
 	case []byte:
 		if v != nil {
 			// pb.Kind = stringKind(base64.StdEncoding.EncodeToString(v))
@@ -1116,7 +3223,23 @@ func encodeValue(v interface{}) (*tspb.Value, *tspb.Type, error) {
 		}
 	case [][]byte:
 		if v != nil {
-			pb, err = encodeArray(len(v), func(i int) interface{} { return v[i] })
+			pb, err = encodeArrayWithOptions(len(v), func(i int) interface{} { return v[i] }, opts)
+			if err != nil {
+				return nil, nil, err
+			}
+			pt = listType(bytesType())
+		}
+	case NullBytes:
+		if v.Valid {
+			if v.Bytes == nil {
+				// A nil []byte encodes NULL, keep a valid empty value.
+				return encodeValueWithOptions([]byte{}, opts)
+			}
+			return encodeValueWithOptions(v.Bytes, opts)
+		}
+	case []NullBytes:
+		if v != nil {
+			pb, err = encodeArrayWithOptions(len(v), func(i int) interface{} { return v[i] }, opts)
 			if err != nil {
 				return nil, nil, err
 			}
@@ -1128,7 +3251,7 @@ func encodeValue(v interface{}) (*tspb.Value, *tspb.Type, error) {
 		pt = intType()
 	case []int:
 		if v != nil {
-			pb, err = encodeArray(len(v), func(i int) interface{} { return v[i] })
+			pb, err = encodeArrayWithOptions(len(v), func(i int) interface{} { return v[i] }, opts)
 			if err != nil {
 				return nil, nil, err
 			}
@@ -1140,7 +3263,7 @@ func encodeValue(v interface{}) (*tspb.Value, *tspb.Type, error) {
 		pt = intType()
 	case []int64:
 		if v != nil {
-			pb, err = encodeArray(len(v), func(i int) interface{} { return v[i] })
+			pb, err = encodeArrayWithOptions(len(v), func(i int) interface{} { return v[i] }, opts)
 			if err != nil {
 				return nil, nil, err
 			}
@@ -1148,22 +3271,68 @@ func encodeValue(v interface{}) (*tspb.Value, *tspb.Type, error) {
 		}
 	case NullInt64:
 		if v.Valid {
-			return encodeValue(v.Int64)
+			return encodeValueWithOptions(v.Int64, opts)
+		}
+	case int32:
+		return encodeValueWithOptions(int64(v), opts)
+	case int16:
+		return encodeValueWithOptions(int64(v), opts)
+	case int8:
+		return encodeValueWithOptions(int64(v), opts)
+	case uint64:
+		if v > math.MaxInt64 {
+			return nil, nil, errIntOverflow(v)
+		}
+		return encodeValueWithOptions(int64(v), opts)
+	case NullUint64:
+		if v.Valid {
+			return encodeValueWithOptions(v.Uint64, opts)
 		}
 	case []NullInt64:
 		if v != nil {
-			pb, err = encodeArray(len(v), func(i int) interface{} { return v[i] })
+			pb, err = encodeArrayWithOptions(len(v), func(i int) interface{} { return v[i] }, opts)
 			if err != nil {
 				return nil, nil, err
 			}
 			pt = listType(intType())
 		}
+	case time.Duration:
+		if opts.durationAsString() {
+			return encodeValueWithOptions(v.String(), opts)
+		}
+		return encodeValueWithOptions(int64(v), opts)
+	case NullDuration:
+		if v.Valid {
+			return encodeValueWithOptions(v.Duration, opts)
+		}
+	case []time.Duration:
+		if v != nil {
+			pb, err = encodeArrayWithOptions(len(v), func(i int) interface{} { return v[i] }, opts)
+			if err != nil {
+				return nil, nil, err
+			}
+			pt = listType(opts.durationType())
+		}
+	case []NullDuration:
+		if v != nil {
+			pb, err = encodeArrayWithOptions(len(v), func(i int) interface{} { return v[i] }, opts)
+			if err != nil {
+				return nil, nil, err
+			}
+			pt = listType(opts.durationType())
+		}
+	case NullArray:
+		switch v.ElementType {
+		case tspb.TypeCode_TYPE_CODE_UNSPECIFIED, tspb.TypeCode_ARRAY, tspb.TypeCode_STRUCT:
+			return nil, nil, errBadNullArrayElementType(v.ElementType)
+		}
+		pt = listType(&tspb.Type{Code: v.ElementType})
 	case bool:
 		pb.Kind = &tspb.Value_BoolValue{BoolValue: v}
 		pt = boolType()
 	case []bool:
 		if v != nil {
-			pb, err = encodeArray(len(v), func(i int) interface{} { return v[i] })
+			pb, err = encodeArrayWithOptions(len(v), func(i int) interface{} { return v[i] }, opts)
 			if err != nil {
 				return nil, nil, err
 			}
@@ -1171,11 +3340,11 @@ func encodeValue(v interface{}) (*tspb.Value, *tspb.Type, error) {
 		}
 	case NullBool:
 		if v.Valid {
-			return encodeValue(v.Bool)
+			return encodeValueWithOptions(v.Bool, opts)
 		}
 	case []NullBool:
 		if v != nil {
-			pb, err = encodeArray(len(v), func(i int) interface{} { return v[i] })
+			pb, err = encodeArrayWithOptions(len(v), func(i int) interface{} { return v[i] }, opts)
 			if err != nil {
 				return nil, nil, err
 			}
@@ -1186,7 +3355,7 @@ func encodeValue(v interface{}) (*tspb.Value, *tspb.Type, error) {
 		pt = floatType()
 	case []float64:
 		if v != nil {
-			pb, err = encodeArray(len(v), func(i int) interface{} { return v[i] })
+			pb, err = encodeArrayWithOptions(len(v), func(i int) interface{} { return v[i] }, opts)
 			if err != nil {
 				return nil, nil, err
 			}
@@ -1194,23 +3363,27 @@ func encodeValue(v interface{}) (*tspb.Value, *tspb.Type, error) {
 		}
 	case NullFloat64:
 		if v.Valid {
-			return encodeValue(v.Float64)
+			return encodeValueWithOptions(v.Float64, opts)
 		}
 	case []NullFloat64:
 		if v != nil {
-			pb, err = encodeArray(len(v), func(i int) interface{} { return v[i] })
+			pb, err = encodeArrayWithOptions(len(v), func(i int) interface{} { return v[i] }, opts)
 			if err != nil {
 				return nil, nil, err
 			}
 			pt = listType(floatType())
 		}
 	case time.Time:
+		if err := opts.checkTime(v); err != nil {
+			return nil, nil, err
+		}
+		v = opts.encodedTime(v)
 		// pb.Kind = stringKind(v.UTC().Format(time.RFC3339Nano))
 		pb.Kind = timeKind(v)
 		pt = timeType()
 	case []time.Time:
 		if v != nil {
-			pb, err = encodeArray(len(v), func(i int) interface{} { return v[i] })
+			pb, err = encodeTimeArray(len(v), func(i int) (time.Time, bool) { return v[i], true }, opts)
 			if err != nil {
 				return nil, nil, err
 			}
@@ -1218,11 +3391,11 @@ func encodeValue(v interface{}) (*tspb.Value, *tspb.Type, error) {
 		}
 	case NullTime:
 		if v.Valid {
-			return encodeValue(v.Time)
+			return encodeValueWithOptions(v.Time, opts)
 		}
 	case []NullTime:
 		if v != nil {
-			pb, err = encodeArray(len(v), func(i int) interface{} { return v[i] })
+			pb, err = encodeTimeArray(len(v), func(i int) (time.Time, bool) { return v[i].Time, v[i].Valid }, opts)
 			if err != nil {
 				return nil, nil, err
 			}
@@ -1230,39 +3403,500 @@ func encodeValue(v interface{}) (*tspb.Value, *tspb.Type, error) {
 		}
 	case civil.Date:
 		// pb.Kind = stringKind(v.String())
-		pb.Kind = DateKind(v)
-		pt = dateType()
+		pb, pt = opts.encodeDate(v)
 	case []civil.Date:
 		if v != nil {
-			pb, err = encodeArray(len(v), func(i int) interface{} { return v[i] })
+			pb, err = encodeArrayWithOptions(len(v), func(i int) interface{} { return v[i] }, opts)
 			if err != nil {
 				return nil, nil, err
 			}
-			pt = listType(dateType())
+			pt = listType(opts.dateType())
 		}
 	case NullDate:
 		if v.Valid {
-			return encodeValue(v.Date)
+			return encodeValueWithOptions(v.Date, opts)
 		}
 	case []NullDate:
 		if v != nil {
-			pb, err = encodeArray(len(v), func(i int) interface{} { return v[i] })
+			pb, err = encodeArrayWithOptions(len(v), func(i int) interface{} { return v[i] }, opts)
 			if err != nil {
 				return nil, nil, err
 			}
-			pt = listType(dateType())
+			pt = listType(opts.dateType())
+		}
+	case ForceNull:
+		// Only the type is kept, so options rejecting values don't apply,
+		// but those choosing the type do.
+		to := opts.typeOnly()
+		_, pt, err = encodeValueWithOptions(v.Value, to)
+		if err != nil {
+			return nil, nil, err
+		}
+		if pt == nil && v.Value != nil {
+			// An invalid Null type or a nil slice.
+			pt = nullFieldType(reflect.TypeOf(v.Value), to)
+		}
+		if pt == nil {
+			return nil, nil, errForceNullType(v)
 		}
 	case GenericColumnValue:
 		// Deep clone to ensure subsequent changes to v before
 		// transmission don't affect our encoded value.
 		pb = proto.Clone(v.Value).(*tspb.Value)
 		pt = proto.Clone(v.Type).(*tspb.Type)
+	case []interface{}:
+		if v != nil {
+			var et *tspb.Type
+			pb, et, err = encodeElementArray(len(v), func(i int) interface{} { return v[i] }, opts)
+			if err != nil {
+				return nil, nil, err
+			}
+			if et == nil {
+				return nil, nil, errUntypedArray(v)
+			}
+			pt = listType(et)
+		}
+	case []GenericColumnValue:
+		if v != nil {
+			if len(v) == 0 {
+				return nil, nil, errUntypedArray(v)
+			}
+			for i, e := range v {
+				if e.Type == nil {
+					return nil, nil, errNilSpannerType()
+				}
+				if e.Value == nil {
+					return nil, nil, errNilSrc()
+				}
+				if !proto.Equal(e.Type, v[0].Type) {
+					return nil, nil, errMixedArrayElementTypes(i, v[0].Type, e.Type)
+				}
+			}
+			pb, err = encodeArrayWithOptions(len(v), func(i int) interface{} { return v[i] }, opts)
+			if err != nil {
+				return nil, nil, err
+			}
+			pt = listType(proto.Clone(v[0].Type).(*tspb.Type))
+		}
 	default:
-		return nil, nil, errEncoderUnsupportedType(v)
+		// Go structs encode as STRUCT, pointers to structs as what they point
+		// to, so *NullInt64 is an INT64.
+		rv := reflect.ValueOf(v)
+		if rv.Kind() == reflect.Ptr && !rv.IsNil() && rv.Elem().Kind() == reflect.Struct {
+			return encodeValueWithOptions(rv.Elem().Interface(), opts)
+		}
+		if rv.Kind() == reflect.Struct {
+			return encodeStruct(v, opts)
+		}
+		// Slices of structs or struct pointers encode as ARRAY<STRUCT>.
+		if rv.Kind() == reflect.Slice && isStructOrStructPtr(rv.Type().Elem()) {
+			return encodeStructSlice(rv, opts)
+		}
+		// Typed nils encode as NULL.
+		if isTypedNil(v) {
+			return encodeTypedNil(v)
+		}
+		// Fall back to reflection for the other integer kinds, such as int32,
+		// uint16 or named integer types.
+		n, ok, err := reflectInt64(v)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !ok {
+			return nil, nil, errEncoderUnsupportedType(v)
+		}
+		pb.Kind = &tspb.Value_IntegerValue{IntegerValue: n}
+		pt = intType()
 	}
 	return pb, pt, nil
 }
 
+// errStructLayoutMismatch returns error for an array element encoded as a
+// STRUCT whose fields differ from those of the earlier elements.
+func errStructLayoutMismatch(i int, want, got *tspb.StructType) error {
+	field := func(fs []*tspb.StructType_Field, j int) string {
+		if j >= len(fs) {
+			return "no field"
+		}
+		return fmt.Sprintf("%q %v", fs[j].GetName(), sqlTypeName(fs[j].GetType()))
+	}
+	j := 0
+	for j < len(want.GetFields()) && j < len(got.GetFields()) && proto.Equal(want.Fields[j], got.Fields[j]) {
+		j++
+	}
+	return wrapError(codes.InvalidArgument,
+		"array element %d is a STRUCT with %s at field %d, want %s as in the earlier elements",
+		i, field(got.GetFields(), j), j, field(want.GetFields(), j))
+}
+
+// encodeElementArray encodes the n elements returned by at as an ARRAY, they
+// may be of different Go types, such as different struct types sharing their
+// layout, but must encode to the same type or be NULL. et is the element
+// type, nil if no element tells it.
+func encodeElementArray(n int, at func(int) interface{}, opts *EncodeOptions) (pb *tspb.Value, et *tspb.Type, err error) {
+	vs := make([]*tspb.Value, n)
+	for i := range vs {
+		var pt *tspb.Type
+		vs[i], pt, err = encodeValueWithOptions(at(i), opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch {
+		case pt == nil:
+			// An untyped NULL.
+		case et == nil:
+			et = pt
+		case !proto.Equal(pt, et):
+			if pt.Code == tspb.TypeCode_STRUCT && et.Code == tspb.TypeCode_STRUCT {
+				return nil, nil, errStructLayoutMismatch(i, et.StructType, pt.StructType)
+			}
+			return nil, nil, errMixedArrayElementTypes(i, et, pt)
+		}
+	}
+	return listProto(vs...), et, nil
+}
+
+// encodeStructSlice encodes rv, a slice of structs or struct pointers, as an
+// ARRAY<STRUCT>, nil pointers are NULL elements.
+func encodeStructSlice(rv reflect.Value, opts *EncodeOptions) (*tspb.Value, *tspb.Type, error) {
+	// The zero element types an empty or nil slice.
+	_, zt, err := encodeValueWithOptions(reflect.Zero(rv.Type().Elem()).Interface(), opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if rv.IsNil() {
+		return nullProto(), listType(zt), nil
+	}
+	pb, et, err := encodeElementArray(rv.Len(), func(i int) interface{} { return rv.Index(i).Interface() }, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if et == nil {
+		et = zt
+	}
+	return pb, listType(et), nil
+}
+
+// isStructOrStructPtr reports whether t is a struct type or a pointer to one.
+func isStructOrStructPtr(t reflect.Type) bool {
+	if t == nil {
+		return false
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
+// errEncodeStructField returns error for failure in encoding field f of a Go
+// struct.
+func errEncodeStructField(f string, err error) error {
+	se, ok := err.(*Error)
+	if !ok {
+		return wrapError(codes.InvalidArgument, "failed to encode struct field %q, error = <%v>", f, err)
+	}
+	se.decorate(fmt.Sprintf("failed to encode struct field %q", f))
+	return se
+}
+
+// encodeStruct encodes Go struct v as a STRUCT with a field for each column
+// the struct maps to, the way the *Struct mutations name them and decodeStruct
+// reads them back: unexported fields and fields tagged "-" are skipped, the
+// fields of embedded structs are promoted. Nested structs are encoded
+// recursively.
+func encodeStruct(v interface{}, opts *EncodeOptions) (*tspb.Value, *tspb.Type, error) {
+	rv := reflect.ValueOf(v)
+	fields, err := fieldCache.Fields(rv.Type())
+	if err != nil {
+		return nil, nil, err
+	}
+	st := &tspb.StructType{}
+	vals := make([]*tspb.Value, 0, len(fields))
+	for i := range fields {
+		f := &fields[i]
+		if isRawField(f) {
+			continue
+		}
+		fv := rv.FieldByIndex(f.Index)
+		pb, pt, err := encodeValueWithOptions(fv.Interface(), opts)
+		if err != nil {
+			return nil, nil, errEncodeStructField(f.Name, err)
+		}
+		if pt == nil {
+			// A NULL field, find its type for the STRUCT to be decodable.
+			pt = nullFieldType(fv.Type(), opts)
+		}
+		st.Fields = append(st.Fields, mkField(f.Name, pt))
+		vals = append(vals, pb)
+	}
+	return listProto(vals...), &tspb.Type{Code: tspb.TypeCode_STRUCT, StructType: st}, nil
+}
+
+// nullFieldType returns the type a NULL of Go type t would have if it was not
+// NULL, such as INT64 for NullInt64 or ARRAY<STRING> for []string, or nil if
+// it cannot be told. opts may choose the type, as DurationAsString does.
+func nullFieldType(t reflect.Type, opts *EncodeOptions) *tspb.Type {
+	var x reflect.Value
+	switch t.Kind() {
+	case reflect.Struct:
+		x = reflect.New(t).Elem()
+		valid := x.FieldByName("Valid")
+		if !valid.IsValid() || valid.Kind() != reflect.Bool {
+			return nil
+		}
+		valid.SetBool(true)
+	case reflect.Slice:
+		x = reflect.MakeSlice(t, 0, 0)
+	default:
+		return nil
+	}
+	_, pt, err := encodeValueWithOptions(x.Interface(), opts)
+	if err != nil {
+		return nil
+	}
+	return pt
+}
+
+// stringSetter is implemented by types which parse themselves from a string,
+// such as those implementing flag.Value.
+type stringSetter interface {
+	Set(string) error
+}
+
+// Encoder is implemented by types which encode themselves, choosing their own
+// column type, for example a money type stored as the decimal text of a
+// STRING. EncodeSpanner must return a non-nil value, its error is returned as
+// is. EncodeOptions don't apply to the result. A nil pointer implementing
+// Encoder is encoded as a NULL like other nil pointers.
+type Encoder interface {
+	EncodeSpanner() (*tspb.Value, *tspb.Type, error)
+}
+
+// errEncoderNilValue returns error for an Encoder returning a nil value.
+func errEncoderNilValue(v interface{}) error {
+	return wrapError(codes.FailedPrecondition, "EncodeSpanner of %T returned a nil value", v)
+}
+
+// Decoder is implemented by types which decode themselves from a column, for
+// example to unmarshal a BYTES column holding a serialized protobuf message.
+// A pointer implementing Decoder is passed every value, including NULL ones,
+// which can be told by IsNullValue, and its error is returned as is, or wrapped
+// with the field when decoding a struct.
+type Decoder interface {
+	DecodeSpanner(v *tspb.Value, t *tspb.Type) error
+}
+
+// PostDecoder is implemented by Go structs which check or normalize
+// themselves once decoded, for example to enforce invariants spanning several
+// fields. PostDecode is called on a pointer to the struct after all of its
+// columns are decoded by Row.ToStruct and the like, including nested STRUCT
+// columns, and its error is returned as is.
+type PostDecoder interface {
+	PostDecode() error
+}
+
+// callPostDecoder calls PostDecode on ptr, a pointer to a decoded struct, if it
+// implements PostDecoder.
+func callPostDecoder(ptr interface{}) error {
+	if pd, ok := ptr.(PostDecoder); ok {
+		return pd.PostDecode()
+	}
+	return nil
+}
+
+// EnumValidator is implemented by integer enum types which can tell whether
+// they hold a known ordinal. Decoding an INT64 into such a type fails if Valid
+// reports false afterwards.
+type EnumValidator interface {
+	Valid() bool
+}
+
+// errIntOverflowDst returns error for an INT64 not fitting an integer kind.
+func errIntOverflowDst(v *tspb.Value, t reflect.Type) error {
+	return wrapError(codes.OutOfRange, "%v overflows %v", v, t)
+}
+
+// errInvalidEnum returns error for an INT64 which isn't a valid enum ordinal.
+func errInvalidEnum(v *tspb.Value, t reflect.Type) error {
+	return wrapError(codes.OutOfRange, "%v is not a valid %v", v, t)
+}
+
+// isIntegerKind reports whether k is one of the signed or unsigned integer
+// kinds.
+func isIntegerKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+// setIntegerKind stores x decoded from v in the integer ptr points to, and
+// checks the result with Valid if it is an EnumValidator.
+func setIntegerKind(ptr reflect.Value, x int64, v *tspb.Value) error {
+	dst := ptr.Elem()
+	switch dst.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if dst.OverflowInt(x) {
+			return errIntOverflowDst(v, dst.Type())
+		}
+		dst.SetInt(x)
+	default:
+		if x < 0 || dst.OverflowUint(uint64(x)) {
+			return errIntOverflowDst(v, dst.Type())
+		}
+		dst.SetUint(uint64(x))
+	}
+	if ev, ok := ptr.Interface().(EnumValidator); ok && !ev.Valid() {
+		return errInvalidEnum(v, dst.Type())
+	}
+	return nil
+}
+
+// errIntOverflow returns error for an unsigned integer too large for INT64.
+func errIntOverflow(v interface{}) error {
+	return wrapError(codes.InvalidArgument, "%T value %v overflows INT64", v, v)
+}
+
+// reflectInt64 converts v of any integer kind to int64, ok is false if v
+// isn't an integer.
+func reflectInt64(v interface{}) (n int64, ok bool, err error) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := rv.Uint()
+		if u > math.MaxInt64 {
+			return 0, true, errIntOverflow(v)
+		}
+		return int64(u), true, nil
+	}
+	return 0, false, nil
+}
+
+// errParseValue returns error for text that can't be parsed as the given type.
+func errParseValue(s string, t *tspb.Type, err error) error {
+	return wrapError(codes.InvalidArgument, "cannot parse %q as %v: <%v>", s, t.GetCode(), err)
+}
+
+// ValueFromString parses the text s as a value of type t and returns its
+// encoded form, which is useful for building parameters from user input.
+// The literal NULL stands for a NULL value of any type. BYTES are expected
+// in standard base64 encoding, TIMESTAMP in RFC 3339 and DATE as YYYY-MM-DD.
+// ARRAY and STRUCT types are not supported.
+func ValueFromString(s string, t *tspb.Type) (*tspb.Value, error) {
+	if t == nil {
+		return nil, errNilSpannerType()
+	}
+	if s == "NULL" {
+		return nullProto(), nil
+	}
+	var (
+		x   interface{}
+		err error
+	)
+	switch t.Code {
+	case tspb.TypeCode_STRING:
+		x = s
+	case tspb.TypeCode_BYTES:
+		x, err = base64.StdEncoding.DecodeString(s)
+	case tspb.TypeCode_INT64:
+		x, err = strconv.ParseInt(s, 10, 64)
+	case tspb.TypeCode_FLOAT64:
+		x, err = strconv.ParseFloat(s, 64)
+	case tspb.TypeCode_BOOL:
+		x, err = strconv.ParseBool(s)
+	case tspb.TypeCode_TIMESTAMP:
+		x, err = parseTimestamp(s)
+	case tspb.TypeCode_DATE:
+		x, err = civil.ParseDate(s)
+	default:
+		return nil, wrapError(codes.InvalidArgument, "cannot parse %q as unsupported type %v", s, t.Code)
+	}
+	if err != nil {
+		return nil, errParseValue(s, t, err)
+	}
+	v, _, err := encodeValue(x)
+	return v, err
+}
+
+// errBatchValueType returns error for a value of a column batch with a type
+// other than the column type.
+func errBatchValueType(i int, want, got *tspb.Type) error {
+	return wrapError(codes.InvalidArgument, "batch value %d has type %v, want %v", i, got, want)
+}
+
+// errEncodeBatchValue returns error for not being able to encode a value of a
+// column batch.
+func errEncodeBatchValue(i int, err error) error {
+	se, ok := err.(*Error)
+	if !ok {
+		return wrapError(codes.InvalidArgument, "failed to encode batch value %d, error = <%v>", i, err)
+	}
+	se.decorate(fmt.Sprintf("failed to encode batch value %d", i))
+	return se
+}
+
+// EncodeColumnBatch encodes values, which must all be of column type t or
+// NULL, for example a column of many rows to insert. The common Go types of
+// scalar columns are encoded without going through the full type switch of
+// encodeValue for every value.
+func EncodeColumnBatch(t *tspb.Type, values []interface{}) ([]*tspb.Value, error) {
+	if t == nil {
+		return nil, errNilSpannerType()
+	}
+	out := make([]*tspb.Value, len(values))
+	for i, x := range values {
+		if pb := encodeBatchValue(t.Code, x); pb != nil {
+			out[i] = pb
+			continue
+		}
+		pb, pt, err := encodeValue(x)
+		if err != nil {
+			return nil, errEncodeBatchValue(i, err)
+		}
+		// NULL values have no type.
+		if pt != nil && !proto.Equal(pt, t) {
+			return nil, errBatchValueType(i, t, pt)
+		}
+		out[i] = pb
+	}
+	return out, nil
+}
+
+// encodeBatchValue encodes x if it has the Go type most commonly used for
+// column type code, otherwise it returns nil.
+func encodeBatchValue(code tspb.TypeCode, x interface{}) *tspb.Value {
+	switch code {
+	case tspb.TypeCode_INT64:
+		switch v := x.(type) {
+		case int64:
+			return &tspb.Value{Kind: &tspb.Value_IntegerValue{IntegerValue: v}}
+		case int:
+			return &tspb.Value{Kind: &tspb.Value_IntegerValue{IntegerValue: int64(v)}}
+		}
+	case tspb.TypeCode_STRING:
+		if v, ok := x.(string); ok {
+			return &tspb.Value{Kind: stringKind(v)}
+		}
+	case tspb.TypeCode_FLOAT64:
+		if v, ok := x.(float64); ok {
+			return &tspb.Value{Kind: &tspb.Value_NumberValue{NumberValue: v}}
+		}
+	case tspb.TypeCode_BOOL:
+		if v, ok := x.(bool); ok {
+			return &tspb.Value{Kind: &tspb.Value_BoolValue{BoolValue: v}}
+		}
+	case tspb.TypeCode_BYTES:
+		if v, ok := x.([]byte); ok && v != nil {
+			return &tspb.Value{Kind: bytesKind(v)}
+		}
+	}
+	return nil
+}
+
 // 将原生数组 encode 为 list
 // encodeValueArray encodes a Value array into a tspb.ListValue.
 func encodeValueArray(vs []interface{}) (*tspb.ListValue, error) {
@@ -1281,10 +3915,16 @@ func encodeValueArray(vs []interface{}) (*tspb.ListValue, error) {
 // 前提是数组各元素都能 encode
 // encodeArray assumes that all values of the array element type encode without error.
 func encodeArray(len int, at func(int) interface{}) (*tspb.Value, error) {
+	return encodeArrayWithOptions(len, at, nil)
+}
+
+// encodeArrayWithOptions is encodeArray with the elements encoded according
+// to opts.
+func encodeArrayWithOptions(len int, at func(int) interface{}, opts *EncodeOptions) (*tspb.Value, error) {
 	vs := make([]*tspb.Value, len)
 	var err error
 	for i := 0; i < len; i++ {
-		vs[i], _, err = encodeValue(at(i))
+		vs[i], _, err = encodeValueWithOptions(at(i), opts)
 		if err != nil {
 			return nil, err
 		}
@@ -1292,6 +3932,33 @@ func encodeArray(len int, at func(int) interface{}) (*tspb.Value, error) {
 	return listProto(vs...), nil
 }
 
+// encodeTimeArray encodes an ARRAY<TIMESTAMP> of n elements, at returns
+// element i and false if it is NULL. It encodes as encodeValueWithOptions
+// would, but allocates the element values in a few blocks rather than one
+// by one.
+func encodeTimeArray(n int, at func(int) (time.Time, bool), opts *EncodeOptions) (*tspb.Value, error) {
+	vs := make([]*tspb.Value, n)
+	vals := make([]tspb.Value, n)
+	kinds := make([]tspb.Value_TimestampValue, n)
+	tss := make([]types.Timestamp, n)
+	for i := range vs {
+		t, ok := at(i)
+		if !ok {
+			vs[i] = nullProto()
+			continue
+		}
+		if err := opts.checkTime(t); err != nil {
+			return nil, err
+		}
+		t = opts.encodedTime(t)
+		tss[i] = types.Timestamp{Seconds: t.Unix(), Nanos: int32(t.UnixNano() % 1e9)}
+		kinds[i].TimestampValue = &tss[i]
+		vals[i].Kind = &kinds[i]
+		vs[i] = &vals[i]
+	}
+	return listProto(vs...), nil
+}
+
 func spannerTagParser(t reflect.StructTag) (name string, keep bool, other interface{}, err error) {
 	if s := t.Get("spanner"); s != "" {
 		if s == "-" {
@@ -1302,19 +3969,159 @@ func spannerTagParser(t reflect.StructTag) (name string, keep bool, other interf
 	return "", true, nil, nil
 }
 
+// zettaTag is the extra data zettaTagParser keeps for a field.
+type zettaTag struct {
+	// raw marks a field tagged `column:",raw"`, which receives the raw
+	// values of the row instead of a column.
+	raw bool
+	// def is the value given with `column:"name,default=..."`, stored in the
+	// field when its column is NULL or absent, if hasDef is set.
+	def    string
+	hasDef bool
+	// nullable marks a pointer field tagged `column:"name,nullable"`, written
+	// as a NULL of its target type when the pointer is nil.
+	nullable bool
+}
+
+// isNullableField reports whether f is tagged nullable.
+func isNullableField(f *fields.Field) bool {
+	tag, ok := f.ParsedTag.(zettaTag)
+	return ok && tag.nullable
+}
+
+// isRawField reports whether f receives the raw values of a row.
+func isRawField(f *fields.Field) bool {
+	tag, ok := f.ParsedTag.(zettaTag)
+	return ok && tag.raw
+}
+
+// hasFieldDefault reports whether f has a default value for NULL or absent
+// columns.
+func hasFieldDefault(f *fields.Field) bool {
+	tag, ok := f.ParsedTag.(zettaTag)
+	return ok && tag.hasDef
+}
+
+// errBadFieldDefault returns error for a default value which cannot be stored
+// in a field of type t.
+func errBadFieldDefault(t reflect.Type, def string, err error) error {
+	if err != nil {
+		return wrapError(codes.InvalidArgument, "default value %q is not a valid %v: <%v>", def, t, err)
+	}
+	return wrapError(codes.InvalidArgument, "default values are not supported for fields of type %v", t)
+}
+
+// setFieldDefault stores the default value of f in fv. Defaults are supported
+// for string, bool, integer and floating point fields and for NullString,
+// NullBool, NullInt64 and NullFloat64, which become valid.
+func setFieldDefault(fv reflect.Value, f *fields.Field) error {
+	def := f.ParsedTag.(zettaTag).def
+	switch p := fv.Addr().Interface().(type) {
+	case *NullString:
+		*p = NullString{def, true}
+		return nil
+	case *NullBool:
+		x, err := strconv.ParseBool(def)
+		if err != nil {
+			return errBadFieldDefault(fv.Type(), def, err)
+		}
+		*p = NullBool{x, true}
+		return nil
+	case *NullInt64:
+		x, err := strconv.ParseInt(def, 10, 64)
+		if err != nil {
+			return errBadFieldDefault(fv.Type(), def, err)
+		}
+		*p = NullInt64{x, true}
+		return nil
+	case *NullFloat64:
+		x, err := strconv.ParseFloat(def, 64)
+		if err != nil {
+			return errBadFieldDefault(fv.Type(), def, err)
+		}
+		*p = NullFloat64{x, true}
+		return nil
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(def)
+	case reflect.Bool:
+		x, err := strconv.ParseBool(def)
+		if err != nil {
+			return errBadFieldDefault(fv.Type(), def, err)
+		}
+		fv.SetBool(x)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		x, err := strconv.ParseInt(def, 10, fv.Type().Bits())
+		if err != nil {
+			return errBadFieldDefault(fv.Type(), def, err)
+		}
+		fv.SetInt(x)
+	case reflect.Float32, reflect.Float64:
+		x, err := strconv.ParseFloat(def, fv.Type().Bits())
+		if err != nil {
+			return errBadFieldDefault(fv.Type(), def, err)
+		}
+		fv.SetFloat(x)
+	default:
+		return errBadFieldDefault(fv.Type(), def, nil)
+	}
+	return nil
+}
+
+// setAbsentFieldDefaults stores the default values of the fields in list
+// with one whose names are not in decoded, as their columns are absent.
+func setAbsentFieldDefaults(v reflect.Value, list fields.List, decoded map[string]bool) error {
+	for i := range list {
+		f := &list[i]
+		if !hasFieldDefault(f) || decoded[f.Name] {
+			continue
+		}
+		if err := setFieldDefault(v.FieldByIndex(f.Index), f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func zettaTagParser(t reflect.StructTag) (name string, keep bool, other interface{}, err error) {
-	family := t.Get("family")
-	column := t.Get("column")
+	family, hasFamily := t.Lookup("family")
+	column, hasColumn := t.Lookup("column")
+	if !hasFamily && !hasColumn {
+		// Fall back to the `spanner` tag of structs shared with Cloud
+		// Spanner, the zetta tags win when both are present.
+		return spannerTagParser(t)
+	}
+	if column == ",raw" {
+		return "", true, zettaTag{raw: true}, nil
+	}
+	if i := strings.IndexByte(column, ','); i >= 0 {
+		// Options follow the name, a default value takes the rest of the tag
+		// as it may contain commas.
+		var tag zettaTag
+		for opts := column[i+1:]; opts != ""; {
+			if strings.HasPrefix(opts, "default=") {
+				tag.def, tag.hasDef = opts[len("default="):], true
+				break
+			}
+			var opt string
+			opt, opts, _ = strings.Cut(opts, ",")
+			if opt == "nullable" {
+				tag.nullable = true
+			}
+		}
+		other, column = tag, column[:i]
+	}
 	if column != "" {
 		if column == "-" {
 			return "", false, nil, nil
 		}
 		if family != "" {
-			return family + ":" + column, true, nil, nil
+			return family + ":" + column, true, other, nil
 		}
-		return column, true, nil, nil
+		return column, true, other, nil
 	}
-	return "", true, nil, nil
+	return "", true, other, nil
 }
 
 var fieldCache = fields.NewCache(zettaTagParser, nil, nil)
@@ -0,0 +1,116 @@
+// Copyright 2020 Zhizhesihai (Beijing) Technology Limited.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zetta
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"math"
+	"strings"
+
+	tspb "github.com/zhihu/zetta-proto/pkg/tablestore"
+)
+
+// CSVOptions tunes how WriteRowsCSV renders rows. The zero value writes comma
+// separated values, NULL as an empty field and ARRAYs as JSON arrays.
+type CSVOptions struct {
+	// Comma is the field delimiter, ',' if zero.
+	Comma rune
+	// NullToken is written for NULL columns and NULL array elements joined
+	// with ArrayDelimiter.
+	NullToken string
+	// ArrayDelimiter, if set, joins the elements of ARRAY columns, otherwise
+	// they are written as JSON arrays, with NULL elements as null.
+	ArrayDelimiter string
+}
+
+// WriteRowsCSV writes rows of a result set with the given fields to w as CSV,
+// a header of the field names followed by a record per row. Values are
+// rendered as by Row.ColumnString, fields are quoted as needed.
+func WriteRowsCSV(w io.Writer, fields []*tspb.StructType_Field, rows []*tspb.ListValue, opts CSVOptions) error {
+	cw := csv.NewWriter(w)
+	if opts.Comma != 0 {
+		cw.Comma = opts.Comma
+	}
+	record := make([]string, len(fields))
+	for i, f := range fields {
+		record[i] = f.Name
+	}
+	if err := cw.Write(record); err != nil {
+		return err
+	}
+	for i, row := range rows {
+		if len(row.GetValues()) != len(fields) {
+			return errDecodeResultRow(i, errResultRowWidth(len(row.GetValues()), len(fields)))
+		}
+		for j, v := range row.Values {
+			x, err := decodeInterface(v, fields[j].Type)
+			if err != nil {
+				return errDecodeResultRow(i, errDecodeColumn(j, err))
+			}
+			if record[j], err = opts.csvString(x); err != nil {
+				return errDecodeResultRow(i, errDecodeColumn(j, err))
+			}
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvString formats x as returned by decodeInterface for a CSV field.
+func (opts *CSVOptions) csvString(x interface{}) (string, error) {
+	switch v := x.(type) {
+	case nil:
+		return opts.NullToken, nil
+	case []interface{}:
+		if opts.ArrayDelimiter != "" {
+			elems := make([]string, len(v))
+			for i, e := range v {
+				if e == nil {
+					elems[i] = opts.NullToken
+				} else {
+					elems[i] = displayString(e, false)
+				}
+			}
+			return strings.Join(elems, opts.ArrayDelimiter), nil
+		}
+		elems := make([]interface{}, len(v))
+		for i, e := range v {
+			switch e := e.(type) {
+			case nil, bool, int64:
+				elems[i] = e
+			case float64:
+				if math.IsNaN(e) || math.IsInf(e, 0) {
+					// JSON has no numbers for them.
+					elems[i] = displayString(e, false)
+				} else {
+					elems[i] = e
+				}
+			default:
+				elems[i] = displayString(e, false)
+			}
+		}
+		b, err := json.Marshal(elems)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	default:
+		return displayString(x, false), nil
+	}
+}
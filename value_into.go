@@ -0,0 +1,176 @@
+// Copyright 2020 Zhizhesihai (Beijing) Technology Limited.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zetta
+
+import (
+	tspb "github.com/zhihu/zetta-proto/pkg/tablestore"
+)
+
+// The DecodeXxxArrayInto functions decode the elements of an ARRAY into the
+// slice *dst, reusing its backing array when it has the capacity and growing
+// it otherwise, so that decoding rows in a loop needn't allocate for every
+// row. On error *dst keeps its length, but its elements may have been
+// overwritten.
+
+// DecodeIntArrayInto decodes an ARRAY<INT64> into *dst.
+func DecodeIntArrayInto(pb *tspb.ListValue, dst *[]NullInt64) error {
+	if dst == nil {
+		return errNilDst(dst)
+	}
+	if pb == nil {
+		return errNilListValue("INT64")
+	}
+	a := *dst
+	if cap(a) < len(pb.Values) {
+		a = make([]NullInt64, len(pb.Values))
+	}
+	a = a[:len(pb.Values)]
+	if err := decodeArrayInto(pb, intType(), "INT64", func(i int) interface{} { return &a[i] }); err != nil {
+		return err
+	}
+	*dst = a
+	return nil
+}
+
+// DecodeFloatArrayInto decodes an ARRAY<FLOAT64> into *dst.
+func DecodeFloatArrayInto(pb *tspb.ListValue, dst *[]NullFloat64) error {
+	if dst == nil {
+		return errNilDst(dst)
+	}
+	if pb == nil {
+		return errNilListValue("FLOAT64")
+	}
+	a := *dst
+	if cap(a) < len(pb.Values) {
+		a = make([]NullFloat64, len(pb.Values))
+	}
+	a = a[:len(pb.Values)]
+	if err := decodeArrayInto(pb, floatType(), "FLOAT64", func(i int) interface{} { return &a[i] }); err != nil {
+		return err
+	}
+	*dst = a
+	return nil
+}
+
+// DecodeBoolArrayInto decodes an ARRAY<BOOL> into *dst.
+func DecodeBoolArrayInto(pb *tspb.ListValue, dst *[]NullBool) error {
+	if dst == nil {
+		return errNilDst(dst)
+	}
+	if pb == nil {
+		return errNilListValue("BOOL")
+	}
+	a := *dst
+	if cap(a) < len(pb.Values) {
+		a = make([]NullBool, len(pb.Values))
+	}
+	a = a[:len(pb.Values)]
+	if err := decodeArrayInto(pb, boolType(), "BOOL", func(i int) interface{} { return &a[i] }); err != nil {
+		return err
+	}
+	*dst = a
+	return nil
+}
+
+// DecodeStringArrayInto decodes an ARRAY<STRING> into *dst.
+func DecodeStringArrayInto(pb *tspb.ListValue, dst *[]NullString) error {
+	if dst == nil {
+		return errNilDst(dst)
+	}
+	if pb == nil {
+		return errNilListValue("STRING")
+	}
+	a := *dst
+	if cap(a) < len(pb.Values) {
+		a = make([]NullString, len(pb.Values))
+	}
+	a = a[:len(pb.Values)]
+	if err := decodeArrayInto(pb, stringType(), "STRING", func(i int) interface{} { return &a[i] }); err != nil {
+		return err
+	}
+	*dst = a
+	return nil
+}
+
+// DecodeBytesArrayInto decodes an ARRAY<BYTES> into *dst. Only the outer
+// slice is reused, the elements refer to the bytes of pb.
+func DecodeBytesArrayInto(pb *tspb.ListValue, dst *[][]byte) error {
+	if dst == nil {
+		return errNilDst(dst)
+	}
+	if pb == nil {
+		return errNilListValue("BYTES")
+	}
+	a := *dst
+	if cap(a) < len(pb.Values) {
+		a = make([][]byte, len(pb.Values))
+	}
+	a = a[:len(pb.Values)]
+	if err := decodeArrayInto(pb, bytesType(), "BYTES", func(i int) interface{} { return &a[i] }); err != nil {
+		return err
+	}
+	*dst = a
+	return nil
+}
+
+// DecodeTimeArrayInto decodes an ARRAY<TIMESTAMP> into *dst.
+func DecodeTimeArrayInto(pb *tspb.ListValue, dst *[]NullTime) error {
+	if dst == nil {
+		return errNilDst(dst)
+	}
+	if pb == nil {
+		return errNilListValue("TIMESTAMP")
+	}
+	a := *dst
+	if cap(a) < len(pb.Values) {
+		a = make([]NullTime, len(pb.Values))
+	}
+	a = a[:len(pb.Values)]
+	if err := decodeArrayInto(pb, timeType(), "TIMESTAMP", func(i int) interface{} { return &a[i] }); err != nil {
+		return err
+	}
+	*dst = a
+	return nil
+}
+
+// DecodeDateArrayInto decodes an ARRAY<DATE> into *dst.
+func DecodeDateArrayInto(pb *tspb.ListValue, dst *[]NullDate) error {
+	if dst == nil {
+		return errNilDst(dst)
+	}
+	if pb == nil {
+		return errNilListValue("DATE")
+	}
+	a := *dst
+	if cap(a) < len(pb.Values) {
+		a = make([]NullDate, len(pb.Values))
+	}
+	a = a[:len(pb.Values)]
+	if err := decodeArrayInto(pb, dateType(), "DATE", func(i int) interface{} { return &a[i] }); err != nil {
+		return err
+	}
+	*dst = a
+	return nil
+}
+
+// decodeArrayInto decodes the elements of pb, of type t named sqlType, into
+// the destinations returned by elem.
+func decodeArrayInto(pb *tspb.ListValue, t *tspb.Type, sqlType string, elem func(i int) interface{}) error {
+	for i, v := range pb.Values {
+		if err := decodeValue(v, t, elem(i)); err != nil {
+			return errDecodeArrayElement(i, v, sqlType, err)
+		}
+	}
+	return nil
+}
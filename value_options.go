@@ -0,0 +1,376 @@
+// Copyright 2020 Zhizhesihai (Beijing) Technology Limited.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zetta
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"github.com/sunxiaoguang/zetta-client-go/internal/fields"
+	tspb "github.com/zhihu/zetta-proto/pkg/tablestore"
+)
+
+// TagParser interprets the tag of a Go struct field. It returns the column
+// name given by the tag, whether the field should be kept at all, extra data
+// parsed from the tag and an error for malformed tags.
+type TagParser func(t reflect.StructTag) (name string, keep bool, other interface{}, err error)
+
+// ZettaTagParser is a TagParser which maps fields by their `family` and
+// `column` tags, or by their `spanner` tags if they have neither, it is the
+// convention used by default.
+func ZettaTagParser(t reflect.StructTag) (name string, keep bool, other interface{}, err error) {
+	return zettaTagParser(t)
+}
+
+// SpannerTagParser is a TagParser which maps fields by their `spanner` tags.
+func SpannerTagParser(t reflect.StructTag) (name string, keep bool, other interface{}, err error) {
+	return spannerTagParser(t)
+}
+
+// FieldCache remembers how the fields of Go struct types map to column names.
+// A FieldCache is safe for use by multiple goroutines. Struct types built at
+// runtime with reflect.StructOf are cached as well, identical definitions
+// yield the same reflect.Type and so share an entry.
+type FieldCache struct {
+	cache  *fields.Cache
+	parser TagParser
+}
+
+// NewFieldCache returns a FieldCache which names struct fields with parser.
+func NewFieldCache(parser TagParser) *FieldCache {
+	return &FieldCache{cache: fields.NewCache(fields.ParseTagFunc(parser), nil, nil), parser: parser}
+}
+
+// Invalidate drops the mapping cached for the struct type t, so it is parsed
+// again with the tag parser on next use. It is needed only if the parser
+// of c changes its results at runtime, for example when it consults a
+// configuration which has been reloaded.
+func (c *FieldCache) Invalidate(t reflect.Type) {
+	c.cache.Invalidate(t)
+}
+
+// Clear drops the mappings cached for all struct types, see Invalidate.
+func (c *FieldCache) Clear() {
+	c.cache.Clear()
+}
+
+// InvalidateFieldCache drops the mapping of the struct type t cached by the
+// package level cache used when no FieldCache is given. Field mappings never
+// change for a type defined at compile time, so this is only needed to
+// release a type, or after the way tags are parsed has changed, see
+// FieldCache.Invalidate.
+func InvalidateFieldCache(t reflect.Type) {
+	fieldCache.Invalidate(t)
+}
+
+// ClearFieldCache drops every mapping of the package level field cache, see
+// InvalidateFieldCache.
+func ClearFieldCache() {
+	fieldCache.Clear()
+}
+
+// DuplicateColumnPolicy tells how decoding into a struct handles a column
+// name which appears more than once in a row.
+type DuplicateColumnPolicy int
+
+const (
+	// DuplicateColumnError fails the decoding, it is the default.
+	DuplicateColumnError DuplicateColumnPolicy = iota
+	// DuplicateColumnFirst decodes the first column with the name and
+	// ignores the later ones.
+	DuplicateColumnFirst
+	// DuplicateColumnLast decodes every column with the name in order, so
+	// the struct field ends up holding the last one.
+	DuplicateColumnLast
+)
+
+// DecodeOptions tunes how values are decoded into Go variables. The zero
+// value decodes exactly as Row.ToStruct and GenericColumnValue.Decode do.
+type DecodeOptions struct {
+	// FieldCache maps columns to Go struct fields, nil uses the package level
+	// cache built with ZettaTagParser.
+	FieldCache *FieldCache
+	// NumericCoercion allows INT64 values to be decoded into float64 and
+	// NullFloat64, and FLOAT64 values holding integral numbers into int64 and
+	// NullInt64. Non-integral or out of range FLOAT64 values are rejected.
+	NumericCoercion bool
+	// PostDecode, if set, is called with the column name and the addressable
+	// struct field after each column is decoded by Row.ToStructWithOptions,
+	// so it may normalize or validate the value. A returned error aborts the
+	// decoding.
+	PostDecode func(column string, v reflect.Value) error
+	// TimestampsAsEpochMillis allows ARRAY<TIMESTAMP> values to be decoded
+	// into []int64 as milliseconds since the Unix epoch. Without it []int64
+	// only holds ARRAY<INT64>.
+	TimestampsAsEpochMillis bool
+	// NullEpochMillis is stored for NULL elements when an ARRAY<TIMESTAMP> is
+	// decoded into []int64 milliseconds since the Unix epoch, nil rejects
+	// NULL elements.
+	NullEpochMillis *int64
+	// StrictFloat32 rejects ARRAY<FLOAT64> elements which overflow to ±Inf
+	// when decoded into []float32, instead of storing the infinity.
+	StrictFloat32 bool
+	// StrictUnexported makes decoding into a struct fail up front if a column
+	// has no exported field but matches an unexported one, which is always
+	// skipped, instead of reporting the column as unknown.
+	StrictUnexported bool
+	// Location, if set, is applied to every decoded TIMESTAMP, including the
+	// elements of ARRAY<TIMESTAMP> decoded into []time.Time or []NullTime.
+	// Otherwise times keep the offset they were encoded with.
+	Location *time.Location
+	// DuplicateColumnPolicy chooses which of several columns with the same
+	// name is decoded into a struct field.
+	DuplicateColumnPolicy DuplicateColumnPolicy
+	// NaNAsNull decodes a FLOAT64 NaN into an invalid NullFloat64, including
+	// the elements of ARRAY<FLOAT64> decoded into []NullFloat64, for data
+	// which uses NaN to mark missing values.
+	NaNAsNull bool
+	// ValidateJSON rejects STRING values decoded into json.RawMessage which
+	// are not valid JSON. By default the raw text is passed through unchecked.
+	ValidateJSON bool
+	// IntBoolCoercion allows INT64 columns holding 0 or 1, such as legacy
+	// boolean flags, to be decoded into bool and NullBool, and ARRAY<INT64>
+	// into []NullBool. NULL decodes to an invalid NullBool, other integers are
+	// rejected.
+	IntBoolCoercion bool
+	// BigFloatPrec is the precision in bits of big.Float values decoded from
+	// FLOAT64. Zero keeps the precision of the destination, or 53 if it has
+	// none, which is exact for a FLOAT64.
+	BigFloatPrec uint
+	// RejectUnexpectedNull makes decoding into a struct go on past NULL
+	// columns whose fields can't hold NULL, such as a string or an int64,
+	// and fail with a single error naming all of them, rather than with the
+	// first one.
+	RejectUnexpectedNull bool
+	// Profiler, if set, is called with the column name and the time taken
+	// after each column is decoded into a struct field, to find the columns
+	// which are expensive to decode. The fields of nested STRUCTs are reported
+	// too, before the column holding them. Nil costs nothing.
+	Profiler func(column string, d time.Duration)
+}
+
+// fieldCache returns the struct field cache to use, opts may be nil.
+func (opts *DecodeOptions) fieldCache() *fields.Cache {
+	if opts == nil || opts.FieldCache == nil {
+		return fieldCache
+	}
+	return opts.FieldCache.cache
+}
+
+// tagParser returns the parser naming struct fields, opts may be nil.
+func (opts *DecodeOptions) tagParser() TagParser {
+	if opts == nil || opts.FieldCache == nil {
+		return ZettaTagParser
+	}
+	return opts.FieldCache.parser
+}
+
+// inLocation returns t in opts.Location, or t as is without a location.
+func (opts *DecodeOptions) inLocation(t time.Time) time.Time {
+	if opts == nil || opts.Location == nil {
+		return t
+	}
+	return t.In(opts.Location)
+}
+
+// duplicateColumnPolicy returns the policy for duplicated columns, opts may
+// be nil.
+func (opts *DecodeOptions) duplicateColumnPolicy() DuplicateColumnPolicy {
+	if opts == nil {
+		return DuplicateColumnError
+	}
+	return opts.DuplicateColumnPolicy
+}
+
+// nanAsNull reports whether NaN decodes to an invalid NullFloat64.
+func (opts *DecodeOptions) nanAsNull() bool {
+	return opts != nil && opts.NaNAsNull
+}
+
+// timestampsAsEpochMillis reports whether ARRAY<TIMESTAMP> may be decoded into
+// []int64 milliseconds since the Unix epoch.
+func (opts *DecodeOptions) timestampsAsEpochMillis() bool {
+	return opts != nil && opts.TimestampsAsEpochMillis
+}
+
+// validatesJSON reports whether text decoded into json.RawMessage must be
+// valid JSON.
+func (opts *DecodeOptions) validatesJSON() bool {
+	return opts != nil && opts.ValidateJSON
+}
+
+// bigFloatPrec returns the precision of decoded big.Float values, zero for
+// the default.
+func (opts *DecodeOptions) bigFloatPrec() uint {
+	if opts == nil {
+		return 0
+	}
+	return opts.BigFloatPrec
+}
+
+// coercesNumeric reports whether a value of type code may be decoded into a
+// Go variable of the other numeric type.
+func (opts *DecodeOptions) coercesNumeric(code tspb.TypeCode) bool {
+	return opts != nil && opts.NumericCoercion &&
+		(code == tspb.TypeCode_INT64 || code == tspb.TypeCode_FLOAT64)
+}
+
+// coercesIntBool reports whether a value of type code may be decoded into a
+// bool or NullBool as 0 or 1.
+func (opts *DecodeOptions) coercesIntBool(code tspb.TypeCode) bool {
+	return opts != nil && opts.IntBoolCoercion && code == tspb.TypeCode_INT64
+}
+
+// rejectUnexpectedNull returns true if NULL columns for fields which can't
+// hold NULL are to be collected, opts may be nil.
+func (opts *DecodeOptions) rejectUnexpectedNull() bool {
+	return opts != nil && opts.RejectUnexpectedNull
+}
+
+// profiling returns true if column decoding times are reported, opts may be
+// nil.
+func (opts *DecodeOptions) profiling() bool {
+	return opts != nil && opts.Profiler != nil
+}
+
+// postDecode runs the PostDecode hook, if any, on a decoded struct field.
+func (opts *DecodeOptions) postDecode(column string, v reflect.Value) error {
+	if opts == nil || opts.PostDecode == nil {
+		return nil
+	}
+	return opts.PostDecode(column, v)
+}
+
+// DateEncoding chooses how civil.Date values are encoded.
+type DateEncoding int
+
+const (
+	// DateEncodingTimestamp encodes a DATE as the timestamp of its local
+	// midnight, it is the default.
+	DateEncodingTimestamp DateEncoding = iota
+	// DateEncodingString encodes a DATE as its "YYYY-MM-DD" text, for DATE
+	// columns stored as strings. It decodes back into civil.Date and NullDate.
+	DateEncodingString
+	// DateEncodingDayOffset encodes a date as an INT64 number of days since
+	// EncodeOptions.DateEpoch, for schemas storing dates as integers. It
+	// decodes back with Row.ColumnDateFromDays.
+	DateEncodingDayOffset
+)
+
+// EncodeOptions tunes how Go values are encoded. The zero value encodes
+// exactly as NewGenericColumnValue does.
+type EncodeOptions struct {
+	// RejectZeroTime fails encoding the zero time.Time, including within a
+	// valid NullTime or a slice, which is usually passed by accident instead
+	// of a NULL.
+	RejectZeroTime bool
+	// TruncateToMicros truncates every time.Time to microseconds, the
+	// precision TIMESTAMP is stored at by the server, so a value read back
+	// equals the one written and rewriting it is idempotent.
+	TruncateToMicros bool
+	// RejectNULInString fails encoding a STRING containing a NUL byte, which
+	// some stores refuse, binary data should be encoded as BYTES instead.
+	RejectNULInString bool
+	// DateEncoding chooses the representation of civil.Date and NullDate,
+	// including the elements of slices.
+	DateEncoding DateEncoding
+	// DateEpoch is the day counted from by DateEncodingDayOffset, the zero
+	// value stands for the Unix epoch, 1970-01-01.
+	DateEpoch civil.Date
+	// DurationAsString encodes time.Duration and NullDuration, including the
+	// elements of slices, as STRING in time.Duration.String format, such as
+	// "1h30m0s", instead of INT64 nanoseconds.
+	DurationAsString bool
+}
+
+// checkTime returns error if t may not be encoded.
+func (opts *EncodeOptions) checkTime(t time.Time) error {
+	if opts != nil && opts.RejectZeroTime && t.IsZero() {
+		return errZeroTime()
+	}
+	return nil
+}
+
+// checkString returns error if s may not be encoded as a STRING.
+func (opts *EncodeOptions) checkString(s string) error {
+	if opts != nil && opts.RejectNULInString && strings.IndexByte(s, 0) >= 0 {
+		return errNULInString()
+	}
+	return nil
+}
+
+// typeOnly returns opts without the options rejecting values, for encoding a
+// value only to learn its type.
+func (opts *EncodeOptions) typeOnly() *EncodeOptions {
+	if opts == nil {
+		return nil
+	}
+	to := *opts
+	to.RejectZeroTime, to.RejectNULInString = false, false
+	return &to
+}
+
+// encodedTime returns t as it is to be encoded.
+func (opts *EncodeOptions) encodedTime(t time.Time) time.Time {
+	if opts != nil && opts.TruncateToMicros {
+		return t.Truncate(time.Microsecond)
+	}
+	return t
+}
+
+// unixEpochDate is the default epoch of DateEncodingDayOffset.
+var unixEpochDate = civil.Date{Year: 1970, Month: time.January, Day: 1}
+
+// encodeDate returns the encoding of d and its type.
+func (opts *EncodeOptions) encodeDate(d civil.Date) (*tspb.Value, *tspb.Type) {
+	var enc DateEncoding
+	if opts != nil {
+		enc = opts.DateEncoding
+	}
+	switch enc {
+	case DateEncodingString:
+		return &tspb.Value{Kind: stringKind(d.String())}, dateType()
+	case DateEncodingDayOffset:
+		epoch := opts.DateEpoch
+		if epoch == (civil.Date{}) {
+			epoch = unixEpochDate
+		}
+		return &tspb.Value{Kind: &tspb.Value_IntegerValue{IntegerValue: int64(d.DaysSince(epoch))}}, intType()
+	default:
+		return &tspb.Value{Kind: DateKind(d)}, dateType()
+	}
+}
+
+// dateType returns the type civil.Date values are encoded as.
+func (opts *EncodeOptions) dateType() *tspb.Type {
+	if opts != nil && opts.DateEncoding == DateEncodingDayOffset {
+		return intType()
+	}
+	return dateType()
+}
+
+// durationAsString reports whether durations are encoded as STRING.
+func (opts *EncodeOptions) durationAsString() bool {
+	return opts != nil && opts.DurationAsString
+}
+
+// durationType returns the type time.Duration values are encoded as.
+func (opts *EncodeOptions) durationType() *tspb.Type {
+	if opts.durationAsString() {
+		return stringType()
+	}
+	return intType()
+}
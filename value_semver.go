@@ -0,0 +1,185 @@
+// Copyright 2020 Zhizhesihai (Beijing) Technology Limited.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zetta
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SemVer is a semantic version, major.minor.patch optionally followed by
+// -pre-release and +build identifiers as defined by https://semver.org. It is
+// stored as its text in a STRING column.
+type SemVer struct {
+	Major, Minor, Patch uint64
+	// Pre is the dot separated pre-release identifiers, without the '-'.
+	Pre string
+	// Build is the dot separated build metadata, without the '+'.
+	Build string
+}
+
+// ParseSemVer parses s as major.minor.patch[-pre][+build].
+func ParseSemVer(s string) (SemVer, error) {
+	var v SemVer
+	rest := s
+	if i := strings.IndexByte(rest, '+'); i >= 0 {
+		v.Build, rest = rest[i+1:], rest[:i]
+		if err := checkSemVerIdents(v.Build, false); err != nil {
+			return SemVer{}, fmt.Errorf("%q is not a semantic version: build %v", s, err)
+		}
+	}
+	if i := strings.IndexByte(rest, '-'); i >= 0 {
+		v.Pre, rest = rest[i+1:], rest[:i]
+		if err := checkSemVerIdents(v.Pre, true); err != nil {
+			return SemVer{}, fmt.Errorf("%q is not a semantic version: pre-release %v", s, err)
+		}
+	}
+	parts := strings.Split(rest, ".")
+	if len(parts) != 3 {
+		return SemVer{}, fmt.Errorf("%q is not a semantic version: want major.minor.patch", s)
+	}
+	for i, p := range []*uint64{&v.Major, &v.Minor, &v.Patch} {
+		if !isSemVerNumber(parts[i]) {
+			return SemVer{}, fmt.Errorf("%q is not a semantic version: bad number %q", s, parts[i])
+		}
+		n, err := strconv.ParseUint(parts[i], 10, 64)
+		if err != nil {
+			return SemVer{}, fmt.Errorf("%q is not a semantic version: %v", s, err)
+		}
+		*p = n
+	}
+	return v, nil
+}
+
+// isSemVerNumber reports whether s is a number without leading zeros.
+func isSemVerNumber(s string) bool {
+	if s == "" || (len(s) > 1 && s[0] == '0') {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// checkSemVerIdents returns error if s is not dot separated non-empty
+// identifiers of ASCII alphanumerics and hyphens. Numeric pre-release
+// identifiers must not have leading zeros.
+func checkSemVerIdents(s string, pre bool) error {
+	for _, id := range strings.Split(s, ".") {
+		if id == "" {
+			return fmt.Errorf("has an empty identifier")
+		}
+		numeric := true
+		for i := 0; i < len(id); i++ {
+			c := id[i]
+			switch {
+			case c >= '0' && c <= '9':
+			case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '-':
+				numeric = false
+			default:
+				return fmt.Errorf("identifier %q has invalid character %q", id, c)
+			}
+		}
+		if pre && numeric && !isSemVerNumber(id) {
+			return fmt.Errorf("identifier %q has leading zeros", id)
+		}
+	}
+	return nil
+}
+
+// String returns the text of v, as stored in the STRING column.
+func (v SemVer) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Pre != "" {
+		s += "-" + v.Pre
+	}
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+// Compare returns -1, 0 or +1 as v has lower, equal or higher precedence than
+// w. A pre-release has lower precedence than its release and pre-releases are
+// ordered by their identifiers, numeric ones below alphanumeric ones. Build
+// metadata is ignored.
+func (v SemVer) Compare(w SemVer) int {
+	for _, c := range [][2]uint64{{v.Major, w.Major}, {v.Minor, w.Minor}, {v.Patch, w.Patch}} {
+		if c[0] != c[1] {
+			if c[0] < c[1] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case v.Pre == w.Pre:
+		return 0
+	case v.Pre == "":
+		return 1
+	case w.Pre == "":
+		return -1
+	}
+	a, b := strings.Split(v.Pre, "."), strings.Split(w.Pre, ".")
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if c := compareSemVerIdent(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(a) < len(b):
+		return -1
+	case len(a) > len(b):
+		return 1
+	}
+	return 0
+}
+
+// compareSemVerIdent compares pre-release identifiers x and y.
+func compareSemVerIdent(x, y string) int {
+	xn, yn := isSemVerNumber(x), isSemVerNumber(y)
+	switch {
+	case xn && yn:
+		// Without leading zeros the longer number is the larger.
+		if len(x) != len(y) {
+			if len(x) < len(y) {
+				return -1
+			}
+			return 1
+		}
+	case xn:
+		return -1
+	case yn:
+		return 1
+	}
+	return strings.Compare(x, y)
+}
+
+// NullSemVer represents a STRING holding a semantic version that may be NULL.
+type NullSemVer struct {
+	SemVer SemVer
+	Valid  bool // Valid is true if SemVer is not NULL.
+}
+
+// String implements Stringer.String for NullSemVer
+func (n NullSemVer) String() string {
+	if !n.Valid {
+		return fmt.Sprintf("%s", "<null>")
+	}
+	return fmt.Sprintf("%q", n.SemVer.String())
+}
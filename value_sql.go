@@ -0,0 +1,102 @@
+// Copyright 2020 Zhizhesihai (Beijing) Technology Limited.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zetta
+
+import (
+	"database/sql"
+)
+
+// Conversions between the Null* types and their database/sql counterparts.
+// A value which is not Valid always converts to the zero value of the other
+// type, so no stale payload is carried over with a NULL.
+
+// ToSQL converts n to a sql.NullInt64.
+func (n NullInt64) ToSQL() sql.NullInt64 {
+	if !n.Valid {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: n.Int64, Valid: true}
+}
+
+// NullInt64FromSQL converts a sql.NullInt64 to a NullInt64.
+func NullInt64FromSQL(n sql.NullInt64) NullInt64 {
+	if !n.Valid {
+		return NullInt64{}
+	}
+	return NullInt64{Int64: n.Int64, Valid: true}
+}
+
+// ToSQL converts n to a sql.NullString.
+func (n NullString) ToSQL() sql.NullString {
+	if !n.Valid {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: n.StringVal, Valid: true}
+}
+
+// NullStringFromSQL converts a sql.NullString to a NullString.
+func NullStringFromSQL(n sql.NullString) NullString {
+	if !n.Valid {
+		return NullString{}
+	}
+	return NullString{StringVal: n.String, Valid: true}
+}
+
+// ToSQL converts n to a sql.NullFloat64.
+func (n NullFloat64) ToSQL() sql.NullFloat64 {
+	if !n.Valid {
+		return sql.NullFloat64{}
+	}
+	return sql.NullFloat64{Float64: n.Float64, Valid: true}
+}
+
+// NullFloat64FromSQL converts a sql.NullFloat64 to a NullFloat64.
+func NullFloat64FromSQL(n sql.NullFloat64) NullFloat64 {
+	if !n.Valid {
+		return NullFloat64{}
+	}
+	return NullFloat64{Float64: n.Float64, Valid: true}
+}
+
+// ToSQL converts n to a sql.NullBool.
+func (n NullBool) ToSQL() sql.NullBool {
+	if !n.Valid {
+		return sql.NullBool{}
+	}
+	return sql.NullBool{Bool: n.Bool, Valid: true}
+}
+
+// NullBoolFromSQL converts a sql.NullBool to a NullBool.
+func NullBoolFromSQL(n sql.NullBool) NullBool {
+	if !n.Valid {
+		return NullBool{}
+	}
+	return NullBool{Bool: n.Bool, Valid: true}
+}
+
+// ToSQL converts n to a sql.NullTime.
+func (n NullTime) ToSQL() sql.NullTime {
+	if !n.Valid {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: n.Time, Valid: true}
+}
+
+// NullTimeFromSQL converts a sql.NullTime to a NullTime.
+func NullTimeFromSQL(n sql.NullTime) NullTime {
+	if !n.Valid {
+		return NullTime{}
+	}
+	return NullTime{Time: n.Time, Valid: true}
+}
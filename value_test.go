@@ -30,15 +30,27 @@ limitations under the License.
 package zetta
 
 import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"math"
+	"math/big"
+	"net/netip"
+	"net/url"
 	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"cloud.google.com/go/civil"
 	"github.com/golang/protobuf/proto"
 	tspb "github.com/zhihu/zetta-proto/pkg/tablestore"
+	"google.golang.org/grpc/codes"
 )
 
 var (
@@ -614,3 +626,3256 @@ func encodeArrayReflect(a interface{}) (*tspb.Value, error) {
 	}
 	return listProto(vs...), nil
 }
+
+// Test encoding/decoding STRING values as URLs.
+func TestURL(t *testing.T) {
+	u, err := url.Parse("https://user@example.com:8080/a/b?c=d#e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, in := range []interface{}{*u, u, NullURL{*u, true}} {
+		v, typ, err := encodeValue(in)
+		if err != nil {
+			t.Fatalf("#%d: encodeValue(%v) returns error: %v", i, in, err)
+		}
+		if want := stringProto(u.String()); !proto.Equal(v, want) {
+			t.Errorf("#%d: encodeValue(%v) = %v, want %v", i, in, v, want)
+		}
+		var got url.URL
+		if err := decodeValue(v, typ, &got); err != nil {
+			t.Fatalf("#%d: decodeValue(%v) returns error: %v", i, v, err)
+		}
+		if !reflect.DeepEqual(got, *u) {
+			t.Errorf("#%d: decodeValue(%v) = %v, want %v", i, v, got, u)
+		}
+		var gotNull NullURL
+		if err := decodeValue(v, typ, &gotNull); err != nil {
+			t.Fatalf("#%d: decodeValue(%v) returns error: %v", i, v, err)
+		}
+		if !reflect.DeepEqual(gotNull, NullURL{*u, true}) {
+			t.Errorf("#%d: decodeValue(%v) = %v, want %v", i, v, gotNull, NullURL{*u, true})
+		}
+	}
+	// NULL
+	for _, in := range []interface{}{(*url.URL)(nil), NullURL{}} {
+		v, _, err := encodeValue(in)
+		if err != nil {
+			t.Fatalf("encodeValue(%v) returns error: %v", in, err)
+		}
+		if !proto.Equal(v, nullProto()) {
+			t.Errorf("encodeValue(%v) = %v, want NULL", in, v)
+		}
+	}
+	gotNull := NullURL{*u, true}
+	if err := decodeValue(nullProto(), stringType(), &gotNull); err != nil {
+		t.Fatalf("decodeValue(NULL) returns error: %v", err)
+	}
+	if gotNull.Valid {
+		t.Errorf("decodeValue(NULL) = %v, want invalid NullURL", gotNull)
+	}
+	var got url.URL
+	if err := decodeValue(nullProto(), stringType(), &got); err == nil {
+		t.Errorf("decodeValue(NULL) into url.URL returns nil, want error")
+	}
+	// Malformed URL.
+	if err := decodeValue(stringProto("http://[::1"), stringType(), &got); err == nil {
+		t.Errorf("decodeValue(malformed URL) returns nil, want error")
+	} else if ErrCode(err) != codes.FailedPrecondition {
+		t.Errorf("decodeValue(malformed URL) returns error code %v, want %v", ErrCode(err), codes.FailedPrecondition)
+	}
+	// Type mismatch.
+	if err := decodeValue(intProto(1), intType(), &got); err == nil {
+		t.Errorf("decodeValue(INT64) into url.URL returns nil, want error")
+	}
+}
+
+// Test decoding BYTES arrays into string slices.
+func TestDecodeBytesArrayAsStrings(t *testing.T) {
+	in := listProto(bytesProto([]byte("abc")), bytesProto([]byte{}), nullProto(), bytesProto([]byte("世界")))
+	typ := listType(bytesType())
+
+	var ns []NullString
+	if err := decodeValue(in, typ, &ns); err != nil {
+		t.Fatalf("decodeValue(%v) into []NullString returns error: %v", in, err)
+	}
+	if want := []NullString{{"abc", true}, {"", true}, {}, {"世界", true}}; !reflect.DeepEqual(ns, want) {
+		t.Errorf("decodeValue(%v) into []NullString = %v, want %v", in, ns, want)
+	}
+	var s []string
+	if err := decodeValue(in, typ, &s); err != nil {
+		t.Fatalf("decodeValue(%v) into []string returns error: %v", in, err)
+	}
+	if want := []string{"abc", "", "", "世界"}; !reflect.DeepEqual(s, want) {
+		t.Errorf("decodeValue(%v) into []string = %q, want %q", in, s, want)
+	}
+	// NULL array.
+	s = []string{"stale"}
+	if err := decodeValue(nullProto(), typ, &s); err != nil {
+		t.Fatalf("decodeValue(NULL) into []string returns error: %v", err)
+	}
+	if s != nil {
+		t.Errorf("decodeValue(NULL) into []string = %q, want nil", s)
+	}
+	// Invalid UTF-8.
+	bad := listProto(bytesProto([]byte("ok")), bytesProto([]byte{0xff, 0xfe}))
+	if err := decodeValue(bad, typ, &ns); err == nil {
+		t.Errorf("decodeValue(%v) into []NullString returns nil, want error", bad)
+	}
+	if err := decodeValue(bad, typ, &s); err == nil {
+		t.Errorf("decodeValue(%v) into []string returns nil, want error", bad)
+	}
+	// STRING arrays decode into []string as well.
+	if err := decodeValue(listProto(stringProto("x"), nullProto()), listType(stringType()), &s); err != nil {
+		t.Fatalf("decodeValue(STRING ARRAY) into []string returns error: %v", err)
+	}
+	if want := []string{"x", ""}; !reflect.DeepEqual(s, want) {
+		t.Errorf("decodeValue(STRING ARRAY) into []string = %q, want %q", s, want)
+	}
+}
+
+func TestValueFromString(t *testing.T) {
+	for i, test := range []struct {
+		in   string
+		t    *tspb.Type
+		want interface{}
+		fail bool
+	}{
+		{"abc", stringType(), "abc", false},
+		{"", stringType(), "", false},
+		{"Zm9v", bytesType(), []byte("foo"), false},
+		{"!!", bytesType(), nil, true},
+		{"-42", intType(), int64(-42), false},
+		{"4.2", intType(), nil, true},
+		{"3.25", floatType(), 3.25, false},
+		{"Inf", floatType(), math.Inf(1), false},
+		{"pi", floatType(), nil, true},
+		{"true", boolType(), true, false},
+		{"0", boolType(), false, false},
+		{"yes", boolType(), nil, true},
+		{"2016-11-15T15:04:05.999999999Z", timeType(), t1, false},
+		{"2016-11-15", timeType(), nil, true},
+		{"2016-11-15", dateType(), d1, false},
+		{"2016-13-15", dateType(), nil, true},
+		{"1", listType(intType()), nil, true},
+		// The NULL literal works for every type.
+		{"NULL", stringType(), nil, false},
+		{"NULL", intType(), nil, false},
+		{"NULL", timeType(), nil, false},
+	} {
+		got, err := ValueFromString(test.in, test.t)
+		if err != nil {
+			if !test.fail {
+				t.Errorf("#%d: ValueFromString(%q, %v) returns error: %v", i, test.in, test.t, err)
+			}
+			continue
+		}
+		if test.fail {
+			t.Errorf("#%d: ValueFromString(%q, %v) = %v, want error", i, test.in, test.t, got)
+			continue
+		}
+		want, _, err := encodeValue(test.want)
+		if err != nil {
+			t.Fatalf("#%d: encodeValue(%v) returns error: %v", i, test.want, err)
+		}
+		if !proto.Equal(got, want) {
+			t.Errorf("#%d: ValueFromString(%q, %v) = %v, want %v", i, test.in, test.t, got, want)
+		}
+	}
+}
+
+func TestGenericColumnValueDecodeWithOptions(t *testing.T) {
+	coerce := DecodeOptions{NumericCoercion: true}
+	for i, test := range []struct {
+		in   GenericColumnValue
+		opts DecodeOptions
+		want interface{}
+		fail bool
+	}{
+		// Decode stays strict.
+		{GenericColumnValue{intType(), intProto(3)}, DecodeOptions{}, float64(3), true},
+		{GenericColumnValue{floatType(), floatProto(3)}, DecodeOptions{}, int64(3), true},
+		// INT64 -> FLOAT64
+		{GenericColumnValue{intType(), intProto(3)}, coerce, float64(3), false},
+		{GenericColumnValue{intType(), intProto(-5)}, coerce, NullFloat64{-5, true}, false},
+		{GenericColumnValue{intType(), nullProto()}, coerce, NullFloat64{}, false},
+		// FLOAT64 -> INT64
+		{GenericColumnValue{floatType(), floatProto(42)}, coerce, int64(42), false},
+		{GenericColumnValue{floatType(), floatProto(-7)}, coerce, NullInt64{-7, true}, false},
+		{GenericColumnValue{floatType(), nullProto()}, coerce, NullInt64{}, false},
+		{GenericColumnValue{floatType(), floatProto(1.5)}, coerce, int64(0), true},
+		{GenericColumnValue{floatType(), floatProto(math.Inf(1))}, coerce, int64(0), true},
+		{GenericColumnValue{floatType(), floatProto(math.NaN())}, coerce, int64(0), true},
+		{GenericColumnValue{floatType(), floatProto(math.MaxInt64)}, coerce, int64(0), true},
+		// FLOAT64 -> narrower integers
+		{GenericColumnValue{floatType(), floatProto(5)}, coerce, int32(5), false},
+		{GenericColumnValue{floatType(), floatProto(-5)}, coerce, int8(-5), false},
+		{GenericColumnValue{floatType(), floatProto(5)}, DecodeOptions{}, int32(0), true},
+		{GenericColumnValue{floatType(), floatProto(math.MaxInt32 + 1)}, coerce, int32(0), true},
+		// Non numeric types are never coerced.
+		{GenericColumnValue{stringType(), stringProto("3")}, coerce, int64(0), true},
+		{GenericColumnValue{boolType(), boolProto(true)}, coerce, float64(0), true},
+	} {
+		gotp := reflect.New(reflect.TypeOf(test.want))
+		err := test.in.DecodeWithOptions(gotp.Interface(), test.opts)
+		if test.fail {
+			if err == nil {
+				t.Errorf("#%d: DecodeWithOptions(%v) = %v, want error", i, test.in, gotp.Elem())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: DecodeWithOptions(%v) returns error: %v", i, test.in, err)
+			continue
+		}
+		if got := gotp.Elem().Interface(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("#%d: DecodeWithOptions(%v) = %v, want %v", i, test.in, got, test.want)
+		}
+	}
+}
+
+func TestCompositeKey(t *testing.T) {
+	ts := time.Date(2020, 5, 17, 8, 30, 0, 123456789, time.UTC)
+	date := civil.Date{Year: 2020, Month: 5, Day: 17}
+	for i, test := range []struct {
+		sep   string
+		parts []interface{}
+		want  string
+	}{
+		{"#", []interface{}{"user", int64(42)}, "user#42"},
+		{"#", []interface{}{"a", "b", "c"}, "a#b#c"},
+		{"#", []interface{}{"", ""}, "#"},
+		{"::", []interface{}{1.5, true, []byte("hi")}, "1.5::true::aGk="},
+		{"|", []interface{}{ts, date}, "2020-05-17T08:30:00.123456789Z|2020-05-17"},
+		{"|", []interface{}{NullInt64{}, NullString{"x", true}}, `\N|x`},
+		// Embedded separators and backslashes are escaped.
+		{"#", []interface{}{"a#b", "c"}, `a\#b#c`},
+		{"#", []interface{}{`a\b`, `\N`}, `a\\b#\\N`},
+		{"::", []interface{}{"a:b", "x::y:"}, `a:b::x\::y:`},
+	} {
+		got, err := EncodeCompositeKey(test.sep, test.parts...)
+		if err != nil {
+			t.Errorf("#%d: EncodeCompositeKey(%q, %v) returns error: %v", i, test.sep, test.parts, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("#%d: EncodeCompositeKey(%q, %v) = %q, want %q", i, test.sep, test.parts, got, test.want)
+		}
+		ptrs := make([]interface{}, len(test.parts))
+		for j, part := range test.parts {
+			ptrs[j] = reflect.New(reflect.TypeOf(part)).Interface()
+		}
+		if err := DecodeCompositeKey(got, test.sep, ptrs...); err != nil {
+			t.Errorf("#%d: DecodeCompositeKey(%q, %q) returns error: %v", i, got, test.sep, err)
+			continue
+		}
+		for j, ptr := range ptrs {
+			got := reflect.ValueOf(ptr).Elem().Interface()
+			if gt, ok := got.(time.Time); ok {
+				if !gt.Equal(test.parts[j].(time.Time)) {
+					t.Errorf("#%d: part %d decoded as %v, want %v", i, j, gt, test.parts[j])
+				}
+				continue
+			}
+			if !reflect.DeepEqual(got, test.parts[j]) {
+				t.Errorf("#%d: part %d decoded as %v, want %v", i, j, got, test.parts[j])
+			}
+		}
+	}
+
+	// Invalid input.
+	if _, err := EncodeCompositeKey("", "a"); err == nil {
+		t.Errorf("EncodeCompositeKey with empty separator succeeds")
+	}
+	// The part "N" would escape to the NULL marker \N.
+	if _, err := EncodeCompositeKey("N", "N", "a"); ErrCode(err) != codes.InvalidArgument {
+		t.Errorf("EncodeCompositeKey with separator \"N\" returns error %v, want code %v", err, codes.InvalidArgument)
+	}
+	var ns NullString
+	if err := DecodeCompositeKey(`\N`, "N", &ns); ErrCode(err) != codes.InvalidArgument {
+		t.Errorf("DecodeCompositeKey with separator \"N\" returns error %v, want code %v", err, codes.InvalidArgument)
+	}
+	if _, err := EncodeCompositeKey("#", []string{"a"}); err == nil {
+		t.Errorf("EncodeCompositeKey with []string part succeeds")
+	}
+	var s string
+	var n int64
+	for _, test := range []struct {
+		in   string
+		ptrs []interface{}
+	}{
+		{"a#b", []interface{}{&s}},
+		{"a", []interface{}{&s, &n}},
+		{`a\x#1`, []interface{}{&s, &n}},
+		{`a#`, []interface{}{&s, &n}},
+		{`a#\N`, []interface{}{&s, &n}},
+		{`a#1`, []interface{}{&s, &struct{}{}}},
+	} {
+		if err := DecodeCompositeKey(test.in, "#", test.ptrs...); err == nil {
+			t.Errorf("DecodeCompositeKey(%q) succeeds, want error", test.in)
+		}
+	}
+}
+
+func TestDecodeTimestampArrayAsEpochMillis(t *testing.T) {
+	t1 := time.Date(2020, 5, 17, 8, 30, 0, 123456789, time.UTC)
+	t2 := time.Unix(0, 0)
+	gcv := GenericColumnValue{
+		Type: listType(timeType()),
+		Value: listProto(
+			stringProto(t1.Format(time.RFC3339Nano)),
+			nullProto(),
+			stringProto(t2.Format(time.RFC3339Nano)),
+		),
+	}
+	sentinel := int64(-1)
+	opts := DecodeOptions{TimestampsAsEpochMillis: true, NullEpochMillis: &sentinel}
+	var got []int64
+	if err := gcv.DecodeWithOptions(&got, opts); err != nil {
+		t.Fatalf("DecodeWithOptions returns error: %v", err)
+	}
+	if want := []int64{t1.UnixMilli(), -1, 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DecodeWithOptions = %v, want %v", got, want)
+	}
+	// NULL elements are rejected without a sentinel.
+	if err := gcv.DecodeWithOptions(&got, DecodeOptions{TimestampsAsEpochMillis: true}); err == nil {
+		t.Errorf("DecodeWithOptions of array with NULL element succeeds, want error")
+	}
+	// TIMESTAMP arrays need the option.
+	if err := gcv.Decode(&got); ErrCode(err) != codes.InvalidArgument {
+		t.Errorf("Decode of TIMESTAMP array into []int64 returns error %v, want code %v", err, codes.InvalidArgument)
+	}
+	// A NULL array decodes into a nil slice.
+	gcv.Value = nullProto()
+	if err := gcv.DecodeWithOptions(&got, opts); err != nil || got != nil {
+		t.Errorf("DecodeWithOptions(NULL) = %v, %v, want nil slice", got, err)
+	}
+}
+
+func TestDecodeIntArrayIntoInt64s(t *testing.T) {
+	var got []int64
+	pb := listProto(intProto(1), intProto(-2))
+	for _, opts := range []DecodeOptions{{}, {TimestampsAsEpochMillis: true}} {
+		if err := decodeValueWithOptions(pb, listType(intType()), &got, &opts); err != nil {
+			t.Fatalf("decodeValue(%v) with %+v returns error: %v", pb, opts, err)
+		}
+		if want := []int64{1, -2}; !reflect.DeepEqual(got, want) {
+			t.Errorf("decodeValue(%v) with %+v = %v, want %v", pb, opts, got, want)
+		}
+	}
+	if err := decodeValue(nullProto(), listType(intType()), &got); err != nil || got != nil {
+		t.Errorf("decodeValue(NULL) = %v, %v, want nil slice", got, err)
+	}
+	pb = listProto(intProto(1), nullProto())
+	if err := decodeValue(pb, listType(intType()), &got); err == nil {
+		t.Errorf("decodeValue(%v) returns nil, want error for the NULL element", pb)
+	}
+	if err := decodeValue(listProto(stringProto("a")), listType(stringType()), &got); err == nil {
+		t.Errorf("decodeValue of STRING array into []int64 returns nil, want error")
+	}
+}
+
+func TestIsNullValue(t *testing.T) {
+	for _, test := range []struct {
+		in   *tspb.Value
+		want bool
+	}{
+		{nullProto(), true},
+		{nil, false},
+		{&tspb.Value{}, false},
+		{stringProto(""), false},
+		{intProto(0), false},
+		{boolProto(false), false},
+		{listProto(nullProto()), false},
+	} {
+		if got := IsNullValue(test.in); got != test.want {
+			t.Errorf("IsNullValue(%v) = %v, want %v", test.in, got, test.want)
+		}
+	}
+}
+
+func TestBigRat(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want *big.Rat
+	}{
+		{"3/7", big.NewRat(3, 7)},
+		{"6/14", big.NewRat(3, 7)},
+		{"-5", big.NewRat(-5, 1)},
+		{"42/1", big.NewRat(42, 1)},
+	} {
+		got := new(big.Rat)
+		if err := decodeValue(stringProto(test.in), stringType(), got); err != nil {
+			t.Errorf("decodeValue(%q) returns error: %v", test.in, err)
+			continue
+		}
+		if got.Cmp(test.want) != 0 {
+			t.Errorf("decodeValue(%q) = %v, want %v", test.in, got, test.want)
+		}
+	}
+	// Malformed strings, NULL and other types are rejected.
+	for _, test := range []struct {
+		v *tspb.Value
+		t *tspb.Type
+	}{
+		{stringProto("3/"), stringType()},
+		{stringProto("three sevenths"), stringType()},
+		{stringProto("1/0"), stringType()},
+		{nullProto(), stringType()},
+		{intProto(3), intType()},
+	} {
+		got := big.NewRat(1, 2)
+		if err := decodeValue(test.v, test.t, got); err == nil {
+			t.Errorf("decodeValue(%v) = %v, want error", test.v, got)
+		} else if got.Cmp(big.NewRat(1, 2)) != 0 {
+			t.Errorf("decodeValue(%v) modified destination to %v on error", test.v, got)
+		}
+	}
+
+	for _, test := range []struct {
+		in   interface{}
+		want *tspb.Value
+	}{
+		{big.NewRat(3, 7), stringProto("3/7")},
+		{*big.NewRat(6, 3), stringProto("2/1")},
+		{(*big.Rat)(nil), nullProto()},
+	} {
+		got, _, err := encodeValue(test.in)
+		if err != nil {
+			t.Errorf("encodeValue(%v) returns error: %v", test.in, err)
+			continue
+		}
+		if !proto.Equal(got, test.want) {
+			t.Errorf("encodeValue(%v) = %v, want %v", test.in, got, test.want)
+		}
+	}
+}
+
+func TestGenericColumnValueArray(t *testing.T) {
+	in := []GenericColumnValue{
+		{Type: intType(), Value: intProto(1)},
+		{Type: intType(), Value: nullProto()},
+		{Type: intType(), Value: intProto(3)},
+	}
+	pb, pt, err := encodeValue(in)
+	if err != nil {
+		t.Fatalf("encodeValue(%v) returns error: %v", in, err)
+	}
+	if want := listType(intType()); !proto.Equal(pt, want) {
+		t.Errorf("encodeValue(%v) type = %v, want %v", in, pt, want)
+	}
+	if want := listProto(intProto(1), nullProto(), intProto(3)); !proto.Equal(pb, want) {
+		t.Errorf("encodeValue(%v) = %v, want %v", in, pb, want)
+	}
+	var got []GenericColumnValue
+	if err := decodeValue(pb, pt, &got); err != nil {
+		t.Fatalf("decodeValue(%v) returns error: %v", pb, err)
+	}
+	if len(got) != len(in) {
+		t.Fatalf("round trip of %v = %v", in, got)
+	}
+	for i := range in {
+		if !proto.Equal(got[i].Type, in[i].Type) || !proto.Equal(got[i].Value, in[i].Value) {
+			t.Errorf("round trip element %d = %v, want %v", i, got[i], in[i])
+		}
+	}
+	// The encoded array holds copies of the elements.
+	in[0].Value.Kind = stringKind("changed")
+	if !proto.Equal(pb, listProto(intProto(1), nullProto(), intProto(3))) {
+		t.Errorf("encoded array changes with its source: %v", pb)
+	}
+	if pb, pt, err := encodeValue([]GenericColumnValue(nil)); err != nil || !proto.Equal(pb, nullProto()) || pt != nil {
+		t.Errorf("encodeValue(nil) = %v, %v, %v, want NULL", pb, pt, err)
+	}
+
+	for _, bad := range [][]GenericColumnValue{
+		{},
+		{{Type: intType(), Value: intProto(1)}, {Type: stringType(), Value: stringProto("2")}},
+		{{Type: intType(), Value: intProto(1)}, {Value: intProto(2)}},
+		{{Type: intType(), Value: intProto(1)}, {Type: intType()}},
+	} {
+		if _, _, err := encodeValue(bad); err == nil {
+			t.Errorf("encodeValue(%v) succeeds, want error", bad)
+		}
+	}
+	if err := decodeValue(intProto(1), intType(), &got); err == nil {
+		t.Errorf("decodeValue of INT64 into []GenericColumnValue succeeds, want error")
+	}
+}
+
+func TestDecodeFloat32Array(t *testing.T) {
+	vec := GenericColumnValue{
+		Type:  listType(floatType()),
+		Value: listProto(floatProto(0.5), floatProto(-1.25), floatProto(0.1), floatProto(math.NaN()), floatProto(math.Inf(-1))),
+	}
+	var got []float32
+	if err := vec.DecodeWithOptions(&got, DecodeOptions{StrictFloat32: true}); err != nil {
+		t.Fatalf("DecodeWithOptions returns error: %v", err)
+	}
+	want := []float32{0.5, -1.25, 0.1, float32(math.NaN()), float32(math.Inf(-1))}
+	if len(got) != len(want) {
+		t.Fatalf("DecodeWithOptions = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] && !(math.IsNaN(float64(got[i])) && math.IsNaN(float64(want[i]))) {
+			t.Errorf("element %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+
+	overflow := GenericColumnValue{
+		Type:  listType(floatType()),
+		Value: listProto(floatProto(1), floatProto(-math.MaxFloat64)),
+	}
+	if err := overflow.Decode(&got); err != nil {
+		t.Fatalf("Decode of overflowing element returns error: %v", err)
+	}
+	if !math.IsInf(float64(got[1]), -1) {
+		t.Errorf("overflowing element decoded as %v, want -Inf", got[1])
+	}
+	err := overflow.DecodeWithOptions(&got, DecodeOptions{StrictFloat32: true})
+	if ErrCode(err) != codes.OutOfRange {
+		t.Errorf("strict decode of overflowing element returns %v, want OutOfRange", err)
+	}
+
+	withNull := GenericColumnValue{Type: listType(floatType()), Value: listProto(floatProto(1), nullProto())}
+	if err := withNull.Decode(&got); err == nil {
+		t.Errorf("Decode of NULL element into []float32 succeeds, want error")
+	}
+}
+
+func TestDecodeTimestampArrayInLocation(t *testing.T) {
+	shanghai := time.FixedZone("CST", 8*60*60)
+	t1 := time.Date(2020, 5, 17, 8, 30, 0, 0, time.UTC)
+	t2 := time.Date(2020, 5, 17, 23, 0, 0, 0, time.FixedZone("", -5*60*60))
+	gcv := GenericColumnValue{
+		Type:  listType(timeType()),
+		Value: listProto(stringProto(t1.Format(time.RFC3339Nano)), stringProto(t2.Format(time.RFC3339Nano))),
+	}
+	opts := DecodeOptions{Location: shanghai}
+
+	var times []time.Time
+	if err := gcv.DecodeWithOptions(&times, opts); err != nil {
+		t.Fatalf("DecodeWithOptions into []time.Time returns error: %v", err)
+	}
+	var nulls []NullTime
+	if err := gcv.DecodeWithOptions(&nulls, opts); err != nil {
+		t.Fatalf("DecodeWithOptions into []NullTime returns error: %v", err)
+	}
+	for i, want := range []time.Time{t1, t2} {
+		for _, got := range []time.Time{times[i], nulls[i].Time} {
+			if !got.Equal(want) || got.Location() != shanghai {
+				t.Errorf("element %d = %v, want %v in %v", i, got, want, shanghai)
+			}
+		}
+	}
+	if got := nulls[1].Time.Format("2006-01-02 15:04"); got != "2020-05-18 12:00" {
+		t.Errorf("element 1 formats as %q in %v", got, shanghai)
+	}
+
+	// Without a location times keep the parsed offset.
+	if err := gcv.Decode(&times); err != nil {
+		t.Fatalf("Decode returns error: %v", err)
+	}
+	if _, offset := times[1].Zone(); offset != -5*60*60 {
+		t.Errorf("Decode element 1 has offset %d, want %d", offset, -5*60*60)
+	}
+
+	withNull := GenericColumnValue{Type: listType(timeType()), Value: listProto(nullProto())}
+	if err := withNull.DecodeWithOptions(&nulls, opts); err != nil || nulls[0].Valid {
+		t.Errorf("DecodeWithOptions of NULL element = %v, %v, want invalid NullTime", nulls, err)
+	}
+	if err := withNull.Decode(&times); err == nil {
+		t.Errorf("Decode of NULL element into []time.Time succeeds, want error")
+	}
+}
+
+func TestDecodeResultSetLenient(t *testing.T) {
+	type user struct {
+		ID   int64  `column:"uid"`
+		Name string `column:"name"`
+	}
+	fields := []*tspb.StructType_Field{mkField("uid", intType()), mkField("name", stringType())}
+	rows := []*tspb.ListValue{
+		listValueProto(intProto(1), stringProto("alice")),
+		listValueProto(stringProto("two"), stringProto("bob")),
+		listValueProto(intProto(3), stringProto("carol")),
+		listValueProto(intProto(4)),
+		nil,
+		listValueProto(intProto(6), stringProto("frank")),
+	}
+	var got []*user
+	errs, err := DecodeResultSetLenient(fields, rows, &got)
+	if err != nil {
+		t.Fatalf("DecodeResultSetLenient returns error: %v", err)
+	}
+	want := []*user{{1, "alice"}, nil, {3, "carol"}, nil, nil, {6, "frank"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DecodeResultSetLenient decoded %v, want %v", got, want)
+	}
+	if len(errs) != len(rows) {
+		t.Fatalf("DecodeResultSetLenient returns %d row errors, want %d", len(errs), len(rows))
+	}
+	for i, e := range errs {
+		if (e != nil) != (want[i] == nil) {
+			t.Errorf("row %d: error = %v, decoded = %v", i, e, got[i])
+		}
+	}
+
+	// Rows that all decode return no row errors.
+	if errs, err := DecodeResultSetLenient(fields, rows[:1], &got); err != nil || errs != nil || len(got) != 1 {
+		t.Errorf("DecodeResultSetLenient of good rows = %v, %v, %v", got, errs, err)
+	}
+	// Bad destinations are hard errors.
+	for _, dst := range []interface{}{nil, got, &[]user{}, (*[]*user)(nil)} {
+		if _, err := DecodeResultSetLenient(fields, rows, dst); err == nil {
+			t.Errorf("DecodeResultSetLenient(%T) succeeds, want error", dst)
+		}
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	for _, s := range []string{"10.0.0.0/8", "192.168.1.0/24", "2001:db8::/32", "::1/128"} {
+		p := netip.MustParsePrefix(s)
+		for i, in := range []interface{}{p, NullPrefix{p, true}} {
+			v, typ, err := encodeValue(in)
+			if err != nil {
+				t.Fatalf("#%d: encodeValue(%v) returns error: %v", i, in, err)
+			}
+			if want := stringProto(s); !proto.Equal(v, want) {
+				t.Errorf("#%d: encodeValue(%v) = %v, want %v", i, in, v, want)
+			}
+			var got netip.Prefix
+			if err := decodeValue(v, typ, &got); err != nil {
+				t.Fatalf("#%d: decodeValue(%v) returns error: %v", i, v, err)
+			}
+			if got != p {
+				t.Errorf("#%d: decodeValue(%v) = %v, want %v", i, v, got, p)
+			}
+			var gotNull NullPrefix
+			if err := decodeValue(v, typ, &gotNull); err != nil {
+				t.Fatalf("#%d: decodeValue(%v) returns error: %v", i, v, err)
+			}
+			if gotNull != (NullPrefix{p, true}) {
+				t.Errorf("#%d: decodeValue(%v) = %v, want %v", i, v, gotNull, NullPrefix{p, true})
+			}
+		}
+	}
+	// NULL
+	if v, _, err := encodeValue(NullPrefix{}); err != nil || !proto.Equal(v, nullProto()) {
+		t.Errorf("encodeValue(NullPrefix{}) = %v, %v, want NULL", v, err)
+	}
+	gotNull := NullPrefix{netip.MustParsePrefix("10.0.0.0/8"), true}
+	if err := decodeValue(nullProto(), stringType(), &gotNull); err != nil || gotNull.Valid {
+		t.Errorf("decodeValue(NULL) = %v, %v, want invalid NullPrefix", gotNull, err)
+	}
+	var got netip.Prefix
+	if err := decodeValue(nullProto(), stringType(), &got); err == nil {
+		t.Errorf("decodeValue(NULL) into netip.Prefix returns nil, want error")
+	}
+	// Malformed prefixes.
+	for _, s := range []string{"10.0.0.0", "10.0.0.0/33", "2001:db8::/129", "not a prefix"} {
+		if err := decodeValue(stringProto(s), stringType(), &got); ErrCode(err) != codes.FailedPrecondition {
+			t.Errorf("decodeValue(%q) returns %v, want %v", s, err, codes.FailedPrecondition)
+		}
+	}
+	if _, _, err := encodeValue(netip.Prefix{}); err == nil {
+		t.Errorf("encodeValue(invalid prefix) returns nil, want error")
+	}
+}
+
+func TestDecodeStringArrayToSet(t *testing.T) {
+	for _, test := range []struct {
+		in   *tspb.Value
+		want map[string]struct{}
+	}{
+		{
+			listProto(stringProto("a"), stringProto("b"), stringProto("a"), nullProto(), stringProto(""), nullProto()),
+			map[string]struct{}{"a": {}, "b": {}, "": {}},
+		},
+		{listProto(), map[string]struct{}{}},
+		{listProto(nullProto()), map[string]struct{}{}},
+		{nullProto(), nil},
+	} {
+		got, err := DecodeStringArrayToSet(test.in, listType(stringType()))
+		if err != nil {
+			t.Errorf("DecodeStringArrayToSet(%v) returns error: %v", test.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("DecodeStringArrayToSet(%v) = %v, want %v", test.in, got, test.want)
+		}
+	}
+	for _, test := range []struct {
+		v *tspb.Value
+		t *tspb.Type
+	}{
+		{listProto(intProto(1)), listType(intType())},
+		{stringProto("a"), stringType()},
+		{stringProto("a"), listType(stringType())},
+		{listProto(stringProto("a")), nil},
+		{nil, listType(stringType())},
+	} {
+		if _, err := DecodeStringArrayToSet(test.v, test.t); err == nil {
+			t.Errorf("DecodeStringArrayToSet(%v, %v) succeeds, want error", test.v, test.t)
+		}
+	}
+}
+
+func TestEncodeRejectZeroTime(t *testing.T) {
+	reject := EncodeOptions{RejectZeroTime: true}
+	for _, in := range []interface{}{
+		time.Time{},
+		NullTime{Valid: true},
+		[]time.Time{time.Now(), {}},
+		[]NullTime{{}, {Valid: true}},
+	} {
+		_, err := NewGenericColumnValueWithOptions(in, reject)
+		if err == nil {
+			t.Errorf("NewGenericColumnValueWithOptions(%v) succeeds, want error", in)
+			continue
+		}
+		if ErrCode(err) != codes.InvalidArgument || !strings.Contains(ErrDesc(err), "NullTime") {
+			t.Errorf("NewGenericColumnValueWithOptions(%v) returns %v, want error suggesting NullTime", in, err)
+		}
+		// Without the option the zero time is encoded.
+		if _, err := NewGenericColumnValue(in); err != nil {
+			t.Errorf("NewGenericColumnValue(%v) returns error: %v", in, err)
+		}
+	}
+	// NULL and non-zero times are accepted.
+	for _, in := range []interface{}{NullTime{}, time.Unix(0, 0), []NullTime{{}, {time.Now(), true}}} {
+		if _, err := NewGenericColumnValueWithOptions(in, reject); err != nil {
+			t.Errorf("NewGenericColumnValueWithOptions(%v) returns error: %v", in, err)
+		}
+	}
+}
+
+func TestNullSQLConversions(t *testing.T) {
+	now := time.Now()
+	for _, test := range []struct {
+		desc        string
+		toSQL, want interface{}
+	}{
+		{"NullInt64", NullInt64{7, true}.ToSQL(), sql.NullInt64{Int64: 7, Valid: true}},
+		{"invalid NullInt64", NullInt64{7, false}.ToSQL(), sql.NullInt64{}},
+		{"NullString", NullString{"", true}.ToSQL(), sql.NullString{String: "", Valid: true}},
+		{"invalid NullString", NullString{"x", false}.ToSQL(), sql.NullString{}},
+		{"NullFloat64", NullFloat64{1.5, true}.ToSQL(), sql.NullFloat64{Float64: 1.5, Valid: true}},
+		{"invalid NullFloat64", NullFloat64{1.5, false}.ToSQL(), sql.NullFloat64{}},
+		{"NullBool", NullBool{false, true}.ToSQL(), sql.NullBool{Bool: false, Valid: true}},
+		{"invalid NullBool", NullBool{true, false}.ToSQL(), sql.NullBool{}},
+		{"NullTime", NullTime{now, true}.ToSQL(), sql.NullTime{Time: now, Valid: true}},
+		{"invalid NullTime", NullTime{now, false}.ToSQL(), sql.NullTime{}},
+	} {
+		if !reflect.DeepEqual(test.toSQL, test.want) {
+			t.Errorf("%s.ToSQL() = %v, want %v", test.desc, test.toSQL, test.want)
+		}
+	}
+	for _, test := range []struct {
+		desc          string
+		fromSQL, want interface{}
+	}{
+		{"NullInt64", NullInt64FromSQL(sql.NullInt64{Int64: 7, Valid: true}), NullInt64{7, true}},
+		{"invalid NullInt64", NullInt64FromSQL(sql.NullInt64{Int64: 7}), NullInt64{}},
+		{"NullString", NullStringFromSQL(sql.NullString{String: "a", Valid: true}), NullString{"a", true}},
+		{"invalid NullString", NullStringFromSQL(sql.NullString{String: "a"}), NullString{}},
+		{"NullFloat64", NullFloat64FromSQL(sql.NullFloat64{Float64: 1.5, Valid: true}), NullFloat64{1.5, true}},
+		{"invalid NullFloat64", NullFloat64FromSQL(sql.NullFloat64{Float64: 1.5}), NullFloat64{}},
+		{"NullBool", NullBoolFromSQL(sql.NullBool{Bool: true, Valid: true}), NullBool{true, true}},
+		{"invalid NullBool", NullBoolFromSQL(sql.NullBool{Bool: true}), NullBool{}},
+		{"NullTime", NullTimeFromSQL(sql.NullTime{Time: now, Valid: true}), NullTime{now, true}},
+		{"invalid NullTime", NullTimeFromSQL(sql.NullTime{Time: now}), NullTime{}},
+	} {
+		if !reflect.DeepEqual(test.fromSQL, test.want) {
+			t.Errorf("%sFromSQL() = %v, want %v", test.desc, test.fromSQL, test.want)
+		}
+	}
+}
+
+func TestDuration(t *testing.T) {
+	for _, test := range []struct {
+		in       interface{}
+		want     *tspb.Value
+		wantType *tspb.Type
+	}{
+		{90 * time.Minute, intProto(int64(90 * time.Minute)), intType()},
+		{NullDuration{-time.Millisecond, true}, intProto(-1e6), intType()},
+		{NullDuration{}, nullProto(), nil},
+		{[]time.Duration{time.Second, 0}, listProto(intProto(1e9), intProto(0)), listType(intType())},
+		{[]time.Duration(nil), nullProto(), nil},
+		{[]NullDuration{{time.Hour, true}, {}}, listProto(intProto(int64(time.Hour)), nullProto()), listType(intType())},
+		{[]NullDuration(nil), nullProto(), nil},
+	} {
+		got, gotType, err := encodeValue(test.in)
+		if err != nil {
+			t.Errorf("encodeValue(%v) returns error: %v", test.in, err)
+			continue
+		}
+		if !proto.Equal(got, test.want) || !proto.Equal(gotType, test.wantType) {
+			t.Errorf("encodeValue(%v) = %v, %v, want %v, %v", test.in, got, gotType, test.want, test.wantType)
+			continue
+		}
+		if gotType == nil {
+			continue
+		}
+		// Round trip.
+		dst := reflect.New(reflect.TypeOf(test.in))
+		if err := decodeValue(got, gotType, dst.Interface()); err != nil {
+			t.Errorf("decodeValue(%v) returns error: %v", got, err)
+			continue
+		}
+		if !reflect.DeepEqual(dst.Elem().Interface(), test.in) {
+			t.Errorf("decodeValue(%v) = %v, want %v", got, dst.Elem().Interface(), test.in)
+		}
+	}
+
+	// NULL handling.
+	nd := NullDuration{time.Second, true}
+	if err := decodeValue(nullProto(), intType(), &nd); err != nil || nd.Valid {
+		t.Errorf("decodeValue(NULL) = %v, %v, want invalid NullDuration", nd, err)
+	}
+	var d time.Duration
+	if err := decodeValue(nullProto(), intType(), &d); err == nil {
+		t.Errorf("decodeValue(NULL) into time.Duration returns nil, want error")
+	}
+	ds := []time.Duration{time.Second}
+	if err := decodeValue(nullProto(), listType(intType()), &ds); err != nil || ds != nil {
+		t.Errorf("decodeValue(NULL array) = %v, %v, want nil slice", ds, err)
+	}
+	if err := decodeValue(listProto(intProto(1), nullProto()), listType(intType()), &ds); err == nil {
+		t.Errorf("decodeValue of NULL element into []time.Duration returns nil, want error")
+	}
+	if err := decodeValue(boolProto(true), boolType(), &d); err == nil {
+		t.Errorf("decodeValue(BOOL) into time.Duration returns nil, want error")
+	}
+}
+
+func TestNaNAsNull(t *testing.T) {
+	nan := GenericColumnValue{floatType(), floatProto(math.NaN())}
+	normal := GenericColumnValue{floatType(), floatProto(1.5)}
+
+	var got NullFloat64
+	if err := nan.Decode(&got); err != nil {
+		t.Fatalf("Decode(NaN) returns error: %v", err)
+	}
+	if !got.Valid || !math.IsNaN(got.Float64) {
+		t.Errorf("Decode(NaN) = %v, want valid NaN", got)
+	}
+	if err := nan.DecodeWithOptions(&got, DecodeOptions{NaNAsNull: true}); err != nil {
+		t.Fatalf("DecodeWithOptions(NaN) returns error: %v", err)
+	}
+	if got != (NullFloat64{}) {
+		t.Errorf("DecodeWithOptions(NaN) = %v, want NULL", got)
+	}
+	for _, opts := range []DecodeOptions{{}, {NaNAsNull: true}} {
+		if err := normal.DecodeWithOptions(&got, opts); err != nil {
+			t.Fatalf("DecodeWithOptions(%v, %+v) returns error: %v", normal, opts, err)
+		}
+		if want := (NullFloat64{1.5, true}); got != want {
+			t.Errorf("DecodeWithOptions(%v, %+v) = %v, want %v", normal, opts, got, want)
+		}
+	}
+
+	vec := GenericColumnValue{listType(floatType()), listProto(floatProto(math.NaN()), floatProto(2))}
+	var gotVec []NullFloat64
+	if err := vec.DecodeWithOptions(&gotVec, DecodeOptions{NaNAsNull: true}); err != nil {
+		t.Fatalf("DecodeWithOptions(%v) returns error: %v", vec, err)
+	}
+	if want := []NullFloat64{{}, {2, true}}; !reflect.DeepEqual(gotVec, want) {
+		t.Errorf("DecodeWithOptions(%v) = %v, want %v", vec, gotVec, want)
+	}
+}
+
+func TestCellsFromMap(t *testing.T) {
+	cols, vals, err := CellsFromMap("info", map[string]interface{}{
+		"name": "alice",
+		"age":  int64(30),
+		"bio":  nil,
+	})
+	if err != nil {
+		t.Fatalf("CellsFromMap returns error: %v", err)
+	}
+	if want := []string{"info:age", "info:bio", "info:name"}; !reflect.DeepEqual(cols, want) {
+		t.Errorf("CellsFromMap columns = %v, want %v", cols, want)
+	}
+	for i, want := range []*tspb.Value{intProto(30), nullProto(), stringProto("alice")} {
+		if !proto.Equal(vals[i], want) {
+			t.Errorf("CellsFromMap value %v = %v, want %v", cols[i], vals[i], want)
+		}
+	}
+
+	cols, _, err = CellsFromMap("default", map[string]interface{}{"b": "x", "a": "y"})
+	if err != nil {
+		t.Fatalf("CellsFromMap returns error: %v", err)
+	}
+	if want := []string{"a", "b"}; !reflect.DeepEqual(cols, want) {
+		t.Errorf("CellsFromMap columns = %v, want %v", cols, want)
+	}
+
+	_, _, err = CellsFromMap("info", map[string]interface{}{"ok": "x", "bad": make(chan int)})
+	if err == nil {
+		t.Fatalf("CellsFromMap with unencodable value returns nil, want error")
+	}
+	if !strings.Contains(ErrDesc(err), `column "bad"`) {
+		t.Errorf("CellsFromMap returns error %q, want it to name column \"bad\"", ErrDesc(err))
+	}
+}
+
+// Test that NULL arrays decode to nil slices and empty arrays to empty
+// non-nil slices, callers rely on a nil slice meaning SQL NULL.
+func TestDecodeNullVersusEmptyArray(t *testing.T) {
+	type S struct{ Col1 int64 }
+	for _, test := range []struct {
+		t    *tspb.Type
+		dstp interface{}
+	}{
+		{listType(stringType()), &[]NullString{}},
+		{listType(bytesType()), &[]NullString{}},
+		{listType(stringType()), &[]string{}},
+		{listType(bytesType()), &[][]byte{}},
+		{listType(intType()), &[]NullInt64{}},
+		{listType(intType()), &[]time.Duration{}},
+		{listType(intType()), &[]NullDuration{}},
+		{listType(boolType()), &[]NullBool{}},
+		{listType(floatType()), &[]NullFloat64{}},
+		{listType(floatType()), &[]float32{}},
+		{listType(timeType()), &[]time.Time{}},
+		{listType(timeType()), &[]NullTime{}},
+		{listType(intType()), &[]int64{}},
+		{listType(dateType()), &[]NullDate{}},
+		{listType(structType(mkField("Col1", intType()))), &[]NullRow{}},
+		{listType(structType(mkField("Col1", intType()))), &[]*S{}},
+		{listType(stringType()), &[]GenericColumnValue{}},
+	} {
+		name := fmt.Sprintf("%v into %T", test.t, test.dstp)
+		if err := decodeValue(nullProto(), test.t, test.dstp); err != nil {
+			t.Errorf("decoding NULL %v returns error: %v", name, err)
+		} else if got := reflect.ValueOf(test.dstp).Elem(); !got.IsNil() {
+			t.Errorf("decoding NULL %v = %#v, want nil", name, got.Interface())
+		}
+		if err := decodeValue(listProto(), test.t, test.dstp); err != nil {
+			t.Errorf("decoding empty %v returns error: %v", name, err)
+		} else if got := reflect.ValueOf(test.dstp).Elem(); got.IsNil() || got.Len() != 0 {
+			t.Errorf("decoding empty %v = %#v, want empty slice", name, got.Interface())
+		}
+	}
+
+	var b []byte
+	if err := decodeValue(bytesProto(nil), bytesType(), &b); err != nil {
+		t.Fatalf("decoding empty BYTES returns error: %v", err)
+	}
+	if b == nil || len(b) != 0 {
+		t.Errorf("decoding empty BYTES = %#v, want empty slice", b)
+	}
+	if err := decodeValue(nullProto(), bytesType(), &b); err != nil {
+		t.Fatalf("decoding NULL BYTES returns error: %v", err)
+	}
+	if b != nil {
+		t.Errorf("decoding NULL BYTES = %#v, want nil", b)
+	}
+}
+
+func TestDecodeTolerantTimestamp(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want time.Time
+	}{
+		{"2020-01-02T03:04:05Z", time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{"2020-01-02T03:04:05.5+08:00", time.Date(2020, 1, 2, 3, 4, 5, 5e8, time.FixedZone("", 8*3600))},
+		// Offset without a colon.
+		{"2020-01-02T03:04:05+0800", time.Date(2020, 1, 2, 3, 4, 5, 0, time.FixedZone("", 8*3600))},
+		{"2020-01-02T03:04:05.25-0130", time.Date(2020, 1, 2, 3, 4, 5, 25e7, time.FixedZone("", -90*60))},
+		// Digits beyond nanoseconds are truncated.
+		{"2020-01-02T03:04:05.123456789999Z", time.Date(2020, 1, 2, 3, 4, 5, 123456789, time.UTC)},
+		{"2020-01-02T03:04:05.123456789999+0800", time.Date(2020, 1, 2, 3, 4, 5, 123456789, time.FixedZone("", 8*3600))},
+	} {
+		var got NullTime
+		if err := (GenericColumnValue{timeType(), stringProto(test.in)}).Decode(&got); err != nil {
+			t.Errorf("Decode(%q) returns error: %v", test.in, err)
+			continue
+		}
+		if !got.Valid || !got.Time.Equal(test.want) {
+			t.Errorf("Decode(%q) = %v, want %v", test.in, got, test.want)
+		}
+		var tm time.Time
+		if err := decodeValue(stringProto(test.in), timeType(), &tm); err != nil || !tm.Equal(test.want) {
+			t.Errorf("decodeValue(%q) into time.Time = %v, %v, want %v", test.in, tm, err, test.want)
+		}
+		v, err := ValueFromString(test.in, timeType())
+		if err != nil {
+			t.Errorf("ValueFromString(%q) returns error: %v", test.in, err)
+		} else if want := timeProto(test.want); !proto.Equal(v, want) {
+			t.Errorf("ValueFromString(%q) = %v, want %v", test.in, v, want)
+		}
+	}
+
+	var got NullTime
+	err := (GenericColumnValue{timeType(), stringProto("not a time")}).Decode(&got)
+	if err == nil {
+		t.Fatalf("Decode(%q) returns nil, want error", "not a time")
+	}
+	if ErrCode(err) != codes.FailedPrecondition || !strings.Contains(ErrDesc(err), "wasn't correctly encoded") {
+		t.Errorf("Decode(%q) returns error %v, want a bad encoding error", "not a time", err)
+	}
+
+	// Malformed timestamps, other types and nil destinations fail for
+	// time.Time too.
+	tm := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	err = decodeValue(stringProto("not a time"), timeType(), &tm)
+	if ErrCode(err) != codes.FailedPrecondition || !strings.Contains(ErrDesc(err), "wasn't correctly encoded") {
+		t.Errorf("decodeValue(%q) into time.Time returns error %v, want a bad encoding error", "not a time", err)
+	}
+	if want := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC); !tm.Equal(want) {
+		t.Errorf("failed decodeValue changed time.Time to %v, want %v", tm, want)
+	}
+	if err := decodeValue(intProto(1), intType(), &tm); ErrCode(err) != codes.InvalidArgument {
+		t.Errorf("decodeValue(INT64) into time.Time returns error %v, want code %v", err, codes.InvalidArgument)
+	}
+	var nilTime *time.Time
+	if err := decodeValue(stringProto("2020-01-02T03:04:05Z"), timeType(), nilTime); !reflect.DeepEqual(err, errNilDst(nilTime)) {
+		t.Errorf("decodeValue into nil *time.Time returns error %v, want %v", err, errNilDst(nilTime))
+	}
+}
+
+func TestEncodeNullArray(t *testing.T) {
+	for _, code := range []tspb.TypeCode{
+		tspb.TypeCode_BOOL, tspb.TypeCode_INT64, tspb.TypeCode_FLOAT64, tspb.TypeCode_TIMESTAMP,
+		tspb.TypeCode_DATE, tspb.TypeCode_STRING, tspb.TypeCode_BYTES,
+	} {
+		in := NullArray{ElementType: code}
+		pb, pt, err := encodeValue(in)
+		if err != nil {
+			t.Errorf("encodeValue(%v) returns error: %v", code, err)
+			continue
+		}
+		if !proto.Equal(pb, nullProto()) {
+			t.Errorf("encodeValue(%v) = %v, want NULL", code, pb)
+		}
+		if want := listType(&tspb.Type{Code: code}); !proto.Equal(pt, want) {
+			t.Errorf("encodeValue(%v) has type %v, want %v", code, pt, want)
+		}
+		// It decodes as any NULL array.
+		var got []GenericColumnValue
+		if err := decodeValue(pb, pt, &got); err != nil || got != nil {
+			t.Errorf("decoding %v = %v, %v, want nil, nil", code, got, err)
+		}
+	}
+	for _, code := range []tspb.TypeCode{tspb.TypeCode_TYPE_CODE_UNSPECIFIED, tspb.TypeCode_ARRAY, tspb.TypeCode_STRUCT} {
+		if _, _, err := encodeValue(NullArray{ElementType: code}); ErrCode(err) != codes.InvalidArgument {
+			t.Errorf("encodeValue(NullArray{%v}) returns error %v, want code %v", code, err, codes.InvalidArgument)
+		}
+	}
+}
+
+func TestEncodeTruncateToMicros(t *testing.T) {
+	truncate := EncodeOptions{TruncateToMicros: true}
+	in := time.Date(2020, 1, 2, 3, 4, 5, 123456789, time.UTC)
+	want := time.Date(2020, 1, 2, 3, 4, 5, 123456000, time.UTC)
+
+	// storedTime is the time the server keeps for an encoded TIMESTAMP.
+	storedTime := func(v *tspb.Value) time.Time {
+		ts := v.GetTimestampValue()
+		return time.Unix(ts.Seconds, int64(ts.Nanos)).UTC()
+	}
+	for _, x := range []interface{}{in, NullTime{in, true}} {
+		gcv, err := NewGenericColumnValueWithOptions(x, truncate)
+		if err != nil {
+			t.Fatalf("NewGenericColumnValueWithOptions(%v) returns error: %v", x, err)
+		}
+		got := storedTime(gcv.Value)
+		if !got.Equal(want) {
+			t.Errorf("NewGenericColumnValueWithOptions(%v) encodes %v, want %v", x, got, want)
+		}
+		// Writing back the stored value encodes the same TIMESTAMP.
+		again, err := NewGenericColumnValueWithOptions(got, truncate)
+		if err != nil {
+			t.Fatalf("NewGenericColumnValueWithOptions(%v) returns error: %v", got, err)
+		}
+		if !proto.Equal(again.Value, gcv.Value) {
+			t.Errorf("re-encoding %v = %v, want %v", got, again.Value, gcv.Value)
+		}
+	}
+	gcv, err := NewGenericColumnValueWithOptions([]time.Time{in}, truncate)
+	if err != nil {
+		t.Fatalf("NewGenericColumnValueWithOptions([]time.Time) returns error: %v", err)
+	}
+	if got := storedTime(gcv.Value.GetListValue().Values[0]); !got.Equal(want) {
+		t.Errorf("NewGenericColumnValueWithOptions([]time.Time) encodes %v, want %v", got, want)
+	}
+
+	// Nanoseconds are kept by default.
+	gcv, err = NewGenericColumnValue(in)
+	if err != nil {
+		t.Fatalf("NewGenericColumnValue(%v) returns error: %v", in, err)
+	}
+	if got := storedTime(gcv.Value); !got.Equal(in) {
+		t.Errorf("NewGenericColumnValue(%v) encodes %v, want %v", in, got, in)
+	}
+}
+
+func TestColumnsAndValuesMasked(t *testing.T) {
+	type user struct {
+		ID    int64
+		Name  string
+		Email NullString
+		Age   int64
+	}
+	u := &user{ID: 1, Name: "", Email: NullString{"a@b.c", true}, Age: 0}
+
+	cols, vals, err := ColumnsAndValuesMasked(u, []string{"Age", "ID", "Name"})
+	if err != nil {
+		t.Fatalf("ColumnsAndValuesMasked returns error: %v", err)
+	}
+	if want := []string{"ID", "Name", "Age"}; !reflect.DeepEqual(cols, want) {
+		t.Errorf("ColumnsAndValuesMasked columns = %v, want %v", cols, want)
+	}
+	if want := []interface{}{int64(1), "", int64(0)}; !reflect.DeepEqual(vals, want) {
+		t.Errorf("ColumnsAndValuesMasked values = %v, want %v", vals, want)
+	}
+
+	for _, mask := range [][]string{nil, {}} {
+		cols, vals, err := ColumnsAndValuesMasked(*u, mask)
+		if err != nil || len(cols) != 0 || len(vals) != 0 {
+			t.Errorf("ColumnsAndValuesMasked(%#v) = %v, %v, %v, want no columns", mask, cols, vals, err)
+		}
+	}
+
+	if _, _, err := ColumnsAndValuesMasked(u, []string{"ID", "Nickname"}); ErrCode(err) != codes.InvalidArgument {
+		t.Errorf("ColumnsAndValuesMasked with unknown column returns error %v, want code %v", err, codes.InvalidArgument)
+	}
+	if _, _, err := ColumnsAndValuesMasked(1, []string{"ID"}); err == nil {
+		t.Errorf("ColumnsAndValuesMasked(1) returns nil, want error")
+	}
+}
+
+func TestRawJSON(t *testing.T) {
+	// Whitespace and key order are kept as is.
+	raw := `{ "b": [1, 2],"a" : null }`
+	gcv, err := NewGenericColumnValue(json.RawMessage(raw))
+	if err != nil {
+		t.Fatalf("NewGenericColumnValue(%s) returns error: %v", raw, err)
+	}
+	if !proto.Equal(gcv.Type, stringType()) || !proto.Equal(gcv.Value, stringProto(raw)) {
+		t.Errorf("NewGenericColumnValue(%s) = %v, want STRING %q", raw, gcv, raw)
+	}
+	for _, opts := range []DecodeOptions{{}, {ValidateJSON: true}} {
+		var got json.RawMessage
+		if err := gcv.DecodeWithOptions(&got, opts); err != nil {
+			t.Fatalf("DecodeWithOptions(%+v) returns error: %v", opts, err)
+		}
+		if string(got) != raw {
+			t.Errorf("DecodeWithOptions(%+v) = %s, want %s", opts, got, raw)
+		}
+	}
+
+	bad := GenericColumnValue{stringType(), stringProto("{not json")}
+	var got json.RawMessage
+	if err := bad.Decode(&got); err != nil || string(got) != "{not json" {
+		t.Errorf("Decode(%v) = %s, %v, want the raw text unchecked", bad, got, err)
+	}
+	if err := bad.DecodeWithOptions(&got, DecodeOptions{ValidateJSON: true}); ErrCode(err) != codes.FailedPrecondition {
+		t.Errorf("DecodeWithOptions(%v) with ValidateJSON returns error %v, want code %v", bad, err, codes.FailedPrecondition)
+	}
+
+	null := GenericColumnValue{stringType(), nullProto()}
+	got = json.RawMessage("x")
+	if err := null.Decode(&got); err != nil || got != nil {
+		t.Errorf("Decode(NULL) = %s, %v, want nil, nil", got, err)
+	}
+	if err := (GenericColumnValue{intType(), intProto(1)}).Decode(&got); err == nil {
+		t.Errorf("decoding INT64 into json.RawMessage returns nil, want error")
+	}
+}
+
+// Test that invalid NullString elements encode as NULL list elements, while
+// valid empty strings stay strings.
+func TestEncodeNullStringArrayElements(t *testing.T) {
+	pb, pt, err := encodeValue([]NullString{{"", false}, {"", true}, {"x", true}, {"stale", false}})
+	if err != nil {
+		t.Fatalf("encodeValue returns error: %v", err)
+	}
+	if want := listType(stringType()); !proto.Equal(pt, want) {
+		t.Errorf("encodeValue has type %v, want %v", pt, want)
+	}
+	want := listProto(nullProto(), stringProto(""), stringProto("x"), nullProto())
+	if !proto.Equal(pb, want) {
+		t.Errorf("encodeValue = %v, want %v", pb, want)
+	}
+	for i, v := range pb.GetListValue().GetValues() {
+		if _, isString := v.GetKind().(*tspb.Value_StringValue); isString == IsNullValue(v) {
+			t.Errorf("element %d = %v, want either a NULL or a string", i, v)
+		}
+	}
+}
+
+func TestValueKindName(t *testing.T) {
+	for _, test := range []struct {
+		in   *tspb.Value
+		want string
+	}{
+		{nullProto(), "NULL"},
+		{&tspb.Value{Kind: &tspb.Value_NumberValue{NumberValue: 1}}, "NUMBER"},
+		{stringProto("x"), "STRING"},
+		{boolProto(true), "BOOL"},
+		{&tspb.Value{Kind: &tspb.Value_StructValue{}}, "STRUCT"},
+		{listProto(), "LIST"},
+		{&tspb.Value{Kind: &tspb.Value_IntegerValue{IntegerValue: 1}}, "INTEGER"},
+		{bytesProto([]byte("x")), "BYTES"},
+		{timeProto(time.Unix(0, 0)), "TIMESTAMP"},
+		{&tspb.Value{}, "UNSET"},
+		{nil, "UNSET"},
+	} {
+		if got := ValueKindName(test.in); got != test.want {
+			t.Errorf("ValueKindName(%v) = %q, want %q", test.in, got, test.want)
+		}
+	}
+	err := errSrcVal(boolProto(true), "String")
+	if !strings.Contains(ErrDesc(err), "(Kind: BOOL)") {
+		t.Errorf("errSrcVal = %q, want it to name the BOOL kind", ErrDesc(err))
+	}
+}
+
+func TestEncodeRejectNULInString(t *testing.T) {
+	reject := EncodeOptions{RejectNULInString: true}
+	for _, in := range []interface{}{
+		"a\x00b",
+		NullString{"\x00", true},
+		[]string{"ok", "a\x00"},
+		[]NullString{{}, {"\x00", true}},
+		json.RawMessage("\"\x00\""),
+	} {
+		_, err := NewGenericColumnValueWithOptions(in, reject)
+		if err == nil {
+			t.Errorf("NewGenericColumnValueWithOptions(%q) succeeds, want error", in)
+			continue
+		}
+		if ErrCode(err) != codes.InvalidArgument || !strings.Contains(ErrDesc(err), "BYTES") {
+			t.Errorf("NewGenericColumnValueWithOptions(%q) returns %v, want error suggesting BYTES", in, err)
+		}
+		// Without the option the string is encoded.
+		if _, err := NewGenericColumnValue(in); err != nil {
+			t.Errorf("NewGenericColumnValue(%q) returns error: %v", in, err)
+		}
+	}
+	// Strings without NUL and binary BYTES are accepted.
+	for _, in := range []interface{}{"abc", NullString{}, []byte("a\x00b")} {
+		if _, err := NewGenericColumnValueWithOptions(in, reject); err != nil {
+			t.Errorf("NewGenericColumnValueWithOptions(%q) returns error: %v", in, err)
+		}
+	}
+}
+
+func TestDecodeStructToTypedMap(t *testing.T) {
+	ty := &tspb.StructType{Fields: []*tspb.StructType_Field{
+		mkField("clicks", intType()), mkField("views", intType()),
+	}}
+	pb := &tspb.ListValue{Values: []*tspb.Value{intProto(3), intProto(10)}}
+
+	var got map[string]int64
+	if err := DecodeStructToTypedMap(ty, pb, &got); err != nil {
+		t.Fatalf("DecodeStructToTypedMap returns error: %v", err)
+	}
+	if want := map[string]int64{"clicks": 3, "views": 10}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DecodeStructToTypedMap = %v, want %v", got, want)
+	}
+
+	// Null* element types accept NULL fields.
+	nullable := map[string]NullInt64{"kept": {1, true}}
+	pb = &tspb.ListValue{Values: []*tspb.Value{intProto(3), nullProto()}}
+	if err := DecodeStructToTypedMap(ty, pb, &nullable); err != nil {
+		t.Fatalf("DecodeStructToTypedMap returns error: %v", err)
+	}
+	if want := map[string]NullInt64{"kept": {1, true}, "clicks": {3, true}, "views": {}}; !reflect.DeepEqual(nullable, want) {
+		t.Errorf("DecodeStructToTypedMap = %v, want %v", nullable, want)
+	}
+
+	mixed := &tspb.StructType{Fields: []*tspb.StructType_Field{
+		mkField("clicks", intType()), mkField("label", stringType()),
+	}}
+	pb = &tspb.ListValue{Values: []*tspb.Value{intProto(3), stringProto("x")}}
+	got = map[string]int64{"old": 1}
+	err := DecodeStructToTypedMap(mixed, pb, &got)
+	if err == nil {
+		t.Fatalf("DecodeStructToTypedMap of mixed STRUCT returns nil, want error")
+	}
+	if !strings.Contains(ErrDesc(err), "label") {
+		t.Errorf("DecodeStructToTypedMap returns error %q, want it to name field label", ErrDesc(err))
+	}
+	if want := map[string]int64{"old": 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DecodeStructToTypedMap changed destination to %v on error, want %v", got, want)
+	}
+
+	for _, dst := range []interface{}{nil, got, &[]int64{}, (*map[string]int64)(nil), &map[int]int64{}} {
+		if err := DecodeStructToTypedMap(ty, pb, dst); err == nil {
+			t.Errorf("DecodeStructToTypedMap(%T) returns nil, want error", dst)
+		}
+	}
+}
+
+func TestEncodeIntegerKinds(t *testing.T) {
+	type level int16
+	for _, test := range []struct {
+		in   interface{}
+		want int64
+	}{
+		{int8(-8), -8},
+		{int16(-16), -16},
+		{int32(math.MinInt32), math.MinInt32},
+		{uint(7), 7},
+		{uint8(8), 8},
+		{uint16(math.MaxUint16), math.MaxUint16},
+		{uint32(math.MaxUint32), math.MaxUint32},
+		{uint64(math.MaxInt64), math.MaxInt64},
+		{level(3), 3},
+	} {
+		pb, pt, err := encodeValue(test.in)
+		if err != nil {
+			t.Errorf("encodeValue(%T(%v)) returns error: %v", test.in, test.in, err)
+			continue
+		}
+		if !proto.Equal(pb, intProto(test.want)) || !proto.Equal(pt, intType()) {
+			t.Errorf("encodeValue(%T(%v)) = %v, %v, want INT64 %v", test.in, test.in, pb, pt, test.want)
+		}
+	}
+	for _, in := range []interface{}{uint64(math.MaxInt64 + 1), uint(math.MaxInt64 + 1)} {
+		if _, _, err := encodeValue(in); ErrCode(err) != codes.InvalidArgument {
+			t.Errorf("encodeValue(%T(MaxInt64+1)) returns error %v, want code %v", in, err, codes.InvalidArgument)
+		}
+	}
+	if _, _, err := encodeValue(make(chan int)); ErrCode(err) != codes.InvalidArgument {
+		t.Errorf("encodeValue(chan int) returns error %v, want code %v", err, codes.InvalidArgument)
+	}
+
+	// Struct fields of other integer kinds can be written.
+	m, err := InsertStruct("t", struct {
+		Small int32
+		Count uint32
+	}{-1, 2})
+	if err != nil {
+		t.Fatalf("InsertStruct returns error: %v", err)
+	}
+	for _, v := range m.values {
+		if _, _, err := encodeValue(v); err != nil {
+			t.Errorf("encodeValue(%T) returns error: %v", v, err)
+		}
+	}
+}
+
+func TestEncodeColumnBatch(t *testing.T) {
+	for _, test := range []struct {
+		t      *tspb.Type
+		values []interface{}
+	}{
+		{intType(), []interface{}{int64(1), 2, NullInt64{3, true}, NullInt64{}, nil, int32(4)}},
+		{stringType(), []interface{}{"a", NullString{"b", true}, NullString{}, nil}},
+		{floatType(), []interface{}{1.5, NullFloat64{2, true}, nil}},
+		{boolType(), []interface{}{true, NullBool{}}},
+		{bytesType(), []interface{}{[]byte("a"), []byte(nil)}},
+		{listType(intType()), []interface{}{[]int64{1}, []int64(nil)}},
+		{intType(), nil},
+	} {
+		got, err := EncodeColumnBatch(test.t, test.values)
+		if err != nil {
+			t.Errorf("EncodeColumnBatch(%v, %v) returns error: %v", test.t, test.values, err)
+			continue
+		}
+		if len(got) != len(test.values) {
+			t.Errorf("EncodeColumnBatch(%v, %v) returns %d values, want %d", test.t, test.values, len(got), len(test.values))
+			continue
+		}
+		// The batch encodes exactly as encodeValue does.
+		for i, x := range test.values {
+			want, _, err := encodeValue(x)
+			if err != nil {
+				t.Fatalf("encodeValue(%v) returns error: %v", x, err)
+			}
+			if !proto.Equal(got[i], want) {
+				t.Errorf("EncodeColumnBatch(%v) value %d = %v, want %v", test.t, i, got[i], want)
+			}
+		}
+	}
+
+	_, err := EncodeColumnBatch(intType(), []interface{}{int64(1), "two"})
+	if ErrCode(err) != codes.InvalidArgument || !strings.Contains(ErrDesc(err), "batch value 1") {
+		t.Errorf("EncodeColumnBatch with a STRING among INT64 returns error %v, want it to name value 1", err)
+	}
+	_, err = EncodeColumnBatch(intType(), []interface{}{struct{}{}})
+	if ErrCode(err) != codes.InvalidArgument || !strings.Contains(ErrDesc(err), "batch value 0") {
+		t.Errorf("EncodeColumnBatch with an unsupported value returns error %v, want it to name value 0", err)
+	}
+	if _, err := EncodeColumnBatch(nil, []interface{}{1}); err == nil {
+		t.Errorf("EncodeColumnBatch(nil type) returns nil, want error")
+	}
+}
+
+func BenchmarkEncodeColumnBatch(b *testing.B) {
+	values := make([]interface{}, 100000)
+	for i := range values {
+		values[i] = int64(i)
+	}
+	b.Run("batch", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := EncodeColumnBatch(intType(), values); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("per-value", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			out := make([]*tspb.Value, len(values))
+			for j, x := range values {
+				v, _, err := encodeValue(x)
+				if err != nil {
+					b.Fatal(err)
+				}
+				out[j] = v
+			}
+		}
+	})
+}
+
+func TestNullRowToStruct(t *testing.T) {
+	ty := listType(structType(mkField("Name", stringType()), mkField("Age", intType())))
+	pb := listProto(listProto(stringProto("alice"), intProto(30)), nullProto())
+	var rows []NullRow
+	if err := decodeValue(pb, ty, &rows); err != nil {
+		t.Fatalf("decodeValue returns error: %v", err)
+	}
+	type person struct {
+		Name string
+		Age  int64
+	}
+	var got person
+	if err := rows[0].ToStruct(&got); err != nil {
+		t.Fatalf("ToStruct(valid) returns error: %v", err)
+	}
+	if want := (person{"alice", 30}); got != want {
+		t.Errorf("ToStruct(valid) = %+v, want %+v", got, want)
+	}
+	if err := rows[1].ToStruct(&got); ErrCode(err) != codes.InvalidArgument {
+		t.Errorf("ToStruct(NULL) returns error %v, want code %v", err, codes.InvalidArgument)
+	}
+	if err := rows[0].ToStruct(got); err == nil {
+		t.Errorf("ToStruct(non pointer) returns nil, want error")
+	}
+}
+
+func TestIntBoolCoercion(t *testing.T) {
+	coerce := DecodeOptions{IntBoolCoercion: true}
+	for _, test := range []struct {
+		in   *tspb.Value
+		want NullBool
+		fail bool
+	}{
+		{intProto(0), NullBool{false, true}, false},
+		{intProto(1), NullBool{true, true}, false},
+		{nullProto(), NullBool{}, false},
+		{intProto(2), NullBool{}, true},
+		{intProto(-1), NullBool{}, true},
+	} {
+		gcv := GenericColumnValue{intType(), test.in}
+		var got NullBool
+		err := gcv.DecodeWithOptions(&got, coerce)
+		if test.fail {
+			if ErrCode(err) != codes.OutOfRange {
+				t.Errorf("DecodeWithOptions(%v) returns error %v, want code %v", test.in, err, codes.OutOfRange)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("DecodeWithOptions(%v) returns error: %v", test.in, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("DecodeWithOptions(%v) = %v, want %v", test.in, got, test.want)
+		}
+		if test.want.Valid {
+			var b bool
+			if err := gcv.DecodeWithOptions(&b, coerce); err != nil || b != test.want.Bool {
+				t.Errorf("DecodeWithOptions(%v) into bool = %v, %v, want %v", test.in, b, err, test.want.Bool)
+			}
+		}
+		// Decoding stays strict without the option.
+		if err := gcv.Decode(&got); err == nil {
+			t.Errorf("Decode(%v) into NullBool returns nil, want error", test.in)
+		}
+	}
+	// BOOL columns decode as usual with the option.
+	var got NullBool
+	if err := (GenericColumnValue{boolType(), boolProto(true)}).DecodeWithOptions(&got, coerce); err != nil || got != (NullBool{true, true}) {
+		t.Errorf("DecodeWithOptions(BOOL) = %v, %v, want true", got, err)
+	}
+}
+
+func TestDecodeStructArrayToMap(t *testing.T) {
+	ty := &tspb.StructType{Fields: []*tspb.StructType_Field{
+		mkField("id", intType()), mkField("name", stringType()),
+	}}
+	type item struct {
+		ID   int64 `column:"id"`
+		Name string
+	}
+	unique := &tspb.ListValue{Values: []*tspb.Value{
+		listProto(intProto(1), stringProto("a")),
+		listProto(intProto(2), stringProto("b")),
+	}}
+
+	var byID map[int64]item
+	if err := DecodeStructArrayToMap(ty, unique, "id", &byID); err != nil {
+		t.Fatalf("DecodeStructArrayToMap returns error: %v", err)
+	}
+	if want := map[int64]item{1: {1, "a"}, 2: {2, "b"}}; !reflect.DeepEqual(byID, want) {
+		t.Errorf("DecodeStructArrayToMap = %v, want %v", byID, want)
+	}
+	byName := map[string]*item{"z": {9, "z"}}
+	if err := DecodeStructArrayToMap(ty, unique, "name", &byName); err != nil {
+		t.Fatalf("DecodeStructArrayToMap returns error: %v", err)
+	}
+	if want := map[string]*item{"z": {9, "z"}, "a": {1, "a"}, "b": {2, "b"}}; !reflect.DeepEqual(byName, want) {
+		t.Errorf("DecodeStructArrayToMap = %v, want %v", byName, want)
+	}
+
+	duplicate := &tspb.ListValue{Values: []*tspb.Value{
+		listProto(intProto(1), stringProto("a")),
+		listProto(intProto(1), stringProto("b")),
+	}}
+	byID = map[int64]item{7: {7, "kept"}}
+	err := DecodeStructArrayToMap(ty, duplicate, "id", &byID)
+	if ErrCode(err) != codes.FailedPrecondition || !strings.Contains(ErrDesc(err), "duplicate key") {
+		t.Errorf("DecodeStructArrayToMap with duplicate keys returns error %v, want a duplicate key error", err)
+	}
+	if want := map[int64]item{7: {7, "kept"}}; !reflect.DeepEqual(byID, want) {
+		t.Errorf("DecodeStructArrayToMap changed destination to %v on error, want %v", byID, want)
+	}
+
+	for _, test := range []struct {
+		desc     string
+		pb       *tspb.ListValue
+		keyField string
+		dst      interface{}
+	}{
+		{"NULL element", &tspb.ListValue{Values: []*tspb.Value{nullProto()}}, "id", &byID},
+		{"unknown key field", unique, "missing", &byID},
+		{"mismatched key type", unique, "name", &byID},
+		{"non struct values", unique, "id", &map[int64]int64{}},
+		{"non pointer", unique, "id", byID},
+	} {
+		if err := DecodeStructArrayToMap(ty, test.pb, test.keyField, test.dst); err == nil {
+			t.Errorf("DecodeStructArrayToMap with %v returns nil, want error", test.desc)
+		}
+	}
+
+	short := &tspb.ListValue{Values: []*tspb.Value{
+		listProto(intProto(1), stringProto("a")),
+		listProto(intProto(2)),
+	}}
+	byID = nil
+	err = DecodeStructArrayToMap(ty, short, "id", &byID)
+	if ErrCode(err) != codes.FailedPrecondition || !strings.Contains(ErrDesc(err), "2 fields but 1 values") {
+		t.Errorf("DecodeStructArrayToMap with a short element returns error %v, want a value count error", err)
+	}
+	if byID != nil {
+		t.Errorf("DecodeStructArrayToMap changed destination to %v on error, want nil", byID)
+	}
+}
+
+func TestJoinNullStrings(t *testing.T) {
+	for _, test := range []struct {
+		in   []NullString
+		want string
+	}{
+		{nil, ""},
+		{[]NullString{{"a", true}, {"", true}, {"c", true}}, "a,,c"},
+		{[]NullString{{"a", true}, {}, {"stale", false}, {"d", true}}, "a,<NULL>,<NULL>,d"},
+		{[]NullString{{}, {}}, "<NULL>,<NULL>"},
+	} {
+		if got := JoinNullStrings(test.in, ",", "<NULL>"); got != test.want {
+			t.Errorf("JoinNullStrings(%v) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+type testColor int64
+
+const (
+	testColorRed testColor = iota
+	testColorGreen
+	testColorBlue
+)
+
+func (c testColor) Valid() bool {
+	return c >= testColorRed && c <= testColorBlue
+}
+
+// Test decoding INT64 into other integer kinds, validating enum ordinals.
+func TestDecodeEnumValidator(t *testing.T) {
+	var c testColor
+	if err := decodeValue(intProto(2), intType(), &c); err != nil {
+		t.Fatalf("decodeValue(2, *testColor) = %v, want nil", err)
+	}
+	if c != testColorBlue {
+		t.Errorf("decodeValue(2, *testColor) = %v, want %v", c, testColorBlue)
+	}
+	err := decodeValue(intProto(7), intType(), &c)
+	if err == nil || ErrCode(err) != codes.OutOfRange || !strings.Contains(ErrDesc(err), "not a valid") {
+		t.Errorf("decodeValue(7, *testColor) = %v, want an OutOfRange invalid enum error", err)
+	}
+	var i32 int32
+	if err := decodeValue(intProto(-5), intType(), &i32); err != nil || i32 != -5 {
+		t.Errorf("decodeValue(-5, *int32) = %v, %v, want -5, nil", i32, err)
+	}
+	var i8 int8
+	if err := decodeValue(intProto(300), intType(), &i8); ErrCode(err) != codes.OutOfRange {
+		t.Errorf("decodeValue(300, *int8) = %v, want OutOfRange", err)
+	}
+	var u uint16
+	if err := decodeValue(intProto(-1), intType(), &u); ErrCode(err) != codes.OutOfRange {
+		t.Errorf("decodeValue(-1, *uint16) = %v, want OutOfRange", err)
+	}
+	if err := decodeValue(nullProto(), intType(), &c); ErrCode(err) != codes.InvalidArgument {
+		t.Errorf("decodeValue(NULL, *testColor) = %v, want InvalidArgument", err)
+	}
+	if err := decodeValue(stringProto("1"), stringType(), &c); err == nil {
+		t.Errorf("decodeValue(STRING, *testColor) = nil, want error")
+	}
+}
+
+func TestEncodeDateEncoding(t *testing.T) {
+	d := civil.Date{Year: 2020, Month: time.February, Day: 3}
+
+	// String form decodes back into civil.Date.
+	asString := EncodeOptions{DateEncoding: DateEncodingString}
+	gcv, err := NewGenericColumnValueWithOptions(d, asString)
+	if err != nil {
+		t.Fatalf("NewGenericColumnValueWithOptions(%v) returns error: %v", d, err)
+	}
+	if !proto.Equal(gcv.Value, stringProto("2020-02-03")) || !proto.Equal(gcv.Type, dateType()) {
+		t.Errorf("string form encodes %v, %v, want \"2020-02-03\", DATE", gcv.Value, gcv.Type)
+	}
+	var got civil.Date
+	if err := gcv.Decode(&got); err != nil || got != d {
+		t.Errorf("decoding string form = %v, %v, want %v, nil", got, err, d)
+	}
+
+	// Day offset form, from the Unix epoch by default and from a given epoch.
+	for _, test := range []struct {
+		epoch civil.Date
+		want  int64
+	}{
+		{civil.Date{}, 18295},
+		{civil.Date{Year: 2020, Month: time.January, Day: 1}, 33},
+		{civil.Date{Year: 2020, Month: time.March, Day: 1}, -27},
+	} {
+		opts := EncodeOptions{DateEncoding: DateEncodingDayOffset, DateEpoch: test.epoch}
+		for _, x := range []interface{}{d, NullDate{d, true}} {
+			gcv, err := NewGenericColumnValueWithOptions(x, opts)
+			if err != nil {
+				t.Fatalf("NewGenericColumnValueWithOptions(%v) returns error: %v", x, err)
+			}
+			if !proto.Equal(gcv.Value, intProto(test.want)) || !proto.Equal(gcv.Type, intType()) {
+				t.Errorf("day offset form of %v from %v encodes %v, %v, want %v, INT64", x, test.epoch, gcv.Value, gcv.Type, test.want)
+			}
+			epoch := test.epoch
+			if epoch == (civil.Date{}) {
+				epoch = civil.Date{Year: 1970, Month: time.January, Day: 1}
+			}
+			r := newCellRow(t, []string{"D"}, []interface{}{*gcv})
+			if got, err := r.ColumnDateFromDays("D", epoch); err != nil || got != d {
+				t.Errorf("ColumnDateFromDays(%v) = %v, %v, want %v, nil", epoch, got, err, d)
+			}
+		}
+	}
+	gcv, err = NewGenericColumnValueWithOptions([]NullDate{{d, true}, {}}, EncodeOptions{DateEncoding: DateEncodingDayOffset})
+	if err != nil {
+		t.Fatalf("NewGenericColumnValueWithOptions([]NullDate) returns error: %v", err)
+	}
+	if want := listProto(intProto(18295), nullProto()); !proto.Equal(gcv.Value, want) || !proto.Equal(gcv.Type, listType(intType())) {
+		t.Errorf("day offset form of []NullDate encodes %v, %v, want %v, ARRAY<INT64>", gcv.Value, gcv.Type, want)
+	}
+
+	// The default is unchanged.
+	gcv, err = NewGenericColumnValue(d)
+	if err != nil {
+		t.Fatalf("NewGenericColumnValue(%v) returns error: %v", d, err)
+	}
+	if !proto.Equal(gcv.Value, dateProto(d)) {
+		t.Errorf("NewGenericColumnValue(%v) encodes %v, want %v", d, gcv.Value, dateProto(d))
+	}
+}
+
+// Test decoding ARRAY<ARRAY<STRUCT>> into slices of struct slices.
+func TestDecodeNestedStructArray(t *testing.T) {
+	type edge struct {
+		From int64  `column:"from"`
+		To   int64  `column:"to"`
+		Tag  string `column:"tag"`
+	}
+	st := structType(mkField("from", intType()), mkField("to", intType()), mkField("tag", stringType()))
+	typ := listType(listType(st))
+	e := func(from, to int64, tag string) *tspb.Value {
+		return listProto(intProto(from), intProto(to), stringProto(tag))
+	}
+	v := listProto(
+		listProto(e(1, 2, "a"), e(2, 3, "b")),
+		nullProto(),
+		listProto(),
+		listProto(e(3, 1, "c"), nullProto()),
+	)
+
+	var ptrs [][]*edge
+	if err := decodeValue(v, typ, &ptrs); err != nil {
+		t.Fatalf("decodeValue(*[][]*edge) returns error: %v", err)
+	}
+	wantPtrs := [][]*edge{
+		{{1, 2, "a"}, {2, 3, "b"}},
+		nil,
+		{},
+		{{3, 1, "c"}, nil},
+	}
+	if !reflect.DeepEqual(ptrs, wantPtrs) {
+		t.Errorf("decodeValue(*[][]*edge) = %v, want %v", ptrs, wantPtrs)
+	}
+
+	// A slice of structs has no room for the NULL struct.
+	var vals [][]edge
+	if err := decodeValue(v, typ, &vals); err == nil {
+		t.Errorf("decodeValue(*[][]edge) with a NULL struct returns nil, want error")
+	}
+	v.GetListValue().Values = v.GetListValue().Values[:3]
+	if err := decodeValue(v, typ, &vals); err != nil {
+		t.Fatalf("decodeValue(*[][]edge) returns error: %v", err)
+	}
+	wantVals := [][]edge{{{1, 2, "a"}, {2, 3, "b"}}, nil, {}}
+	if !reflect.DeepEqual(vals, wantVals) {
+		t.Errorf("decodeValue(*[][]edge) = %v, want %v", vals, wantVals)
+	}
+
+	// A NULL outer array decodes to a nil slice.
+	if err := decodeValue(nullProto(), typ, &vals); err != nil || vals != nil {
+		t.Errorf("decodeValue(NULL, *[][]edge) = %v, %v, want nil, nil", vals, err)
+	}
+	var wrong [][]int64
+	if err := decodeValue(v, typ, &wrong); err == nil {
+		t.Errorf("decodeValue(*[][]int64) returns nil, want error")
+	}
+}
+
+func TestDurationString(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want time.Duration
+	}{
+		{"1h30m", 90 * time.Minute},
+		{"500ms", 500 * time.Millisecond},
+	} {
+		var got time.Duration
+		if err := decodeValue(stringProto(test.in), stringType(), &got); err != nil || got != test.want {
+			t.Errorf("decodeValue(%q, *time.Duration) = %v, %v, want %v, nil", test.in, got, err, test.want)
+		}
+		var n NullDuration
+		if err := decodeValue(stringProto(test.in), stringType(), &n); err != nil || n != (NullDuration{test.want, true}) {
+			t.Errorf("decodeValue(%q, *NullDuration) = %v, %v, want %v, nil", test.in, n, err, test.want)
+		}
+	}
+	var d time.Duration
+	err := decodeValue(stringProto("90 minutes"), stringType(), &d)
+	if ErrCode(err) != codes.FailedPrecondition || !strings.Contains(ErrDesc(err), "wasn't correctly encoded") {
+		t.Errorf("decodeValue(malformed, *time.Duration) returns error %v, want a bad encoding error", err)
+	}
+	var n NullDuration
+	if err := decodeValue(nullProto(), stringType(), &n); err != nil || n.Valid {
+		t.Errorf("decodeValue(NULL, *NullDuration) = %v, %v, want an invalid NullDuration", n, err)
+	}
+
+	asString := EncodeOptions{DurationAsString: true}
+	for _, x := range []interface{}{90 * time.Minute, NullDuration{90 * time.Minute, true}} {
+		gcv, err := NewGenericColumnValueWithOptions(x, asString)
+		if err != nil {
+			t.Fatalf("NewGenericColumnValueWithOptions(%v) returns error: %v", x, err)
+		}
+		if !proto.Equal(gcv.Value, stringProto("1h30m0s")) || !proto.Equal(gcv.Type, stringType()) {
+			t.Errorf("NewGenericColumnValueWithOptions(%v) = %v, %v, want \"1h30m0s\", STRING", x, gcv.Value, gcv.Type)
+		}
+		var back time.Duration
+		if err := gcv.Decode(&back); err != nil || back != 90*time.Minute {
+			t.Errorf("decoding %v back = %v, %v, want %v", gcv.Value, back, err, 90*time.Minute)
+		}
+	}
+	gcv, err := NewGenericColumnValueWithOptions([]time.Duration{time.Second}, asString)
+	if err != nil {
+		t.Fatalf("NewGenericColumnValueWithOptions([]time.Duration) returns error: %v", err)
+	}
+	if want := listProto(stringProto("1s")); !proto.Equal(gcv.Value, want) || !proto.Equal(gcv.Type, listType(stringType())) {
+		t.Errorf("NewGenericColumnValueWithOptions([]time.Duration) = %v, %v, want %v, ARRAY<STRING>", gcv.Value, gcv.Type, want)
+	}
+	// Durations are INT64 nanoseconds by default.
+	gcv, err = NewGenericColumnValue(time.Second)
+	if err != nil || !proto.Equal(gcv.Value, intProto(int64(time.Second))) {
+		t.Errorf("NewGenericColumnValue(1s) = %v, %v, want %v", gcv, err, int64(time.Second))
+	}
+}
+
+// BenchmarkDecodeScalar decodes a million INT64 and STRING values, run with
+// -benchmem to see the allocations of the success path.
+func BenchmarkDecodeScalar(b *testing.B) {
+	const n = 1000000
+	ints, strs := make([]*tspb.Value, n), make([]*tspb.Value, n)
+	for i := range ints {
+		ints[i] = intProto(int64(i))
+		strs[i] = stringProto(strconv.Itoa(i))
+	}
+	b.Run("INT64", func(b *testing.B) {
+		b.ReportAllocs()
+		t := intType()
+		var x int64
+		for i := 0; i < b.N; i++ {
+			for _, v := range ints {
+				if err := decodeValue(v, t, &x); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("STRING", func(b *testing.B) {
+		b.ReportAllocs()
+		t := stringType()
+		var s string
+		for i := 0; i < b.N; i++ {
+			for _, v := range strs {
+				if err := decodeValue(v, t, &s); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
+
+// Test encoding nested Go structs as STRUCT and decoding them back.
+func TestEncodeNestedStruct(t *testing.T) {
+	type point struct {
+		X    int64      `column:"x"`
+		Y    int64      `column:"y"`
+		Name NullString `column:"name"`
+	}
+	type segment struct {
+		From  point     `column:"from"`
+		To    *point    `column:"to"`
+		Via   *point    `column:"via"`
+		Width NullInt64 `column:"width"`
+		Tags  []string  `column:"tags"`
+	}
+	in := segment{
+		From: point{1, 2, NullString{"a", true}},
+		To:   &point{X: 3, Y: 4},
+	}
+	pb, pt, err := encodeValue(in)
+	if err != nil {
+		t.Fatalf("encodeValue(%+v) returns error: %v", in, err)
+	}
+	pointType := structType(mkField("x", intType()), mkField("y", intType()), mkField("name", stringType()))
+	wantType := structType(
+		mkField("from", pointType),
+		mkField("to", pointType),
+		mkField("via", pointType),
+		mkField("width", intType()),
+		mkField("tags", listType(stringType())),
+	)
+	if !proto.Equal(pt, wantType) {
+		t.Errorf("encodeValue(%+v) has type %v, want %v", in, pt, wantType)
+	}
+	wantVal := listProto(
+		listProto(intProto(1), intProto(2), stringProto("a")),
+		listProto(intProto(3), intProto(4), nullProto()),
+		nullProto(),
+		nullProto(),
+		nullProto(),
+	)
+	if !proto.Equal(pb, wantVal) {
+		t.Errorf("encodeValue(%+v) = %v, want %v", in, pb, wantVal)
+	}
+
+	var got segment
+	if err := decodeStruct(pt.StructType, pb.GetListValue(), &got); err != nil {
+		t.Fatalf("decodeStruct(%v) returns error: %v", pb, err)
+	}
+	if !reflect.DeepEqual(got, in) {
+		t.Errorf("decodeStruct(%v) = %+v, want %+v", pb, got, in)
+	}
+
+	// A nil struct pointer is a NULL STRUCT.
+	pb, pt, err = encodeValue((*point)(nil))
+	if err != nil || !IsNullValue(pb) || !proto.Equal(pt, pointType) {
+		t.Errorf("encodeValue(nil *point) = %v, %v, %v, want a NULL %v", pb, pt, err, pointType)
+	}
+	// A NULL can't be decoded into a struct, only into a struct pointer.
+	var p point
+	if err := decodeValue(pb, pt, &p); ErrCode(err) != codes.InvalidArgument {
+		t.Errorf("decodeValue(NULL, *point) returns error %v, want code %v", err, codes.InvalidArgument)
+	}
+}
+
+func TestWriteRowsCSV(t *testing.T) {
+	fields := []*tspb.StructType_Field{
+		mkField("id", intType()),
+		mkField("note", stringType()),
+		mkField("tags", listType(stringType())),
+		mkField("scores", listType(floatType())),
+	}
+	rows := []*tspb.ListValue{
+		{Values: []*tspb.Value{intProto(1), stringProto("plain"), listProto(stringProto("a"), stringProto("b")), listProto(floatProto(1.5))}},
+		{Values: []*tspb.Value{intProto(2), stringProto(`say "hi", bye`), listProto(stringProto("x"), nullProto()), nullProto()}},
+		{Values: []*tspb.Value{intProto(3), nullProto(), listProto(), listProto(floatProto(math.NaN()), nullProto())}},
+	}
+	for _, test := range []struct {
+		opts CSVOptions
+		want string
+	}{
+		{
+			CSVOptions{},
+			"id,note,tags,scores\n" +
+				`1,plain,"[""a"",""b""]",[1.5]` + "\n" +
+				`2,"say ""hi"", bye","[""x"",null]",` + "\n" +
+				`3,,[],"[""NaN"",null]"` + "\n",
+		},
+		{
+			CSVOptions{Comma: ';', NullToken: `\N`, ArrayDelimiter: "|"},
+			"id;note;tags;scores\n" +
+				"1;plain;a|b;1.5\n" +
+				`2;"say ""hi"", bye";x|\N;\N` + "\n" +
+				`3;\N;;NaN|\N` + "\n",
+		},
+	} {
+		var b strings.Builder
+		if err := WriteRowsCSV(&b, fields, rows, test.opts); err != nil {
+			t.Fatalf("WriteRowsCSV(%+v) returns error: %v", test.opts, err)
+		}
+		if got := b.String(); got != test.want {
+			t.Errorf("WriteRowsCSV(%+v) =\n%s\nwant\n%s", test.opts, got, test.want)
+		}
+	}
+
+	short := []*tspb.ListValue{{Values: []*tspb.Value{intProto(1)}}}
+	if err := WriteRowsCSV(io.Discard, fields, short, CSVOptions{}); ErrCode(err) != codes.FailedPrecondition {
+		t.Errorf("WriteRowsCSV with a short row returns error %v, want code %v", err, codes.FailedPrecondition)
+	}
+}
+
+func TestDecodeBigFloat(t *testing.T) {
+	var f big.Float
+	if err := decodeValue(floatProto(0.1), floatType(), &f); err != nil {
+		t.Fatalf("decodeValue(0.1, *big.Float) returns error: %v", err)
+	}
+	if got, _ := f.Float64(); got != 0.1 || f.Prec() != 53 {
+		t.Errorf("decodeValue(0.1, *big.Float) = %v with precision %d, want 0.1 with precision 53", got, f.Prec())
+	}
+
+	// Accumulate at a higher precision.
+	opts := &DecodeOptions{BigFloatPrec: 200}
+	sum := new(big.Float).SetPrec(200)
+	for _, x := range []float64{1e20, 1, -1e20} {
+		var g big.Float
+		if err := decodeValueWithOptions(floatProto(x), floatType(), &g, opts); err != nil {
+			t.Fatalf("decodeValueWithOptions(%v, *big.Float) returns error: %v", x, err)
+		}
+		if g.Prec() != 200 {
+			t.Errorf("decodeValueWithOptions(%v, *big.Float) has precision %d, want 200", x, g.Prec())
+		}
+		sum.Add(sum, &g)
+	}
+	if got, _ := sum.Float64(); got != 1 {
+		t.Errorf("sum of decoded big.Float = %v, want 1", got)
+	}
+
+	for _, x := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		err := decodeValue(floatProto(x), floatType(), &f)
+		if ErrCode(err) != codes.OutOfRange || !strings.Contains(ErrDesc(err), "not a finite number") {
+			t.Errorf("decodeValue(%v, *big.Float) returns error %v, want a non-finite error", x, err)
+		}
+	}
+	if err := decodeValue(nullProto(), floatType(), &f); ErrCode(err) != codes.InvalidArgument {
+		t.Errorf("decodeValue(NULL, *big.Float) returns error %v, want code %v", err, codes.InvalidArgument)
+	}
+}
+
+func TestEncodeTypedNil(t *testing.T) {
+	// An untyped nil, including a nil interface, is an untyped NULL.
+	var s fmt.Stringer
+	for _, x := range []interface{}{nil, s} {
+		pb, pt, err := encodeValue(x)
+		if err != nil || !IsNullValue(pb) || pt != nil {
+			t.Errorf("encodeValue(%#v) = %v, %v, %v, want an untyped NULL", x, pb, pt, err)
+		}
+	}
+
+	// Nil pointers are NULLs typed as their targets.
+	for _, test := range []struct {
+		in   interface{}
+		want *tspb.Type
+	}{
+		{(*int64)(nil), intType()},
+		{(*string)(nil), stringType()},
+		{(*NullFloat64)(nil), floatType()},
+		{(*[]string)(nil), listType(stringType())},
+		{(**bool)(nil), boolType()},
+	} {
+		pb, pt, err := encodeValue(test.in)
+		if err != nil || !IsNullValue(pb) || !proto.Equal(pt, test.want) {
+			t.Errorf("encodeValue(%T(nil)) = %v, %v, %v, want a NULL %v", test.in, pb, pt, err, test.want)
+		}
+	}
+
+	// Pointers to structs, such as Null types, encode what they point to.
+	pb, pt, err := encodeValue(&NullFloat64{1.5, true})
+	if err != nil || !proto.Equal(pb, floatProto(1.5)) || !proto.Equal(pt, floatType()) {
+		t.Errorf("encodeValue(&NullFloat64{1.5}) = %v, %v, %v, want FLOAT64 1.5", pb, pt, err)
+	}
+
+	// Without a type to tell the column type from, a hint is needed.
+	for _, x := range []interface{}{(map[string]int)(nil), (chan int)(nil), (*chan int)(nil), (func())(nil)} {
+		_, _, err := encodeValue(x)
+		if ErrCode(err) != codes.InvalidArgument || !strings.Contains(ErrDesc(err), "cannot infer type of nil") {
+			t.Errorf("encodeValue(%T(nil)) returns error %v, want a type hint error", x, err)
+		}
+	}
+}
+
+func TestDecodeStructArrayToChan(t *testing.T) {
+	type item struct {
+		ID   int64  `column:"id"`
+		Name string `column:"name"`
+	}
+	ty := structType(mkField("id", intType()), mkField("name", stringType())).StructType
+	const n = 1000
+	values := make([]*tspb.Value, n)
+	for i := range values {
+		values[i] = listProto(intProto(int64(i)), stringProto(strconv.Itoa(i)))
+	}
+	pb := &tspb.ListValue{Values: values}
+
+	ch := make(chan item)
+	errc := make(chan error, 1)
+	go func() { errc <- DecodeStructArrayToChan(ty, pb, ch) }()
+	count := 0
+	for it := range ch {
+		if it.ID != int64(count) || it.Name != strconv.Itoa(count) {
+			t.Errorf("element %d = %+v, want ID %d", count, it, count)
+		}
+		count++
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("DecodeStructArrayToChan returns error: %v", err)
+	}
+	if count != n {
+		t.Errorf("DecodeStructArrayToChan sent %d elements, want %d", count, n)
+	}
+
+	// NULL elements are sent as nil pointers, and fail a chan of structs
+	// after the elements before them.
+	withNull := &tspb.ListValue{Values: []*tspb.Value{values[0], nullProto(), values[1]}}
+	pch := make(chan *item, 3)
+	if err := DecodeStructArrayToChan(ty, withNull, (chan<- *item)(pch)); err != nil {
+		t.Fatalf("DecodeStructArrayToChan(chan *item) returns error: %v", err)
+	}
+	var got []*item
+	for it := range pch {
+		got = append(got, it)
+	}
+	if want := []*item{{0, "0"}, nil, {1, "1"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DecodeStructArrayToChan(chan *item) sent %v, want %v", got, want)
+	}
+	vch := make(chan item, 3)
+	if err := DecodeStructArrayToChan(ty, withNull, vch); ErrCode(err) != codes.InvalidArgument {
+		t.Errorf("DecodeStructArrayToChan(chan item) with NULL returns error %v, want code %v", err, codes.InvalidArgument)
+	}
+	if it, ok := <-vch; !ok || it.ID != 0 {
+		t.Errorf("DecodeStructArrayToChan(chan item) first sent %+v, %v, want ID 0", it, ok)
+	}
+	if _, ok := <-vch; ok {
+		t.Errorf("DecodeStructArrayToChan(chan item) did not close the channel after an error")
+	}
+
+	// An element with fewer values than the STRUCT has fields fails before
+	// it is sent, and the channel is still closed.
+	short := &tspb.ListValue{Values: []*tspb.Value{values[0], listProto(intProto(1))}}
+	sch := make(chan item, 2)
+	err := DecodeStructArrayToChan(ty, short, sch)
+	if ErrCode(err) != codes.FailedPrecondition || !strings.Contains(ErrDesc(err), "2 fields but 1 values") {
+		t.Errorf("DecodeStructArrayToChan with a short element returns error %v, want a value count error", err)
+	}
+	if it, ok := <-sch; !ok || it.ID != 0 {
+		t.Errorf("DecodeStructArrayToChan with a short element first sent %+v, %v, want ID 0", it, ok)
+	}
+	if _, ok := <-sch; ok {
+		t.Errorf("DecodeStructArrayToChan with a short element did not close the channel")
+	}
+
+	for _, ch := range []interface{}{nil, make(chan int), make(<-chan item), []item{}} {
+		if err := DecodeStructArrayToChan(ty, pb, ch); ErrCode(err) != codes.InvalidArgument {
+			t.Errorf("DecodeStructArrayToChan(%T) returns error %v, want code %v", ch, err, codes.InvalidArgument)
+		}
+	}
+}
+
+func TestDecodeDateValidation(t *testing.T) {
+	var d civil.Date
+	if err := decodeValue(stringProto("2020-02-29"), dateType(), &d); err != nil || d != (civil.Date{Year: 2020, Month: time.February, Day: 29}) {
+		t.Errorf("decodeValue(2020-02-29) = %v, %v, want 2020-02-29", d, err)
+	}
+	for _, s := range []string{"2020-02-30", "2021-02-29", "2020-13-01", "2020-00-10", "2020-04-31"} {
+		var d civil.Date
+		err := decodeValue(stringProto(s), dateType(), &d)
+		if ErrCode(err) != codes.FailedPrecondition || !strings.Contains(ErrDesc(err), "wasn't correctly encoded") {
+			t.Errorf("decodeValue(%q, *civil.Date) returns error %v, want a bad encoding error", s, err)
+		}
+		var nd NullDate
+		if err := decodeValue(stringProto(s), dateType(), &nd); err == nil {
+			t.Errorf("decodeValue(%q, *NullDate) = %v, want error", s, nd)
+		}
+	}
+}
+
+// testHosts implements flag.Value, holding a comma separated list of hosts.
+type testHosts []string
+
+func (h *testHosts) String() string {
+	return strings.Join(*h, ",")
+}
+
+func (h *testHosts) Set(s string) error {
+	if s == "" {
+		return fmt.Errorf("empty host list")
+	}
+	*h = strings.Split(s, ",")
+	return nil
+}
+
+func TestDecodeStringSetter(t *testing.T) {
+	var hosts testHosts
+	var _ flag.Value = &hosts
+	if err := decodeValue(stringProto("a:1,b:2"), stringType(), &hosts); err != nil {
+		t.Fatalf("decodeValue(*testHosts) returns error: %v", err)
+	}
+	if want := (testHosts{"a:1", "b:2"}); !reflect.DeepEqual(hosts, want) {
+		t.Errorf("decodeValue(*testHosts) = %v, want %v", hosts, want)
+	}
+	err := decodeValue(stringProto(""), stringType(), &hosts)
+	if ErrCode(err) != codes.FailedPrecondition || !strings.Contains(ErrDesc(err), "empty host list") {
+		t.Errorf("decodeValue(\"\", *testHosts) returns error %v, want the Set error", err)
+	}
+	if err := decodeValue(nullProto(), stringType(), &hosts); ErrCode(err) != codes.InvalidArgument {
+		t.Errorf("decodeValue(NULL, *testHosts) returns error %v, want code %v", err, codes.InvalidArgument)
+	}
+	if err := decodeValue(intProto(1), intType(), &hosts); err == nil {
+		t.Errorf("decodeValue(INT64, *testHosts) returns nil, want error")
+	}
+	var nilHosts *testHosts
+	if err := decodeValue(stringProto("a:1"), stringType(), nilHosts); !reflect.DeepEqual(err, errNilDst(nilHosts)) {
+		t.Errorf("decodeValue(nil *testHosts) returns error %v, want %v", err, errNilDst(nilHosts))
+	}
+}
+
+func TestForceNull(t *testing.T) {
+	for _, test := range []struct {
+		in   ForceNull
+		want *tspb.Type
+	}{
+		{ForceNull{int64(5)}, intType()},
+		{ForceNull{"x"}, stringType()},
+		{ForceNull{NullFloat64{}}, floatType()},
+		{ForceNull{[]string(nil)}, listType(stringType())},
+		{ForceNull{(*bool)(nil)}, boolType()},
+		// Only the type matters, values rejected by options are fine.
+		{ForceNull{time.Time{}}, timeType()},
+	} {
+		gcv, err := NewGenericColumnValueWithOptions(test.in, EncodeOptions{RejectZeroTime: true})
+		if err != nil {
+			t.Errorf("encoding %#v returns error: %v", test.in, err)
+			continue
+		}
+		if !IsNullValue(gcv.Value) || !proto.Equal(gcv.Type, test.want) {
+			t.Errorf("encoding %#v = %v, %v, want a NULL %v", test.in, gcv.Value, gcv.Type, test.want)
+		}
+	}
+	// Options choosing the type apply to the NULL as to a value.
+	for _, test := range []struct {
+		in   ForceNull
+		opts EncodeOptions
+		want *tspb.Type
+	}{
+		{ForceNull{time.Duration(0)}, EncodeOptions{DurationAsString: true}, stringType()},
+		{ForceNull{NullDuration{}}, EncodeOptions{DurationAsString: true}, stringType()},
+		{ForceNull{[]time.Duration(nil)}, EncodeOptions{DurationAsString: true}, listType(stringType())},
+		{ForceNull{civil.Date{}}, EncodeOptions{DateEncoding: DateEncodingDayOffset}, intType()},
+		{ForceNull{NullDate{}}, EncodeOptions{DateEncoding: DateEncodingDayOffset}, intType()},
+		{ForceNull{"a\x00b"}, EncodeOptions{RejectNULInString: true}, stringType()},
+	} {
+		gcv, err := NewGenericColumnValueWithOptions(test.in, test.opts)
+		if err != nil {
+			t.Errorf("encoding %#v with %+v returns error: %v", test.in, test.opts, err)
+			continue
+		}
+		_, want, err := encodeValueWithOptions(test.in.Value, &test.opts)
+		if err == nil && want != nil && !proto.Equal(want, test.want) {
+			t.Errorf("encoding %#v with %+v as a value has type %v, want %v", test.in.Value, test.opts, want, test.want)
+		}
+		if !IsNullValue(gcv.Value) || !proto.Equal(gcv.Type, test.want) {
+			t.Errorf("encoding %#v with %+v = %v, %v, want a NULL %v", test.in, test.opts, gcv.Value, gcv.Type, test.want)
+		}
+	}
+	if _, _, err := encodeValue(ForceNull{}); ErrCode(err) != codes.InvalidArgument {
+		t.Errorf("encodeValue(ForceNull{}) returns error %v, want code %v", err, codes.InvalidArgument)
+	}
+
+	// In a map of parameters.
+	_, vals, err := CellsFromMap("info", map[string]interface{}{"age": ForceNull{int64(0)}})
+	if err != nil {
+		t.Fatalf("CellsFromMap returns error: %v", err)
+	}
+	if !IsNullValue(vals[0]) {
+		t.Errorf("CellsFromMap with ForceNull = %v, want NULL", vals[0])
+	}
+
+	// With a nullable tag on a nil pointer field.
+	age := int64(3)
+	type user struct {
+		ID    int64      `column:"id"`
+		Age   *int64     `column:"age,nullable"`
+		Score *NullInt64 `column:"score,nullable"`
+	}
+	for _, u := range []user{{1, nil, nil}, {2, &age, &NullInt64{4, true}}} {
+		m, err := InsertStruct("users", u)
+		if err != nil {
+			t.Fatalf("InsertStruct(%+v) returns error: %v", u, err)
+		}
+		if want := []string{"id", "age", "score"}; !reflect.DeepEqual(m.columns, want) {
+			t.Errorf("InsertStruct(%+v) columns = %v, want %v", u, m.columns, want)
+		}
+		for i, v := range m.values[1:] {
+			pb, pt, err := encodeValue(v)
+			if err != nil {
+				t.Fatalf("encodeValue(%#v) returns error: %v", v, err)
+			}
+			if !proto.Equal(pt, intType()) {
+				t.Errorf("InsertStruct(%+v) column %v has type %v, want INT64", u, m.columns[i+1], pt)
+			}
+			if got := IsNullValue(pb); got != (u.Age == nil) {
+				t.Errorf("InsertStruct(%+v) column %v is NULL = %v, want %v", u, m.columns[i+1], got, u.Age == nil)
+			}
+		}
+	}
+}
+
+func TestRegexp(t *testing.T) {
+	var re *regexp.Regexp
+	if err := decodeValue(stringProto(`^user-(\d+)$`), stringType(), &re); err != nil {
+		t.Fatalf("decodeValue(**regexp.Regexp) returns error: %v", err)
+	}
+	if m := re.FindStringSubmatch("user-42"); len(m) != 2 || m[1] != "42" {
+		t.Errorf("decoded regexp matches user-42 as %q, want [user-42 42]", m)
+	}
+	pb, pt, err := encodeValue(re)
+	if err != nil || !proto.Equal(pb, stringProto(`^user-(\d+)$`)) || !proto.Equal(pt, stringType()) {
+		t.Errorf("encodeValue(%v) = %v, %v, %v, want the pattern as STRING", re, pb, pt, err)
+	}
+
+	err = decodeValue(stringProto(`user-(\d+`), stringType(), &re)
+	if ErrCode(err) != codes.FailedPrecondition || !strings.Contains(ErrDesc(err), "missing closing )") {
+		t.Errorf("decodeValue(malformed, **regexp.Regexp) returns error %v, want a bad encoding error", err)
+	}
+	if err := decodeValue(nullProto(), stringType(), &re); err != nil || re != nil {
+		t.Errorf("decodeValue(NULL, **regexp.Regexp) = %v, %v, want nil, nil", re, err)
+	}
+}
+
+func TestNullBytes(t *testing.T) {
+	for _, test := range []struct {
+		in   NullBytes
+		want *tspb.Value
+	}{
+		{NullBytes{}, nullProto()},
+		{NullBytes{Bytes: []byte("abc")}, nullProto()},
+		{NullBytes{Bytes: []byte("abc"), Valid: true}, bytesProto([]byte("abc"))},
+		{NullBytes{Bytes: []byte{}, Valid: true}, bytesProto([]byte{})},
+		{NullBytes{Valid: true}, bytesProto([]byte{})},
+	} {
+		pb, _, err := encodeValue(test.in)
+		if err != nil || !proto.Equal(pb, test.want) {
+			t.Errorf("encodeValue(%v) = %v, %v, want %v", test.in, pb, err, test.want)
+		}
+		var got NullBytes
+		if err := decodeValue(pb, bytesType(), &got); err != nil {
+			t.Errorf("decodeValue(%v, *NullBytes) returns error: %v", pb, err)
+			continue
+		}
+		if got.Valid != test.in.Valid || (got.Valid && (got.Bytes == nil || !bytes.Equal(got.Bytes, test.in.Bytes))) {
+			t.Errorf("decodeValue(%v, *NullBytes) = %#v, want %#v", pb, got, test.in)
+		}
+	}
+
+	in := []NullBytes{{Bytes: []byte("a"), Valid: true}, {}, {Bytes: []byte{}, Valid: true}}
+	pb, pt, err := encodeValue(in)
+	if err != nil || !proto.Equal(pt, listType(bytesType())) {
+		t.Fatalf("encodeValue(%v) = %v, %v, %v, want a BYTES ARRAY", in, pb, pt, err)
+	}
+	var got []NullBytes
+	if err := decodeValue(pb, pt, &got); err != nil {
+		t.Fatalf("decodeValue(%v, *[]NullBytes) returns error: %v", pb, err)
+	}
+	if !reflect.DeepEqual(got, in) {
+		t.Errorf("decodeValue(%v, *[]NullBytes) = %v, want %v", pb, got, in)
+	}
+	if err := decodeValue(nullProto(), pt, &got); err != nil || got != nil {
+		t.Errorf("decodeValue(NULL, *[]NullBytes) = %v, %v, want nil, nil", got, err)
+	}
+	if s := (NullBytes{}).String(); s != "<null>" {
+		t.Errorf("NullBytes{}.String() = %q, want <null>", s)
+	}
+}
+
+func TestNullNumeric(t *testing.T) {
+	for _, s := range []string{
+		"123.456",
+		"-0.000000001",
+		"99999999999999999999999999999.999999999",
+		"-99999999999999999999999999999.999999999",
+	} {
+		var in NullNumeric
+		in.Numeric.SetString(s)
+		in.Valid = true
+		pb, pt, err := encodeValue(in)
+		if err != nil || !proto.Equal(pt, stringType()) {
+			t.Errorf("encodeValue(%v) = %v, %v, %v, want a STRING", s, pb, pt, err)
+			continue
+		}
+		var got NullNumeric
+		if err := decodeValue(pb, pt, &got); err != nil {
+			t.Errorf("decodeValue(%v, *NullNumeric) returns error: %v", pb, err)
+			continue
+		}
+		if !got.Valid || got.Numeric.Cmp(&in.Numeric) != 0 {
+			t.Errorf("decodeValue(%v, *NullNumeric) = %v, want %v", pb, got, s)
+		}
+		var r big.Rat
+		if err := decodeValue(pb, pt, &r); err != nil || r.Cmp(&in.Numeric) != 0 {
+			t.Errorf("decodeValue(%v, *big.Rat) = %v, %v, want %v", pb, r.String(), err, s)
+		}
+	}
+
+	pb, _, err := encodeValue(NullNumeric{})
+	if err != nil || !proto.Equal(pb, nullProto()) {
+		t.Errorf("encodeValue(NullNumeric{}) = %v, %v, want NULL", pb, err)
+	}
+	got := NullNumeric{Valid: true}
+	if err := decodeValue(nullProto(), stringType(), &got); err != nil || got.Valid {
+		t.Errorf("decodeValue(NULL, *NullNumeric) = %v, %v, want Valid false", got, err)
+	}
+	err = decodeValue(stringProto("12.3.4"), stringType(), &got)
+	if ErrCode(err) != codes.FailedPrecondition {
+		t.Errorf("decodeValue(12.3.4, *NullNumeric) returns error %v, want a bad encoding error", err)
+	}
+	if err := decodeValue(intProto(1), intType(), &got); ErrCode(err) != codes.InvalidArgument {
+		t.Errorf("decodeValue(INT64, *NullNumeric) returns error %v, want a type mismatch", err)
+	}
+	if s := NumericString(big.NewRat(123456, 1000)); s != "123.456000000" {
+		t.Errorf("NumericString(123.456) = %q, want 123.456000000", s)
+	}
+}
+
+func TestDecodeArrayInto(t *testing.T) {
+	dst := make([]NullInt64, 0, 4)
+	backing := &dst[:1][0]
+	if err := DecodeIntArrayInto(listValueProto(intProto(1), nullProto(), intProto(3)), &dst); err != nil {
+		t.Fatalf("DecodeIntArrayInto returns error: %v", err)
+	}
+	if want := []NullInt64{{1, true}, {}, {3, true}}; !reflect.DeepEqual(dst, want) {
+		t.Errorf("DecodeIntArrayInto = %v, want %v", dst, want)
+	}
+	if &dst[0] != backing {
+		t.Errorf("DecodeIntArrayInto didn't reuse the backing array with enough capacity")
+	}
+	// Shorter arrays reuse it too, NULL resets an element.
+	if err := DecodeIntArrayInto(listValueProto(nullProto()), &dst); err != nil {
+		t.Fatalf("DecodeIntArrayInto returns error: %v", err)
+	}
+	if want := []NullInt64{{}}; !reflect.DeepEqual(dst, want) || &dst[0] != backing {
+		t.Errorf("DecodeIntArrayInto = %v, want %v in the same backing array", dst, want)
+	}
+	// Longer arrays grow it.
+	long := listValueProto(intProto(1), intProto(2), intProto(3), intProto(4), intProto(5))
+	if err := DecodeIntArrayInto(long, &dst); err != nil {
+		t.Fatalf("DecodeIntArrayInto returns error: %v", err)
+	}
+	if len(dst) != 5 || dst[4] != (NullInt64{5, true}) {
+		t.Errorf("DecodeIntArrayInto = %v, want 5 elements", dst)
+	}
+	// On error the slice keeps its length.
+	err := DecodeIntArrayInto(listValueProto(intProto(1), stringProto("x")), &dst)
+	if ErrCode(err) != codes.FailedPrecondition || len(dst) != 5 {
+		t.Errorf("DecodeIntArrayInto(bad element) = %v, %v, want an error and 5 elements", dst, err)
+	}
+	if err := DecodeIntArrayInto(nil, &dst); !reflect.DeepEqual(err, errNilListValue("INT64")) {
+		t.Errorf("DecodeIntArrayInto(nil) returns error %v, want %v", err, errNilListValue("INT64"))
+	}
+
+	strs := []NullString{{"stale", true}}
+	if err := DecodeStringArrayInto(listValueProto(stringProto("a"), nullProto()), &strs); err != nil {
+		t.Fatalf("DecodeStringArrayInto returns error: %v", err)
+	}
+	if want := []NullString{{"a", true}, {}}; !reflect.DeepEqual(strs, want) {
+		t.Errorf("DecodeStringArrayInto = %v, want %v", strs, want)
+	}
+	var floats []NullFloat64
+	if err := DecodeFloatArrayInto(listValueProto(floatProto(1.5)), &floats); err != nil || !reflect.DeepEqual(floats, []NullFloat64{{1.5, true}}) {
+		t.Errorf("DecodeFloatArrayInto = %v, %v, want [1.5]", floats, err)
+	}
+	var bools []NullBool
+	if err := DecodeBoolArrayInto(listValueProto(boolProto(true), nullProto()), &bools); err != nil || !reflect.DeepEqual(bools, []NullBool{{true, true}, {}}) {
+		t.Errorf("DecodeBoolArrayInto = %v, %v, want [true <null>]", bools, err)
+	}
+	var bs [][]byte
+	if err := DecodeBytesArrayInto(listValueProto(bytesProto([]byte("x")), nullProto()), &bs); err != nil || !reflect.DeepEqual(bs, [][]byte{[]byte("x"), nil}) {
+		t.Errorf("DecodeBytesArrayInto = %q, %v, want [x nil]", bs, err)
+	}
+	tm := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	var times []NullTime
+	if err := DecodeTimeArrayInto(listValueProto(stringProto(tm.Format(time.RFC3339Nano))), &times); err != nil || len(times) != 1 || !times[0].Time.Equal(tm) {
+		t.Errorf("DecodeTimeArrayInto = %v, %v, want [%v]", times, err, tm)
+	}
+	d := civil.Date{Year: 2020, Month: 1, Day: 2}
+	var dates []NullDate
+	if err := DecodeDateArrayInto(listValueProto(stringProto(d.String())), &dates); err != nil || !reflect.DeepEqual(dates, []NullDate{{d, true}}) {
+		t.Errorf("DecodeDateArrayInto = %v, %v, want [%v]", dates, err, d)
+	}
+}
+
+func BenchmarkDecodeIntArrayInto(b *testing.B) {
+	const rows, n = 1000, 100
+	arrays := make([]*tspb.ListValue, rows)
+	for i := range arrays {
+		vals := make([]*tspb.Value, n)
+		for j := range vals {
+			vals[j] = intProto(int64(i * j))
+		}
+		arrays[i] = listValueProto(vals...)
+	}
+	b.Run("Fresh", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, pb := range arrays {
+				if _, err := decodeIntArray(pb, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("Reuse", func(b *testing.B) {
+		b.ReportAllocs()
+		var dst []NullInt64
+		for i := 0; i < b.N; i++ {
+			for _, pb := range arrays {
+				if err := DecodeIntArrayInto(pb, &dst); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
+
+func TestUint64(t *testing.T) {
+	for _, x := range []uint64{0, 42, math.MaxInt64} {
+		for _, in := range []interface{}{x, NullUint64{x, true}} {
+			pb, pt, err := encodeValue(in)
+			if err != nil || !proto.Equal(pb, intProto(int64(x))) || !proto.Equal(pt, intType()) {
+				t.Errorf("encodeValue(%v) = %v, %v, %v, want INT64 %v", in, pb, pt, err, x)
+			}
+		}
+		var u uint64
+		if err := decodeValue(intProto(int64(x)), intType(), &u); err != nil || u != x {
+			t.Errorf("decodeValue(%v, *uint64) = %v, %v, want %v", x, u, err, x)
+		}
+		var n NullUint64
+		if err := decodeValue(intProto(int64(x)), intType(), &n); err != nil || n != (NullUint64{x, true}) {
+			t.Errorf("decodeValue(%v, *NullUint64) = %v, %v, want %v", x, n, err, x)
+		}
+	}
+
+	// Values above math.MaxInt64 have no INT64, they are never truncated or
+	// wrapped around.
+	for _, in := range []interface{}{uint64(math.MaxInt64 + 1), uint64(math.MaxUint64), NullUint64{math.MaxUint64, true}} {
+		if _, _, err := encodeValue(in); ErrCode(err) != codes.InvalidArgument {
+			t.Errorf("encodeValue(%v) returns error %v, want an overflow error", in, err)
+		}
+	}
+	// Neither are negative INT64 values reinterpreted as such.
+	var u uint64
+	if err := decodeValue(intProto(-1), intType(), &u); ErrCode(err) != codes.OutOfRange {
+		t.Errorf("decodeValue(-1, *uint64) returns error %v, want an overflow error", err)
+	}
+	n := NullUint64{7, true}
+	if err := decodeValue(intProto(math.MinInt64), intType(), &n); ErrCode(err) != codes.OutOfRange {
+		t.Errorf("decodeValue(MinInt64, *NullUint64) returns error %v, want an overflow error", err)
+	}
+
+	if err := decodeValue(nullProto(), intType(), &n); err != nil || n.Valid {
+		t.Errorf("decodeValue(NULL, *NullUint64) = %v, %v, want <null>", n, err)
+	}
+	if err := decodeValue(nullProto(), intType(), &u); !reflect.DeepEqual(err, errDstNotForNull(&u)) {
+		t.Errorf("decodeValue(NULL, *uint64) returns error %v, want %v", err, errDstNotForNull(&u))
+	}
+	if pb, _, err := encodeValue(NullUint64{}); err != nil || !proto.Equal(pb, nullProto()) {
+		t.Errorf("encodeValue(NullUint64{}) = %v, %v, want NULL", pb, err)
+	}
+}
+
+func TestNarrowInts(t *testing.T) {
+	for _, test := range []struct {
+		in      int64
+		dst     interface{}
+		want    interface{}
+		wantErr bool
+	}{
+		{math.MinInt32, new(int32), int32(math.MinInt32), false},
+		{math.MaxInt32, new(int32), int32(math.MaxInt32), false},
+		{math.MinInt32 - 1, new(int32), nil, true},
+		{math.MaxInt32 + 1, new(int32), nil, true},
+		{math.MinInt16, new(int16), int16(math.MinInt16), false},
+		{math.MaxInt16, new(int16), int16(math.MaxInt16), false},
+		{math.MinInt16 - 1, new(int16), nil, true},
+		{math.MaxInt16 + 1, new(int16), nil, true},
+		{math.MinInt8, new(int8), int8(math.MinInt8), false},
+		{math.MaxInt8, new(int8), int8(math.MaxInt8), false},
+		{math.MinInt8 - 1, new(int8), nil, true},
+		{math.MaxInt8 + 1, new(int8), nil, true},
+	} {
+		err := decodeValue(intProto(test.in), intType(), test.dst)
+		if test.wantErr {
+			if ErrCode(err) != codes.OutOfRange {
+				t.Errorf("decodeValue(%v, %T) returns error %v, want an overflow error", test.in, test.dst, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("decodeValue(%v, %T) returns error: %v", test.in, test.dst, err)
+			continue
+		}
+		if got := reflect.ValueOf(test.dst).Elem().Interface(); got != test.want {
+			t.Errorf("decodeValue(%v, %T) = %v, want %v", test.in, test.dst, got, test.want)
+		}
+		pb, pt, err := encodeValue(test.want)
+		if err != nil || !proto.Equal(pb, intProto(test.in)) || !proto.Equal(pt, intType()) {
+			t.Errorf("encodeValue(%T(%v)) = %v, %v, %v, want INT64 %v", test.want, test.want, pb, pt, err, test.in)
+		}
+	}
+	var i int32
+	if err := decodeValue(nullProto(), intType(), &i); !reflect.DeepEqual(err, errDstNotForNull(&i)) {
+		t.Errorf("decodeValue(NULL, *int32) returns error %v, want %v", err, errDstNotForNull(&i))
+	}
+	if err := decodeValue(floatProto(1), floatType(), &i); ErrCode(err) != codes.InvalidArgument {
+		t.Errorf("decodeValue(FLOAT64, *int32) returns error %v, want a type mismatch", err)
+	}
+}
+
+func TestEncodeTimeArray(t *testing.T) {
+	times := []time.Time{
+		time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC),
+		time.Date(1969, 12, 31, 23, 59, 59, 999999999, time.FixedZone("x", 3600)),
+		{},
+	}
+	nulls := []NullTime{{times[0], true}, {}, {times[1], true}}
+	for _, test := range []struct {
+		in   interface{}
+		n    int
+		elem func(int) interface{}
+	}{
+		{times, len(times), func(i int) interface{} { return times[i] }},
+		{nulls, len(nulls), func(i int) interface{} { return nulls[i] }},
+	} {
+		for _, opts := range []*EncodeOptions{nil, {TruncateToMicros: true}} {
+			got, _, err := encodeValueWithOptions(test.in, opts)
+			if err != nil {
+				t.Fatalf("encodeValue(%v) returns error: %v", test.in, err)
+			}
+			want, err := encodeArrayWithOptions(test.n, test.elem, opts)
+			if err != nil {
+				t.Fatalf("encodeArrayWithOptions(%v) returns error: %v", test.in, err)
+			}
+			gb, err := proto.Marshal(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			wb, err := proto.Marshal(want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(gb, wb) {
+				t.Errorf("encodeValue(%v) = %v, want %v element by element", test.in, got, want)
+			}
+		}
+	}
+	if _, _, err := encodeValueWithOptions(times, &EncodeOptions{RejectZeroTime: true}); !reflect.DeepEqual(err, errZeroTime()) {
+		t.Errorf("encodeValue(%v, RejectZeroTime) returns error %v, want %v", times, err, errZeroTime())
+	}
+}
+
+func BenchmarkEncodeTimeArray(b *testing.B) {
+	const n = 10000
+	times := make([]time.Time, n)
+	for i := range times {
+		times[i] = time.Unix(int64(i), int64(i))
+	}
+	b.Run("ElementByElement", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := encodeArrayWithOptions(n, func(i int) interface{} { return times[i] }, nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("Array", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, _, err := encodeValue(times); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// testPoint decodes itself from a BYTES column holding "x,y".
+type testPoint struct {
+	X, Y  int64
+	Valid bool
+}
+
+func (p *testPoint) DecodeSpanner(v *tspb.Value, t *tspb.Type) error {
+	if t.GetCode() != tspb.TypeCode_BYTES {
+		return fmt.Errorf("testPoint can't be decoded from %v", t.GetCode())
+	}
+	if IsNullValue(v) {
+		*p = testPoint{}
+		return nil
+	}
+	if _, err := fmt.Sscanf(string(v.GetBytesValue()), "%d,%d", &p.X, &p.Y); err != nil {
+		return err
+	}
+	p.Valid = true
+	return nil
+}
+
+func TestDecoder(t *testing.T) {
+	var _ Decoder = &testPoint{}
+	var p testPoint
+	if err := decodeValue(bytesProto([]byte("3,4")), bytesType(), &p); err != nil {
+		t.Fatalf("decodeValue(*testPoint) returns error: %v", err)
+	}
+	if want := (testPoint{3, 4, true}); p != want {
+		t.Errorf("decodeValue(*testPoint) = %+v, want %+v", p, want)
+	}
+	if err := decodeValue(nullProto(), bytesType(), &p); err != nil || p.Valid {
+		t.Errorf("decodeValue(NULL, *testPoint) = %+v, %v, want an invalid point", p, err)
+	}
+	if err := decodeValue(bytesProto([]byte("3,4")), bytesType(), (*testPoint)(nil)); !reflect.DeepEqual(err, errNilDst((*testPoint)(nil))) {
+		t.Errorf("decodeValue(nil *testPoint) returns error %v, want %v", err, errNilDst((*testPoint)(nil)))
+	}
+	if err := decodeValue(intProto(1), intType(), &p); err == nil || !strings.Contains(err.Error(), "can't be decoded from INT64") {
+		t.Errorf("decodeValue(INT64, *testPoint) returns error %v, want the DecodeSpanner error", err)
+	}
+
+	// Errors inside a struct are wrapped with the field.
+	type shape struct {
+		Name   string
+		Center testPoint
+	}
+	ty := &tspb.StructType{Fields: []*tspb.StructType_Field{
+		{Name: "Name", Type: stringType()},
+		{Name: "Center", Type: bytesType()},
+	}}
+	var s shape
+	if err := decodeStruct(ty, listValueProto(stringProto("dot"), bytesProto([]byte("1,2"))), &s); err != nil {
+		t.Fatalf("decodeStruct(*shape) returns error: %v", err)
+	}
+	if want := (shape{"dot", testPoint{1, 2, true}}); s != want {
+		t.Errorf("decodeStruct(*shape) = %+v, want %+v", s, want)
+	}
+	err := decodeStruct(ty, listValueProto(stringProto("dot"), bytesProto([]byte("bad"))), &s)
+	if err == nil || !strings.Contains(ErrDesc(err), "cannot decode field Center") {
+		t.Errorf("decodeStruct(*shape) with a bad point returns error %v, want it wrapped with the field", err)
+	}
+}
+
+func TestValidateEncodable(t *testing.T) {
+	type address struct {
+		City string
+		Zip  NullInt64
+	}
+	type supported struct {
+		S        string
+		NS       NullString
+		Strs     []string
+		B        []byte
+		NB       NullBytes
+		I        int64
+		I32      int32
+		U        uint64
+		Ints     []NullInt64
+		F        NullFloat64
+		T        time.Time
+		NT       []NullTime
+		D        civil.Date
+		Dur      time.Duration
+		Rat      *big.Rat
+		Re       *regexp.Regexp
+		Prefix   netip.Prefix
+		Addr     address
+		Home     *address
+		Opt      *int64 `column:"opt,nullable"`
+		Any      interface{}
+		Generic  GenericColumnValue
+		Generics []GenericColumnValue
+		Forced   ForceNull
+		Ignored  chan int `column:"-"`
+	}
+	if err := ValidateEncodable(supported{}); err != nil {
+		t.Errorf("ValidateEncodable(supported{}) returns error: %v", err)
+	}
+	if err := ValidateEncodable(&supported{}); err != nil {
+		t.Errorf("ValidateEncodable(&supported{}) returns error: %v", err)
+	}
+
+	for _, test := range []struct {
+		in    interface{}
+		field string
+	}{
+		{struct {
+			ID      int64
+			Updates chan int
+		}{}, "field Updates (column \"Updates\")"},
+		{struct {
+			Tags map[string]string `column:"tags"`
+		}{}, "field Tags (column \"tags\")"},
+		{struct {
+			Count *int64
+		}{}, "field Count"},
+		{struct {
+			Addr struct {
+				City   string
+				Notify func()
+			}
+		}{}, "field Notify"},
+	} {
+		err := ValidateEncodable(test.in)
+		if ErrCode(err) != codes.InvalidArgument || !strings.Contains(ErrDesc(err), test.field) {
+			t.Errorf("ValidateEncodable(%T) returns error %v, want it to name %v", test.in, err, test.field)
+		}
+	}
+	if err := ValidateEncodable(7); !reflect.DeepEqual(err, errNotStruct(7)) {
+		t.Errorf("ValidateEncodable(7) returns error %v, want %v", err, errNotStruct(7))
+	}
+}
+
+// testMoney encodes itself as the decimal text of a STRING.
+type testMoney struct {
+	Cents int64
+}
+
+func (m testMoney) EncodeSpanner() (*tspb.Value, *tspb.Type, error) {
+	if m.Cents < 0 {
+		return nil, nil, fmt.Errorf("negative amount %d", m.Cents)
+	}
+	return stringProto(fmt.Sprintf("%d.%02d", m.Cents/100, m.Cents%100)), stringType(), nil
+}
+
+// testCents encodes itself as an INT64.
+type testCents float64
+
+func (c testCents) EncodeSpanner() (*tspb.Value, *tspb.Type, error) {
+	return intProto(int64(math.Round(float64(c) * 100))), intType(), nil
+}
+
+// testBlob encodes itself as BYTES, or wrongly as nothing if empty.
+type testBlob struct {
+	Kind string
+	Data string
+}
+
+func (b *testBlob) EncodeSpanner() (*tspb.Value, *tspb.Type, error) {
+	if b.Kind == "" {
+		return nil, nil, nil
+	}
+	return bytesProto([]byte(b.Kind + ":" + b.Data)), bytesType(), nil
+}
+
+func TestEncoder(t *testing.T) {
+	var _ Encoder = testMoney{}
+	for _, test := range []struct {
+		in     interface{}
+		wantPB *tspb.Value
+		wantPT *tspb.Type
+	}{
+		{testMoney{1234}, stringProto("12.34"), stringType()},
+		{&testMoney{5}, stringProto("0.05"), stringType()},
+		{testCents(1.5), intProto(150), intType()},
+		{&testBlob{"point", "1,2"}, bytesProto([]byte("point:1,2")), bytesType()},
+		// Nil pointers are NULLs of the type of their target.
+		{(*testMoney)(nil), nullProto(), stringType()},
+		{(*testCents)(nil), nullProto(), intType()},
+	} {
+		pb, pt, err := encodeValue(test.in)
+		if err != nil || !proto.Equal(pb, test.wantPB) || !proto.Equal(pt, test.wantPT) {
+			t.Errorf("encodeValue(%#v) = %v, %v, %v, want %v, %v, nil", test.in, pb, pt, err, test.wantPB, test.wantPT)
+		}
+	}
+	if _, _, err := encodeValue(testMoney{-1}); err == nil || err.Error() != "negative amount -1" {
+		t.Errorf("encodeValue(testMoney{-1}) returns error %v, want the EncodeSpanner error", err)
+	}
+	if _, _, err := encodeValue(&testBlob{}); !reflect.DeepEqual(err, errEncoderNilValue(&testBlob{})) {
+		t.Errorf("encodeValue(&testBlob{}) returns error %v, want %v", err, errEncoderNilValue(&testBlob{}))
+	}
+
+	// Elements of mutation values and Go struct fields encode themselves too.
+	lv, err := encodeValueArray([]interface{}{testMoney{100}, testCents(2), &testBlob{"a", "b"}})
+	if err != nil {
+		t.Fatalf("encodeValueArray returns error: %v", err)
+	}
+	if want := listValueProto(stringProto("1.00"), intProto(200), bytesProto([]byte("a:b"))); !proto.Equal(lv, want) {
+		t.Errorf("encodeValueArray = %v, want %v", lv, want)
+	}
+	type order struct {
+		ID    int64
+		Total testMoney
+	}
+	pb, pt, err := encodeValue(order{1, testMoney{250}})
+	if err != nil {
+		t.Fatalf("encodeValue(order) returns error: %v", err)
+	}
+	wantPT := &tspb.Type{Code: tspb.TypeCode_STRUCT, StructType: &tspb.StructType{Fields: []*tspb.StructType_Field{
+		mkField("ID", intType()), mkField("Total", stringType()),
+	}}}
+	if !proto.Equal(pb, listProto(intProto(1), stringProto("2.50"))) || !proto.Equal(pt, wantPT) {
+		t.Errorf("encodeValue(order) = %v, %v, want %v, %v", pb, pt, listProto(intProto(1), stringProto("2.50")), wantPT)
+	}
+	if err := ValidateEncodable(order{}); err != nil {
+		t.Errorf("ValidateEncodable(order{}) returns error: %v", err)
+	}
+}
+
+func TestDecodeIntArrayAsBools(t *testing.T) {
+	pb := listProto(intProto(0), intProto(1), nullProto(), intProto(1))
+	got, err := DecodeIntArrayAsBools(pb, listType(intType()))
+	if err != nil {
+		t.Fatalf("DecodeIntArrayAsBools returns error: %v", err)
+	}
+	if want := []NullBool{{false, true}, {true, true}, {}, {true, true}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DecodeIntArrayAsBools = %v, want %v", got, want)
+	}
+
+	_, err = DecodeIntArrayAsBools(listProto(intProto(1), intProto(2)), listType(intType()))
+	if err == nil || !strings.Contains(ErrDesc(err), "array element 1") {
+		t.Errorf("DecodeIntArrayAsBools([1 2]) returns error %v, want it for element 1", err)
+	}
+	if got, err := DecodeIntArrayAsBools(nullProto(), listType(intType())); err != nil || got != nil {
+		t.Errorf("DecodeIntArrayAsBools(NULL) = %v, %v, want nil, nil", got, err)
+	}
+	for _, ty := range []*tspb.Type{listType(boolType()), intType()} {
+		if _, err := DecodeIntArrayAsBools(listProto(boolProto(true)), ty); ErrCode(err) != codes.InvalidArgument {
+			t.Errorf("DecodeIntArrayAsBools(%v) returns error %v, want a type mismatch", ty, err)
+		}
+	}
+
+	// The option covers []NullBool, without it ARRAY<INT64> is a mismatch.
+	var bs []NullBool
+	if err := decodeValueWithOptions(pb, listType(intType()), &bs, &DecodeOptions{IntBoolCoercion: true}); err != nil || len(bs) != 4 {
+		t.Errorf("decoding ARRAY<INT64> into *[]NullBool with IntBoolCoercion = %v, %v, want 4 elements", bs, err)
+	}
+	if err := decodeValue(pb, listType(intType()), &bs); ErrCode(err) != codes.InvalidArgument {
+		t.Errorf("decoding ARRAY<INT64> into *[]NullBool returns error %v, want a type mismatch", err)
+	}
+}
+
+func TestEncodeStructFields(t *testing.T) {
+	type audit struct {
+		CreatedBy string `column:"created_by"`
+	}
+	type item struct {
+		audit
+		ID       int64  `family:"meta" column:"id"`
+		Name     string `spanner:"item_name"`
+		Price    NullFloat64
+		Stock    []NullInt64 `column:"stock"`
+		Secret   string      `column:"-"`
+		Legacy   string      `spanner:"-"`
+		internal int64
+	}
+	in := item{
+		audit: audit{"alice"},
+		ID:    7,
+		Name:  "pen",
+		Price: NullFloat64{1.5, true},
+		Stock: []NullInt64{{3, true}, {}},
+		// Skipped fields.
+		Secret:   "s",
+		Legacy:   "l",
+		internal: 9,
+	}
+	pb, pt, err := encodeValue(in)
+	if err != nil {
+		t.Fatalf("encodeValue(%+v) returns error: %v", in, err)
+	}
+	wantType := structType(
+		mkField("created_by", stringType()),
+		mkField("meta:id", intType()),
+		mkField("item_name", stringType()),
+		mkField("Price", floatType()),
+		mkField("stock", listType(intType())),
+	)
+	if !proto.Equal(pt, wantType) {
+		t.Errorf("encodeValue(%+v) has type %v, want %v", in, pt, wantType)
+	}
+
+	var got item
+	if err := decodeStruct(pt.StructType, pb.GetListValue(), &got); err != nil {
+		t.Fatalf("decodeStruct(%v) returns error: %v", pb, err)
+	}
+	want := in
+	want.Secret, want.Legacy, want.internal = "", "", 0
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decodeStruct(%v) = %+v, want %+v", pb, got, want)
+	}
+}
+
+func TestEncodeStructArray(t *testing.T) {
+	type point struct {
+		X int64  `column:"x"`
+		Y string `column:"y"`
+	}
+	type coord struct {
+		Lat  int64  `column:"x"`
+		Name string `column:"y"`
+	}
+	type other struct {
+		X int64 `column:"x"`
+		Z bool  `column:"z"`
+	}
+	pointType := structType(mkField("x", intType()), mkField("y", stringType()))
+
+	// Different Go struct types sharing the layout form one ARRAY<STRUCT>.
+	in := []interface{}{point{1, "a"}, &coord{2, "b"}, (*point)(nil)}
+	pb, pt, err := encodeValue(in)
+	if err != nil {
+		t.Fatalf("encodeValue(%v) returns error: %v", in, err)
+	}
+	if want := listType(pointType); !proto.Equal(pt, want) {
+		t.Errorf("encodeValue(%v) has type %v, want %v", in, pt, want)
+	}
+	var got []*point
+	if err := decodeValue(pb, pt, &got); err != nil {
+		t.Fatalf("decodeValue(%v) returns error: %v", pb, err)
+	}
+	if want := []*point{{1, "a"}, {2, "b"}, nil}; !reflect.DeepEqual(got, want) {
+		t.Errorf("decodeValue(%v) = %v, want %v", pb, got, want)
+	}
+
+	// A differing layout is rejected naming the field.
+	bad := []interface{}{point{1, "a"}, other{2, true}}
+	_, _, err = encodeValue(bad)
+	if err == nil || !strings.Contains(err.Error(), "array element 1 is a STRUCT") || !strings.Contains(err.Error(), "BOOL at field 1") {
+		t.Errorf("encodeValue(%v) returns error %v, want layout mismatch", bad, err)
+	}
+
+	for _, test := range []struct {
+		in     interface{}
+		isNull bool
+	}{
+		{[]point{{1, "a"}}, false},
+		{[]*point{{1, "a"}, nil}, false},
+		{[]point{}, false},
+		{[]point(nil), true},
+	} {
+		pb, pt, err := encodeValue(test.in)
+		if err != nil {
+			t.Errorf("encodeValue(%v) returns error: %v", test.in, err)
+			continue
+		}
+		if want := listType(pointType); !proto.Equal(pt, want) {
+			t.Errorf("encodeValue(%v) has type %v, want %v", test.in, pt, want)
+		}
+		if _, isNull := pb.Kind.(*tspb.Value_NullValue); isNull != test.isNull {
+			t.Errorf("encodeValue(%v) = %v, want NULL %v", test.in, pb, test.isNull)
+		}
+	}
+}
+
+func TestFingerprintStructType(t *testing.T) {
+	st := func(fs ...*tspb.StructType_Field) *tspb.StructType { return structType(fs...).StructType }
+	base := st(mkField("id", intType()), mkField("tags", listType(stringType())))
+	if got, want := FingerprintStructType(base), FingerprintStructType(proto.Clone(base).(*tspb.StructType)); got != want {
+		t.Errorf("FingerprintStructType of equal schemas = %x and %x, want equal", got, want)
+	}
+	for _, other := range []*tspb.StructType{
+		nil,
+		st(),
+		st(mkField("id", intType())),
+		st(mkField("tags", listType(stringType())), mkField("id", intType())),
+		st(mkField("ID", intType()), mkField("tags", listType(stringType()))),
+		st(mkField("id", stringType()), mkField("tags", listType(stringType()))),
+		st(mkField("id", intType()), mkField("tags", listType(bytesType()))),
+		st(mkField("id", intType()), mkField("tags", stringType())),
+		st(mkField("i", intType()), mkField("dtags", listType(stringType()))),
+		st(mkField("id", intType()), mkField("tags", structType(mkField("s", stringType())))),
+	} {
+		if FingerprintStructType(other) == FingerprintStructType(base) {
+			t.Errorf("FingerprintStructType(%v) equals that of %v, want different", other, base)
+		}
+	}
+	nested := func(ft *tspb.Type) *tspb.StructType {
+		return st(mkField("s", listType(structType(mkField("a", ft)))))
+	}
+	if FingerprintStructType(nested(intType())) == FingerprintStructType(nested(floatType())) {
+		t.Errorf("FingerprintStructType ignores types of nested STRUCT fields")
+	}
+}
+
+func TestSemVer(t *testing.T) {
+	// Valid versions round-trip through STRING.
+	for _, test := range []struct {
+		in   string
+		want SemVer
+	}{
+		{"0.0.0", SemVer{}},
+		{"1.2.3", SemVer{Major: 1, Minor: 2, Patch: 3}},
+		{"10.20.30-rc.1", SemVer{Major: 10, Minor: 20, Patch: 30, Pre: "rc.1"}},
+		{"1.0.0-alpha-beta+build.5", SemVer{Major: 1, Pre: "alpha-beta", Build: "build.5"}},
+		{"1.0.0+0017", SemVer{Major: 1, Build: "0017"}},
+	} {
+		var got SemVer
+		if err := decodeValue(stringProto(test.in), stringType(), &got); err != nil {
+			t.Errorf("decodeValue(%q) returns error: %v", test.in, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("decodeValue(%q) = %+v, want %+v", test.in, got, test.want)
+		}
+		var n NullSemVer
+		if err := decodeValue(stringProto(test.in), stringType(), &n); err != nil || !n.Valid || n.SemVer != test.want {
+			t.Errorf("decodeValue(%q) into NullSemVer = %v, %v, want %+v", test.in, n, err, test.want)
+		}
+		pb, pt, err := encodeValue(test.want)
+		if err != nil {
+			t.Errorf("encodeValue(%+v) returns error: %v", test.want, err)
+			continue
+		}
+		if !proto.Equal(pb, stringProto(test.in)) || !proto.Equal(pt, stringType()) {
+			t.Errorf("encodeValue(%+v) = %v, %v, want %q STRING", test.want, pb, pt, test.in)
+		}
+	}
+
+	// Precedence as in https://semver.org, in ascending order.
+	ordered := []string{
+		"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta",
+		"1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.0.1", "1.1.0", "2.0.0",
+	}
+	for i, a := range ordered {
+		for j, b := range ordered {
+			va, err := ParseSemVer(a)
+			if err != nil {
+				t.Fatalf("ParseSemVer(%q) returns error: %v", a, err)
+			}
+			vb, err := ParseSemVer(b)
+			if err != nil {
+				t.Fatalf("ParseSemVer(%q) returns error: %v", b, err)
+			}
+			want := 0
+			if i < j {
+				want = -1
+			} else if i > j {
+				want = 1
+			}
+			if got := va.Compare(vb); got != want {
+				t.Errorf("%q.Compare(%q) = %d, want %d", a, b, got, want)
+			}
+		}
+	}
+	if a, b := (SemVer{Major: 1, Build: "x"}), (SemVer{Major: 1, Build: "y"}); a.Compare(b) != 0 {
+		t.Errorf("%v.Compare(%v) = %d, want build metadata ignored", a, b, a.Compare(b))
+	}
+
+	// Malformed versions fail to decode.
+	for _, in := range []string{"", "1.2", "1.2.3.4", "01.2.3", "1.2.x", "1.2.3-", "1.2.3-01", "1.2.3-a..b", "1.2.3+", "1.2.3-a_b"} {
+		var got SemVer
+		err := decodeValue(stringProto(in), stringType(), &got)
+		if err == nil || !strings.Contains(err.Error(), "is not a semantic version") {
+			t.Errorf("decodeValue(%q) returns error %v, want bad encoding", in, err)
+		}
+	}
+	if _, _, err := encodeValue(SemVer{Major: 1, Pre: "a..b"}); err == nil {
+		t.Errorf("encodeValue of invalid SemVer returns nil, want error")
+	}
+
+	// NULL decodes only into NullSemVer.
+	n := NullSemVer{SemVer{Major: 1}, true}
+	if err := decodeValue(nullProto(), stringType(), &n); err != nil || n.Valid {
+		t.Errorf("decodeValue(NULL) into NullSemVer = %v, %v, want NULL", n, err)
+	}
+	var v SemVer
+	if err := decodeValue(nullProto(), stringType(), &v); err == nil {
+		t.Errorf("decodeValue(NULL) into SemVer returns nil, want error")
+	}
+}
+
+func TestDecodeNestedArray(t *testing.T) {
+	nestedType := func(et *tspb.Type) *tspb.Type { return listType(listType(et)) }
+
+	// A 2x2 ARRAY<ARRAY<INT64>>.
+	pb := listProto(listProto(intProto(1), intProto(2)), listProto(intProto(3), nullProto()))
+	var ints [][]NullInt64
+	if err := decodeValue(pb, nestedType(intType()), &ints); err != nil {
+		t.Fatalf("decodeValue(%v) returns error: %v", pb, err)
+	}
+	if want := [][]NullInt64{{{1, true}, {2, true}}, {{3, true}, {}}}; !reflect.DeepEqual(ints, want) {
+		t.Errorf("decodeValue(%v) = %v, want %v", pb, ints, want)
+	}
+
+	// An inner NULL ARRAY is a nil slice, an empty one is not.
+	pb = listProto(listProto(stringProto("a")), nullProto(), listProto())
+	var strs [][]NullString
+	if err := decodeValue(pb, nestedType(stringType()), &strs); err != nil {
+		t.Fatalf("decodeValue(%v) returns error: %v", pb, err)
+	}
+	if want := [][]NullString{{{"a", true}}, nil, {}}; !reflect.DeepEqual(strs, want) {
+		t.Errorf("decodeValue(%v) = %v, want %v", pb, strs, want)
+	}
+
+	pb = listProto(listProto(floatProto(1.5)), listProto(floatProto(2)))
+	var floats [][]NullFloat64
+	if err := decodeValue(pb, nestedType(floatType()), &floats); err != nil {
+		t.Fatalf("decodeValue(%v) returns error: %v", pb, err)
+	}
+	if want := [][]NullFloat64{{{1.5, true}}, {{2, true}}}; !reflect.DeepEqual(floats, want) {
+		t.Errorf("decodeValue(%v) = %v, want %v", pb, floats, want)
+	}
+
+	// A NULL outer ARRAY is a nil slice.
+	ints = [][]NullInt64{{}}
+	if err := decodeValue(nullProto(), nestedType(intType()), &ints); err != nil || ints != nil {
+		t.Errorf("decodeValue(NULL) = %v, %v, want nil", ints, err)
+	}
+
+	for _, test := range []struct {
+		desc string
+		t    *tspb.Type
+	}{
+		{"flat ARRAY", listType(intType())},
+		{"other inner element type", nestedType(stringType())},
+		{"nil inner element type", listType(&tspb.Type{Code: tspb.TypeCode_ARRAY})},
+	} {
+		if err := decodeValue(listProto(), test.t, &ints); err == nil {
+			t.Errorf("%s: decodeValue(%v) returns nil, want error", test.desc, test.t)
+		}
+	}
+	if err := decodeValue(listProto(listProto(stringProto("x"))), nestedType(intType()), &ints); err == nil {
+		t.Errorf("decodeValue of bad inner element returns nil, want error")
+	}
+}
+
+func TestNullJSON(t *testing.T) {
+	doc := `{"name":"pen","stock":{"count":3,"sold":false},"tags":["a","b"]}`
+	var got NullJSON
+	if err := decodeValue(stringProto(doc), stringType(), &got); err != nil {
+		t.Fatalf("decodeValue(%q) returns error: %v", doc, err)
+	}
+	want := NullJSON{
+		Value: map[string]interface{}{
+			"name":  "pen",
+			"tags":  []interface{}{"a", "b"},
+			"stock": map[string]interface{}{"count": float64(3), "sold": false},
+		},
+		Valid: true,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decodeValue(%q) = %v, want %v", doc, got, want)
+	}
+	pb, pt, err := encodeValue(got)
+	if err != nil {
+		t.Fatalf("encodeValue(%v) returns error: %v", got, err)
+	}
+	// encoding/json sorts the keys of maps.
+	if !proto.Equal(pb, stringProto(doc)) || !proto.Equal(pt, stringType()) {
+		t.Errorf("encodeValue(%v) = %v, %v, want %q STRING", got, pb, pt, doc)
+	}
+
+	// NULL sets Valid false and encodes back as NULL.
+	if err := decodeValue(nullProto(), stringType(), &got); err != nil {
+		t.Fatalf("decodeValue(NULL) returns error: %v", err)
+	}
+	if got.Valid || got.Value != nil {
+		t.Errorf("decodeValue(NULL) = %+v, want NULL", got)
+	}
+	if pb, _, err := encodeValue(got); err != nil || !proto.Equal(pb, nullProto()) {
+		t.Errorf("encodeValue(%v) = %v, %v, want NULL", got, pb, err)
+	}
+
+	bad := `{"name":`
+	if err := decodeValue(stringProto(bad), stringType(), &got); err == nil {
+		t.Errorf("decodeValue(%q) returns nil, want error", bad)
+	}
+	if err := decodeValue(intProto(1), intType(), &got); err == nil {
+		t.Errorf("decodeValue of INT64 into NullJSON returns nil, want error")
+	}
+	if _, _, err := encodeValue(NullJSON{Value: make(chan int), Valid: true}); err == nil {
+		t.Errorf("encodeValue of unmarshalable NullJSON returns nil, want error")
+	}
+}
+
+func TestDecodeFixedSizeArray(t *testing.T) {
+	floats := listProto(floatProto(1.5), floatProto(2), floatProto(-3))
+	var vec [3]float64
+	if err := decodeValue(floats, listType(floatType()), &vec); err != nil {
+		t.Fatalf("decodeValue(%v) returns error: %v", floats, err)
+	}
+	if want := [3]float64{1.5, 2, -3}; vec != want {
+		t.Errorf("decodeValue(%v) = %v, want %v", floats, vec, want)
+	}
+
+	// Too few or too many elements are rejected, leaving the array as is.
+	for _, pb := range []*tspb.Value{
+		listProto(floatProto(7), floatProto(8)),
+		listProto(floatProto(7), floatProto(8), floatProto(9), floatProto(10)),
+	} {
+		before := vec
+		err := decodeValue(pb, listType(floatType()), &vec)
+		if err == nil || !strings.Contains(err.Error(), "into *[3]float64 of length 3") {
+			t.Errorf("decodeValue(%v) returns error %v, want length mismatch", pb, err)
+		}
+		if vec != before {
+			t.Errorf("decodeValue(%v) changed array to %v, want %v", pb, vec, before)
+		}
+	}
+
+	// Other scalar element types.
+	var ids [2]int64
+	if err := decodeValue(listProto(intProto(4), intProto(5)), listType(intType()), &ids); err != nil || ids != [2]int64{4, 5} {
+		t.Errorf("decodeValue into [2]int64 = %v, %v, want [4 5]", ids, err)
+	}
+	var names [2]NullString
+	if err := decodeValue(listProto(stringProto("a"), nullProto()), listType(stringType()), &names); err != nil ||
+		names != [2]NullString{{"a", true}, {}} {
+		t.Errorf("decodeValue into [2]NullString = %v, %v, want [a <null>]", names, err)
+	}
+	var empty [0]bool
+	if err := decodeValue(listProto(), listType(boolType()), &empty); err != nil {
+		t.Errorf("decodeValue into [0]bool returns error: %v", err)
+	}
+
+	// NULL elements need Null* elements, NULL arrays can't be decoded.
+	if err := decodeValue(listProto(intProto(4), nullProto()), listType(intType()), &ids); err == nil {
+		t.Errorf("decodeValue of NULL element into [2]int64 returns nil, want error")
+	}
+	if err := decodeValue(nullProto(), listType(intType()), &ids); err == nil {
+		t.Errorf("decodeValue of NULL into [2]int64 returns nil, want error")
+	}
+	if err := decodeValue(listProto(stringProto("a"), stringProto("b")), listType(stringType()), &ids); err == nil {
+		t.Errorf("decodeValue of STRING ARRAY into [2]int64 returns nil, want error")
+	}
+	if err := decodeValue(floatProto(1), floatType(), &vec); err == nil {
+		t.Errorf("decodeValue of FLOAT64 into [3]float64 returns nil, want error")
+	}
+}